@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/awesome-gocui/gocui"
+	"github.com/ksiezykm/FerretMate/console"
+	"github.com/ksiezykm/FerretMate/db"
+	"github.com/ksiezykm/FerretMate/list"
+	"github.com/ksiezykm/FerretMate/model"
+	"github.com/ksiezykm/FerretMate/notepad"
+	"github.com/ksiezykm/FerretMate/popup"
+)
+
+// commandTimeout limits how long a console command may run
+const commandTimeout = time.Minute
+
+// commandConsole runs raw database commands typed in a console below the
+// notepad and shows the replies in the notepad
+type commandConsole struct {
+	g      *gocui.Gui
+	m      *model.Model
+	list   *list.List
+	note   *notepad.Notepad
+	widget *console.Console
+
+	active bool
+	dbName string             // database the commands run against
+	cancel context.CancelFunc // cancels the running command
+}
+
+// newCommandConsole creates the console with the saved history
+func newCommandConsole(g *gocui.Gui, m *model.Model, l *list.List, n *notepad.Notepad) *commandConsole {
+	history, err := model.LoadHistory()
+	if err != nil {
+		log.Printf("Failed to load command history: %v", err)
+	}
+	cc := &commandConsole{g: g, m: m, list: l, note: n}
+	cc.widget = &console.Console{
+		Name:     "console",
+		History:  history,
+		Complete: db.CompleteCommand,
+		OnRun:    cc.run,
+		OnClose:  cc.Close,
+	}
+	return cc
+}
+
+// Open shows the console for the database under the cursor (databases
+// level) or the selected database (deeper levels)
+func (cc *commandConsole) Open() {
+	switch cc.m.SelectedListView {
+	case "connections":
+		return
+	case "dbs":
+		if cc.list.Selected >= len(cc.m.DBs) {
+			return
+		}
+		cc.dbName = cc.m.DBs[cc.list.Selected]
+	default:
+		cc.dbName = cc.m.SelectedDB
+	}
+	if cc.note.Editing {
+		return
+	}
+
+	cc.active = true
+	cc.widget.Title = "Command on " + cc.m.SelectedConnection + " > " + cc.dbName
+	cc.note.Reserved = 3
+	cc.g.Update(func(g *gocui.Gui) error {
+		cc.list.SetActive(g, false)
+		cc.note.SetActive(g, false)
+		cc.widget.Focus(g)
+		return nil
+	})
+}
+
+// Close hides the console and returns to the list
+func (cc *commandConsole) Close() {
+	if cc.cancel != nil {
+		cc.cancel()
+		cc.cancel = nil
+	}
+	cc.active = false
+	cc.note.Reserved = 0
+	cc.widget.Hide(cc.g)
+	cc.list.SetActive(cc.g, true)
+	cc.g.SetCurrentView(cc.list.Name)
+}
+
+// Layout draws the console below the notepad while it is open
+func (cc *commandConsole) Layout(g *gocui.Gui) error {
+	if !cc.active {
+		return nil
+	}
+	maxX, maxY := g.Size()
+	return cc.widget.Layout(g, maxX/2, maxY-5, maxX-1)
+}
+
+// run parses and runs a command in the background, showing the reply in the notepad
+func (cc *commandConsole) run(text string) {
+	history, err := model.AppendHistory(cc.widget.History, text)
+	if err != nil {
+		log.Printf("Failed to save command history: %v", err)
+	}
+	cc.widget.History = history
+
+	cmd, err := db.ParseCommand(text)
+	if err != nil {
+		cc.show("Invalid command", "Invalid command: "+err.Error())
+		return
+	}
+	s := db.Lookup(cc.m.SelectedConnection)
+	if s == nil {
+		popup.ShowInfoWithFocus(cc.g, "Session '"+cc.m.SelectedConnection+"' is closed", cc.widget.Name)
+		return
+	}
+
+	// A new command replaces the running one
+	if cc.cancel != nil {
+		cc.cancel()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	cc.cancel = cancel
+
+	name, dbName := cmd[0].Key, cc.dbName
+	title := name + " on " + dbName
+	cc.show(title, "Running "+text+" ...")
+
+	go func() {
+		start := time.Now()
+		reply, err := db.RunCommand(ctx, s.Client, dbName, cmd)
+		if ctx.Err() == context.Canceled {
+			return
+		}
+		cancel()
+		elapsed := time.Since(start).Round(time.Millisecond)
+
+		cc.g.Update(func(g *gocui.Gui) error {
+			if err != nil {
+				log.Printf("Command %s failed: %v", name, err)
+				cc.show(title+" - failed", fmt.Sprintf("%s\n\nError: %v", text, err))
+				return nil
+			}
+			cc.show(fmt.Sprintf("%s (%s)", title, elapsed), reply)
+			return nil
+		})
+	}()
+}
+
+// show displays read-only text in the notepad
+func (cc *commandConsole) show(title, content string) {
+	if v, err := cc.g.View(cc.note.Name); err == nil {
+		v.Title = title
+		v.SetOrigin(0, 0)
+		v.SetCursor(0, 0)
+	}
+	cc.note.Editable = false
+	cc.note.Update(cc.g, content)
+}
+
+// BindKeys registers : for opening the console and the console keys
+func (cc *commandConsole) BindKeys() {
+	if err := cc.g.SetKeybinding("", ':', gocui.ModNone, func(g *gocui.Gui, v *gocui.View) error {
+		if cc.active || v == nil || v.Name() != cc.list.Name {
+			return nil
+		}
+		cc.Open()
+		return nil
+	}); err != nil {
+		log.Panicln(err)
+	}
+	cc.widget.BindKeys(cc.g)
+
+	// Page through a long reply without leaving the console
+	for key, delta := range map[gocui.Key]int{gocui.KeyPgup: -1, gocui.KeyPgdn: 1} {
+		delta := delta
+		if err := cc.g.SetKeybinding(cc.widget.Name, key, gocui.ModNone, func(g *gocui.Gui, v *gocui.View) error {
+			nv, err := g.View(cc.note.Name)
+			if err != nil {
+				return nil
+			}
+			_, h := nv.Size()
+			ox, oy := nv.Origin()
+			oy += delta * h
+			if max := len(cc.note.Lines) - h; oy > max {
+				oy = max
+			}
+			if oy < 0 {
+				oy = 0
+			}
+			nv.SetOrigin(ox, oy)
+			return nil
+		}); err != nil {
+			log.Panicln(err)
+		}
+	}
+}
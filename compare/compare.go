@@ -0,0 +1,337 @@
+package compare
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/awesome-gocui/gocui"
+	"github.com/ksiezykm/FerretMate/diff"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Side is one of the two compared documents
+type Side struct {
+	Title string
+	Doc   bson.D
+	Dirty bool // true if fields were copied into it since it was loaded
+}
+
+// Compare shows two documents field by field, side by side or as a unified
+// diff, and copies single fields from one side to the other
+type Compare struct {
+	Name     string // prefix of the view names
+	Left     *Side
+	Right    *Side
+	Unified  bool
+	Selected int
+	OnSave   func() // callback when Ctrl+S is pressed
+	OnClose  func() // callback when Esc is pressed; it decides when to Hide
+
+	fields  []diff.Field
+	rowLine []int // first unified line of each field
+}
+
+// ANSI colors of the field states
+const (
+	colorRemoved  = "\x1b[31m"
+	colorAdded    = "\x1b[32m"
+	colorModified = "\x1b[33m"
+	colorReset    = "\x1b[0m"
+)
+
+func (c *Compare) leftName() string    { return c.Name + "Left" }
+func (c *Compare) rightName() string   { return c.Name + "Right" }
+func (c *Compare) unifiedName() string { return c.Name + "Unified" }
+
+// Layout draws the compare views in the given area
+func (c *Compare) Layout(g *gocui.Gui, x0, y0, x1, y1 int) error {
+	if c.Unified {
+		g.DeleteView(c.leftName())
+		g.DeleteView(c.rightName())
+		if v, err := g.SetView(c.unifiedName(), x0, y0, x1, y1, 0); err != nil {
+			if err != gocui.ErrUnknownView {
+				return err
+			}
+			c.setupView(v)
+			c.render(g)
+		}
+		return nil
+	}
+
+	g.DeleteView(c.unifiedName())
+	mid := (x0 + x1) / 2
+	created := false
+	for _, pane := range []struct {
+		name   string
+		x0, x1 int
+	}{{c.leftName(), x0, mid}, {c.rightName(), mid + 1, x1}} {
+		v, err := g.SetView(pane.name, pane.x0, y0, pane.x1, y1, 0)
+		if err != nil {
+			if err != gocui.ErrUnknownView {
+				return err
+			}
+			c.setupView(v)
+			created = true
+		}
+	}
+	if created {
+		c.render(g)
+	}
+	return nil
+}
+
+// setupView sets the common look of the compare views
+func (c *Compare) setupView(v *gocui.View) {
+	v.Wrap = false
+	v.Highlight = true
+	v.SelBgColor = gocui.ColorCyan
+	v.SelFgColor = gocui.ColorBlack
+	v.FrameColor = gocui.ColorCyan
+}
+
+// ViewName returns the name of the view that takes the focus
+func (c *Compare) ViewName() string {
+	if c.Unified {
+		return c.unifiedName()
+	}
+	return c.leftName()
+}
+
+// Focus makes the compare views the current view
+func (c *Compare) Focus(g *gocui.Gui) {
+	g.SetCurrentView(c.ViewName())
+}
+
+// Refresh recomputes the field differences and redraws the views
+func (c *Compare) Refresh(g *gocui.Gui) {
+	c.render(g)
+}
+
+// render writes the fields into the views
+func (c *Compare) render(g *gocui.Gui) {
+	c.fields = diff.Fields(c.Left.Doc, c.Right.Doc)
+	if c.Selected >= len(c.fields) {
+		c.Selected = len(c.fields) - 1
+	}
+	if c.Selected < 0 {
+		c.Selected = 0
+	}
+
+	subtitle := " ↑↓: Move | >/<: Copy field right/left | u: Unified | Ctrl+S: Save | ESC: Close "
+	if c.Unified {
+		c.renderUnified(g, subtitle)
+	} else {
+		c.renderSideBySide(g, subtitle)
+	}
+	c.moveCursor(g)
+}
+
+// renderSideBySide writes one line per field into each of the two views
+func (c *Compare) renderSideBySide(g *gocui.Gui, subtitle string) {
+	left, errL := g.View(c.leftName())
+	right, errR := g.View(c.rightName())
+	if errL != nil || errR != nil {
+		return
+	}
+	left.Title = sideTitle("Left", c.Left)
+	right.Title = sideTitle("Right", c.Right)
+	right.Subtitle = subtitle
+	left.Clear()
+	right.Clear()
+
+	for _, f := range c.fields {
+		l := f.Path + ": " + diff.FormatValue(f.Left)
+		r := f.Path + ": " + diff.FormatValue(f.Right)
+		switch f.Op() {
+		case diff.Removed:
+			l = colorRemoved + l + colorReset
+			r = ""
+		case diff.Added:
+			l = ""
+			r = colorAdded + r + colorReset
+		case diff.Modified:
+			l = colorModified + l + colorReset
+			r = colorModified + r + colorReset
+		}
+		fmt.Fprintln(left, l)
+		fmt.Fprintln(right, r)
+	}
+}
+
+// renderUnified writes the fields as a unified diff; changed fields take two lines
+func (c *Compare) renderUnified(g *gocui.Gui, subtitle string) {
+	v, err := g.View(c.unifiedName())
+	if err != nil {
+		return
+	}
+	v.Title = sideTitle("- Left", c.Left) + " " + sideTitle("+ Right", c.Right)
+	v.Subtitle = subtitle
+	v.Clear()
+
+	c.rowLine = c.rowLine[:0]
+	line := 0
+	for _, f := range c.fields {
+		c.rowLine = append(c.rowLine, line)
+		l := f.Path + ": " + diff.FormatValue(f.Left)
+		r := f.Path + ": " + diff.FormatValue(f.Right)
+		switch f.Op() {
+		case diff.Equal:
+			fmt.Fprintln(v, "  "+l)
+		case diff.Removed:
+			fmt.Fprintln(v, colorRemoved+"- "+l+colorReset)
+		case diff.Added:
+			fmt.Fprintln(v, colorAdded+"+ "+r+colorReset)
+		case diff.Modified:
+			fmt.Fprintln(v, colorRemoved+"- "+l+colorReset)
+			fmt.Fprintln(v, colorAdded+"+ "+r+colorReset)
+			line++
+		}
+		line++
+	}
+}
+
+// sideTitle is the frame title of a side, with * if it has unsaved changes
+func sideTitle(label string, s *Side) string {
+	title := label + ": " + s.Title
+	if s.Dirty {
+		title += " *"
+	}
+	return title
+}
+
+// moveCursor scrolls the views so that the selected field is visible
+func (c *Compare) moveCursor(g *gocui.Gui) {
+	names := []string{c.leftName(), c.rightName()}
+	line := c.Selected
+	if c.Unified {
+		names = []string{c.unifiedName()}
+		if c.Selected < len(c.rowLine) {
+			line = c.rowLine[c.Selected]
+		}
+	}
+
+	for _, name := range names {
+		v, err := g.View(name)
+		if err != nil {
+			continue
+		}
+		_, h := v.Size()
+		_, oy := v.Origin()
+		if line < oy {
+			oy = line
+		} else if h > 0 && line >= oy+h {
+			oy = line - h + 1
+		}
+		v.SetOrigin(0, oy)
+		v.SetCursor(0, line-oy)
+	}
+}
+
+// CursorUp selects the previous field
+func (c *Compare) CursorUp(g *gocui.Gui, v *gocui.View) error {
+	if c.Selected > 0 {
+		c.Selected--
+		c.moveCursor(g)
+	}
+	return nil
+}
+
+// CursorDown selects the next field
+func (c *Compare) CursorDown(g *gocui.Gui, v *gocui.View) error {
+	if c.Selected < len(c.fields)-1 {
+		c.Selected++
+		c.moveCursor(g)
+	}
+	return nil
+}
+
+// CopyRight copies the selected field from the left document into the right one
+func (c *Compare) CopyRight(g *gocui.Gui, v *gocui.View) error {
+	return c.copyField(g, c.Left, c.Right)
+}
+
+// CopyLeft copies the selected field from the right document into the left one
+func (c *Compare) CopyLeft(g *gocui.Gui, v *gocui.View) error {
+	return c.copyField(g, c.Right, c.Left)
+}
+
+// copyField copies the selected field between the sides; a field missing in
+// src is removed from dst. The _id is never copied.
+func (c *Compare) copyField(g *gocui.Gui, src, dst *Side) error {
+	if c.Selected >= len(c.fields) {
+		return nil
+	}
+	f := c.fields[c.Selected]
+	if f.Path == "_id" || strings.HasPrefix(f.Path, "_id.") || f.Op() == diff.Equal {
+		return nil
+	}
+	dst.Doc = diff.CopyField(dst.Doc, src.Doc, f.Path)
+	dst.Dirty = true
+	c.render(g)
+	return nil
+}
+
+// ToggleUnified switches between the side-by-side and the unified view
+func (c *Compare) ToggleUnified(g *gocui.Gui, v *gocui.View) error {
+	c.Unified = !c.Unified
+	// The layout manager creates the views of the new mode
+	g.Update(func(g *gocui.Gui) error {
+		c.Focus(g)
+		return nil
+	})
+	return nil
+}
+
+// Save calls OnSave
+func (c *Compare) Save(g *gocui.Gui, v *gocui.View) error {
+	if c.OnSave != nil {
+		c.OnSave()
+	}
+	return nil
+}
+
+// Close calls OnClose, or hides the views if there is no callback
+func (c *Compare) Close(g *gocui.Gui, v *gocui.View) error {
+	if c.OnClose != nil {
+		c.OnClose()
+		return nil
+	}
+	c.Hide(g)
+	return nil
+}
+
+// Dirty reports whether either side has unsaved changes
+func (c *Compare) Dirty() bool {
+	return c.Left.Dirty || c.Right.Dirty
+}
+
+// Hide removes the compare views
+func (c *Compare) Hide(g *gocui.Gui) {
+	for _, name := range []string{c.leftName(), c.rightName(), c.unifiedName()} {
+		g.DeleteView(name)
+	}
+}
+
+// BindKeys registers the keys of the compare views
+func (c *Compare) BindKeys(g *gocui.Gui) {
+	bindings := []struct {
+		key     interface{}
+		handler func(*gocui.Gui, *gocui.View) error
+	}{
+		{gocui.KeyArrowUp, c.CursorUp},
+		{gocui.KeyArrowDown, c.CursorDown},
+		{'>', c.CopyRight},
+		{'<', c.CopyLeft},
+		{'u', c.ToggleUnified},
+		{gocui.KeyCtrlS, c.Save},
+		{gocui.KeyEsc, c.Close},
+	}
+	for _, name := range []string{c.leftName(), c.rightName(), c.unifiedName()} {
+		for _, b := range bindings {
+			if err := g.SetKeybinding(name, b.key, gocui.ModNone, b.handler); err != nil {
+				log.Panicln(err)
+			}
+		}
+	}
+}
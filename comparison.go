@@ -0,0 +1,261 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/awesome-gocui/gocui"
+	"github.com/ksiezykm/FerretMate/compare"
+	"github.com/ksiezykm/FerretMate/db"
+	"github.com/ksiezykm/FerretMate/list"
+	"github.com/ksiezykm/FerretMate/model"
+	"github.com/ksiezykm/FerretMate/notepad"
+	"github.com/ksiezykm/FerretMate/popup"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// compareTarget is a document marked for comparison; it may come from any
+// connection, database and collection
+type compareTarget struct {
+	conn, db, coll string
+	id             interface{}
+	label          string
+	snapshot       string // the document as loaded, for conflict detection on save
+}
+
+// comparison marks two documents with [ and ] and shows them side by side
+// in place of the notepad
+type comparison struct {
+	g      *gocui.Gui
+	m      *model.Model
+	list   *list.List
+	note   *notepad.Notepad
+	widget *compare.Compare
+
+	left, right *compareTarget
+	active      bool
+}
+
+// newComparison creates the comparison and its widget
+func newComparison(g *gocui.Gui, m *model.Model, l *list.List, n *notepad.Notepad) *comparison {
+	c := &comparison{g: g, m: m, list: l, note: n}
+	c.widget = &compare.Compare{Name: "compare", OnSave: c.save, OnClose: c.close}
+	return c
+}
+
+// Mark marks the selected document as the left or the right side
+func (c *comparison) Mark(right bool) {
+	if c.m.SelectedListView != "documents" {
+		return
+	}
+	index := c.list.Selected
+	if v := c.g.CurrentView(); v != nil && v.Name() == c.note.Name && c.m.SelectedDocument != nil {
+		index = c.m.SelectedDocumentIndex
+	}
+	if index >= len(c.m.Documents) {
+		return
+	}
+	doc := c.m.Documents[index]
+
+	t := &compareTarget{
+		conn:  c.m.SelectedConnection,
+		db:    c.m.SelectedDB,
+		coll:  c.m.SelectedCollection,
+		id:    doc.ID,
+		label: c.m.SelectedConnection + " > " + c.m.SelectedDB + " > " + c.m.SelectedCollection + " > " + doc.Summary,
+	}
+	side := "left"
+	if right {
+		c.right = t
+		side = "right"
+	} else {
+		c.left = t
+	}
+
+	returnTo := c.list.Name
+	if v := c.g.CurrentView(); v != nil {
+		returnTo = v.Name()
+	}
+	msg := "Marked as " + side + ": " + t.label
+	if c.left != nil && c.right != nil {
+		msg += " (press = to compare)"
+	}
+	popup.ShowInfoWithFocus(c.g, msg, returnTo)
+}
+
+// Open loads both marked documents and shows the comparison
+func (c *comparison) Open() {
+	if c.active {
+		return
+	}
+	if c.left == nil || c.right == nil {
+		popup.ShowInfo(c.g, "Mark a left document with [ and a right one with ] first")
+		return
+	}
+
+	left, err := c.load(c.left)
+	if err != nil {
+		popup.ShowInfo(c.g, "Failed to load left document: "+err.Error())
+		log.Printf("Failed to load left document: %v", err)
+		return
+	}
+	right, err := c.load(c.right)
+	if err != nil {
+		popup.ShowInfo(c.g, "Failed to load right document: "+err.Error())
+		log.Printf("Failed to load right document: %v", err)
+		return
+	}
+
+	c.widget.Left = &compare.Side{Title: c.left.label, Doc: left}
+	c.widget.Right = &compare.Side{Title: c.right.label, Doc: right}
+	c.widget.Selected = 0
+	c.active = true
+
+	// The layout manager creates the views
+	c.g.Update(func(g *gocui.Gui) error {
+		c.list.SetActive(g, false)
+		c.note.SetActive(g, false)
+		c.widget.Focus(g)
+		return nil
+	})
+}
+
+// load fetches a marked document and records its snapshot
+func (c *comparison) load(t *compareTarget) (bson.D, error) {
+	s := db.Lookup(t.conn)
+	if s == nil {
+		return nil, fmt.Errorf("session '%s' is closed", t.conn)
+	}
+	content, err := db.GetDocument(s.Client, t.db, t.coll, t.id)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := db.ParseDocument(content)
+	if err != nil {
+		return nil, err
+	}
+	t.snapshot = content
+	return doc, nil
+}
+
+// Layout draws the comparison over the notepad while it is open
+func (c *comparison) Layout(g *gocui.Gui) error {
+	if !c.active {
+		return nil
+	}
+	maxX, maxY := g.Size()
+	return c.widget.Layout(g, maxX/2, 3, maxX-1, maxY-3)
+}
+
+// save writes the sides with copied fields back to their collections
+func (c *comparison) save() {
+	var saved, failed []string
+	for _, s := range []struct {
+		name   string
+		side   *compare.Side
+		target *compareTarget
+	}{{"left", c.widget.Left, c.left}, {"right", c.widget.Right, c.right}} {
+		if !s.side.Dirty {
+			continue
+		}
+		if err := c.saveSide(s.side, s.target); err != nil {
+			var conflictErr *db.ConflictError
+			if errors.As(err, &conflictErr) {
+				failed = append(failed, s.name+": changed since it was loaded, compare again")
+			} else {
+				failed = append(failed, s.name+": "+err.Error())
+			}
+			log.Printf("Failed to save %s document: %v", s.name, err)
+			continue
+		}
+		saved = append(saved, s.name)
+	}
+	c.widget.Refresh(c.g)
+
+	switch {
+	case len(failed) > 0:
+		popup.ShowInfoWithFocus(c.g, "Failed to save "+strings.Join(failed, "; "), c.widget.ViewName())
+	case len(saved) > 0:
+		popup.ShowInfoWithFocus(c.g, "Saved "+strings.Join(saved, " and ")+" document", c.widget.ViewName())
+	}
+}
+
+// saveSide updates one document unless it changed since it was loaded
+func (c *comparison) saveSide(side *compare.Side, t *compareTarget) error {
+	s := db.Lookup(t.conn)
+	if s == nil {
+		return fmt.Errorf("session '%s' is closed", t.conn)
+	}
+	raw, err := bson.Marshal(side.Doc)
+	if err != nil {
+		return err
+	}
+	content, err := db.FormatDocument(raw)
+	if err != nil {
+		return err
+	}
+	if err := db.UpdateDocument(s.Client, t.db, t.coll, t.id, t.snapshot, content); err != nil {
+		return err
+	}
+
+	// Continue from the stored version
+	doc, err := c.load(t)
+	if err != nil {
+		t.snapshot = content
+		doc = side.Doc
+	}
+	side.Doc = doc
+	side.Dirty = false
+	return nil
+}
+
+// close hides the comparison, asking first if there are unsaved changes
+func (c *comparison) close() {
+	if !c.widget.Dirty() {
+		c.hide()
+		return
+	}
+	popup.ShowConfirmation(c.g, "Discard the unsaved changes?", c.hide, func() {
+		c.g.Update(func(g *gocui.Gui) error {
+			c.widget.Focus(g)
+			return nil
+		})
+	})
+}
+
+// hide removes the comparison and returns to the list
+func (c *comparison) hide() {
+	c.active = false
+	c.widget.Hide(c.g)
+	c.note.SetActive(c.g, false)
+	c.list.SetActive(c.g, true)
+	c.g.SetCurrentView(c.list.Name)
+}
+
+// BindKeys registers [ and ] for marking, = for comparing and the widget keys
+func (c *comparison) BindKeys() {
+	bindings := []struct {
+		key     rune
+		handler func()
+	}{
+		{'[', func() { c.Mark(false) }},
+		{']', func() { c.Mark(true) }},
+		{'=', c.Open},
+	}
+	for _, b := range bindings {
+		handler := b.handler
+		if err := c.g.SetKeybinding("", b.key, gocui.ModNone, func(g *gocui.Gui, v *gocui.View) error {
+			// Only from the list or the notepad (not while editing)
+			if c.active || v == nil || (v.Name() != c.list.Name && v.Name() != c.note.Name) || c.note.Editing {
+				return nil
+			}
+			handler()
+			return nil
+		}); err != nil {
+			log.Panicln(err)
+		}
+	}
+	c.widget.BindKeys(c.g)
+}
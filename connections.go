@@ -0,0 +1,505 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/awesome-gocui/gocui"
+	"github.com/ksiezykm/FerretMate/db"
+	"github.com/ksiezykm/FerretMate/list"
+	"github.com/ksiezykm/FerretMate/model"
+	"github.com/ksiezykm/FerretMate/notepad"
+	"github.com/ksiezykm/FerretMate/popup"
+)
+
+// connectionManager adds, edits, clones, deletes and reorders the saved
+// connections on the "connections" level of the list
+type connectionManager struct {
+	level
+	note *notepad.Notepad // shows diagnostics reports
+
+	// onClose is called after the session of a connection was closed
+	onClose func(name string)
+}
+
+// selected returns the index of the connection under the cursor, or -1
+func (cm *connectionManager) selected() int {
+	if cm.m.SelectedListView != "connections" || cm.list.Selected >= len(cm.m.LoadedConnections) {
+		return -1
+	}
+	return cm.list.Selected
+}
+
+// Add shows the form for a new connection
+func (cm *connectionManager) Add() {
+	conn := model.Connection{}
+	cm.showForm("New Connection", conn, -1, func(c model.Connection) []model.Connection {
+		return append(cm.connections(), c)
+	})
+}
+
+// Edit shows the form for the connection under the cursor
+func (cm *connectionManager) Edit() {
+	i := cm.selected()
+	if i < 0 {
+		return
+	}
+	cm.showForm("Edit Connection", cm.m.LoadedConnections[i], i, func(c model.Connection) []model.Connection {
+		conns := cm.connections()
+		conns[i] = c
+		return conns
+	})
+}
+
+// Clone shows the form for a copy of the connection under the cursor
+func (cm *connectionManager) Clone() {
+	i := cm.selected()
+	if i < 0 {
+		return
+	}
+	conn := cm.m.LoadedConnections[i]
+	conn.Name = cm.uniqueName(conn.Name + " (copy)")
+	cm.showForm("Clone Connection", conn, -1, func(c model.Connection) []model.Connection {
+		conns := cm.connections()
+		return append(conns[:i+1], append([]model.Connection{c}, conns[i+1:]...)...)
+	})
+}
+
+// TLS shows the TLS options form for the connection under the cursor
+func (cm *connectionManager) TLS() {
+	i := cm.selected()
+	if i < 0 {
+		return
+	}
+	cm.showTLSForm("TLS Options: "+cm.m.LoadedConnections[i].Name, cm.m.LoadedConnections[i], i)
+}
+
+// SSH shows the SSH tunnel form for the connection under the cursor
+func (cm *connectionManager) SSH() {
+	i := cm.selected()
+	if i < 0 {
+		return
+	}
+	cm.showSSHForm("SSH Tunnel: "+cm.m.LoadedConnections[i].Name, cm.m.LoadedConnections[i], i)
+}
+
+// Diagnose runs the diagnostics of the connection under the cursor and shows
+// the report in the notepad
+func (cm *connectionManager) Diagnose() {
+	i := cm.selected()
+	if i < 0 {
+		return
+	}
+	conn := cm.m.LoadedConnections[i]
+
+	cm.showReport("Diagnostics: "+conn.Name, "Running diagnostics for "+conn.Name+"...")
+	go func() {
+		report := db.Diagnose(conn)
+		cm.g.Update(func(g *gocui.Gui) error {
+			cm.showReport("Diagnostics: "+conn.Name, report)
+			return nil
+		})
+	}()
+}
+
+// showReport shows read-only text in the notepad
+func (cm *connectionManager) showReport(title, text string) {
+	if v, err := cm.g.View(cm.note.Name); err == nil {
+		v.Title = title
+	}
+	cm.note.Editable = false
+	cm.note.Update(cm.g, text)
+}
+
+// CloseSession closes the open session of the connection under the cursor
+func (cm *connectionManager) CloseSession() {
+	i := cm.selected()
+	if i < 0 {
+		return
+	}
+	name := cm.m.LoadedConnections[i].Name
+	if db.Lookup(name) == nil {
+		return
+	}
+	cm.closeSession(name)
+	cm.list.Items = connectionItems(cm.m.Connections)
+	cm.list.Update(cm.g)
+}
+
+// closeSession closes the session of a connection, e.g. before its settings change
+func (cm *connectionManager) closeSession(name string) {
+	if err := db.Close(name); err != nil {
+		log.Printf("Failed to close session %s: %v", name, err)
+	}
+	if cm.m.SelectedConnection == name {
+		cm.m.SelectedConnection = ""
+	}
+	if cm.onClose != nil {
+		cm.onClose(name)
+	}
+}
+
+// Delete removes the connection under the cursor after a confirmation
+func (cm *connectionManager) Delete() {
+	i := cm.selected()
+	if i < 0 {
+		return
+	}
+	name := cm.m.LoadedConnections[i].Name
+	popup.ShowConfirmation(cm.g, "Delete connection '"+name+"'?", func() {
+		cm.closeSession(name)
+		conns := cm.connections()
+		conns = append(conns[:i], conns[i+1:]...)
+		selected := i
+		if selected >= len(conns) {
+			selected = len(conns) - 1
+		}
+		cm.save(conns, selected)
+	}, func() {
+		// Cancelled - do nothing
+	})
+}
+
+// Move moves the connection under the cursor up (delta < 0) or down (delta > 0)
+func (cm *connectionManager) Move(delta int) {
+	i := cm.selected()
+	j := i + delta
+	if i < 0 || j < 0 || j >= len(cm.m.LoadedConnections) {
+		return
+	}
+	conns := cm.connections()
+	conns[i], conns[j] = conns[j], conns[i]
+	cm.save(conns, j)
+}
+
+// connections returns a copy of the loaded connections
+func (cm *connectionManager) connections() []model.Connection {
+	return append([]model.Connection(nil), cm.m.LoadedConnections...)
+}
+
+// uniqueName returns name, or name with a number appended if it is already taken
+func (cm *connectionManager) uniqueName(name string) string {
+	candidate := name
+	for n := 2; cm.nameTaken(candidate, -1); n++ {
+		candidate = fmt.Sprintf("%s %d", name, n)
+	}
+	return candidate
+}
+
+// nameTaken reports whether another connection than the one at index skip has the name
+func (cm *connectionManager) nameTaken(name string, skip int) bool {
+	for i, c := range cm.m.LoadedConnections {
+		if i != skip && c.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// showForm shows the connection form. index is the edited connection (-1 for a new one)
+// and apply returns the connection list with the result of the form in place.
+func (cm *connectionManager) showForm(title string, conn model.Connection, index int, apply func(c model.Connection) []model.Connection) {
+	port := ""
+	if conn.Port != 0 {
+		port = strconv.Itoa(conn.Port)
+	}
+
+	form := &popup.Form{
+		Name:  "connectionForm",
+		Title: title,
+		Fields: []popup.FormField{
+			{Label: "Name", Value: conn.Name},
+			{Label: "Connection string (optional, the fields below override it)", Value: model.RedactURI(conn.URI)},
+			{Label: "Host", Value: conn.Host},
+			{Label: "Port", Value: port},
+			{Label: "Username", Value: conn.Username},
+			{Label: "Password", Value: conn.Password, Mask: true},
+			{Label: "Database", Value: conn.Database},
+		},
+		OnCancel: cm.focusList,
+	}
+	form.OnSave = func(values []string) {
+		c := formConnection(conn, values)
+
+		// Show the form again with the entered values and the problem in the title
+		retry := func(problem string) {
+			cm.showForm(retryTitle(title, problem), c, index, apply)
+		}
+
+		// The form shows the connection string redacted; put the stored secrets
+		// back, or have them entered again where that is not possible
+		uri, restored := model.RestoreURISecrets(c.URI, conn.URI)
+		c.URI = uri
+		if !restored {
+			retry("enter the password and secrets of the connection string again")
+			return
+		}
+
+		p, err := strconv.Atoi(values[3])
+		if values[3] == "" && c.URI != "" {
+			// The port is optional when a connection string is given
+			p, err = 0, nil
+		}
+		switch {
+		case c.Name == "":
+			retry("name is required")
+			return
+		case cm.nameTaken(c.Name, index):
+			retry("name '" + c.Name + "' is already used")
+			return
+		case c.URI != "" && db.ValidateURI(c.URI) != nil:
+			retry(c.RedactText(db.ValidateURI(c.URI).Error()))
+			return
+		case c.Host == "" && c.URI == "":
+			retry("host or connection string is required")
+			return
+		case err != nil || (c.URI == "" && p < 1) || p < 0 || p > 65535:
+			retry("port must be a number between 1 and 65535")
+			return
+		}
+		c.Port = p
+
+		conns := apply(c)
+		selected := index
+		if selected < 0 {
+			selected = indexOf(conns, c.Name)
+		}
+
+		// The session of an edited connection uses the old settings
+		if index >= 0 && c != cm.m.LoadedConnections[index] {
+			cm.closeSession(cm.m.LoadedConnections[index].Name)
+		}
+		cm.save(conns, selected)
+	}
+
+	if err := form.Show(cm.g); err != nil {
+		log.Panicln(err)
+	}
+	form.BindKeys(cm.g)
+}
+
+// formConnection returns conn with the fields of the connection form set to
+// values. The TLS and SSH settings have forms of their own and are kept.
+func formConnection(conn model.Connection, values []string) model.Connection {
+	c := conn
+	c.Name, c.URI, c.Host = values[0], values[1], values[2]
+	c.Port, _ = strconv.Atoi(values[3])
+	c.Username, c.Password, c.Database = values[4], values[5], values[6]
+	return c
+}
+
+// showTLSForm shows the TLS and X.509 options of the connection at index
+func (cm *connectionManager) showTLSForm(title string, conn model.Connection, index int) {
+	form := &popup.Form{
+		Name:  "tlsForm",
+		Title: title,
+		Fields: []popup.FormField{
+			{Label: "Use TLS (yes/no)", Value: formatBool(conn.TLS)},
+			{Label: "CA file (PEM)", Value: conn.TLSCAFile},
+			{Label: "Client certificate file (PEM)", Value: conn.TLSCertFile},
+			{Label: "Client key file (PEM, empty if in the certificate file)", Value: conn.TLSKeyFile},
+			{Label: "Skip certificate verification (yes/no)", Value: formatBool(conn.TLSInsecure)},
+			{Label: "Server name (SNI)", Value: conn.TLSServerName},
+			{Label: "Auth mechanism (empty or " + model.AuthX509 + ")", Value: conn.AuthMechanism},
+		},
+		OnCancel: cm.focusList,
+	}
+	form.OnSave = func(values []string) {
+		c := conn
+		c.TLSCAFile = values[1]
+		c.TLSCertFile = values[2]
+		c.TLSKeyFile = values[3]
+		c.TLSServerName = values[5]
+		c.AuthMechanism = strings.ToUpper(values[6])
+
+		// Show the form again with the entered values and the problem in the title
+		retry := func(problem string) {
+			c.TLS, _ = parseBool(values[0])
+			c.TLSInsecure, _ = parseBool(values[4])
+			cm.showTLSForm(retryTitle(title, problem), c, index)
+		}
+
+		var ok bool
+		if c.TLS, ok = parseBool(values[0]); !ok {
+			retry("use TLS must be yes or no")
+			return
+		}
+		if c.TLSInsecure, ok = parseBool(values[4]); !ok {
+			retry("skip verification must be yes or no")
+			return
+		}
+		if c.AuthMechanism != "" && c.AuthMechanism != model.AuthX509 {
+			retry("auth mechanism must be empty or " + model.AuthX509)
+			return
+		}
+		for _, file := range []string{c.TLSCAFile, c.TLSCertFile, c.TLSKeyFile} {
+			if file == "" {
+				continue
+			}
+			if _, err := os.Stat(file); err != nil {
+				retry("cannot read " + file)
+				return
+			}
+		}
+		if c.AuthMechanism == model.AuthX509 && c.TLSCertFile == "" {
+			retry(model.AuthX509 + " needs a client certificate")
+			return
+		}
+
+		if c != conn {
+			cm.closeSession(conn.Name)
+		}
+		conns := cm.connections()
+		conns[index] = c
+		cm.save(conns, index)
+	}
+
+	if err := form.Show(cm.g); err != nil {
+		log.Panicln(err)
+	}
+	form.BindKeys(cm.g)
+}
+
+// showSSHForm shows the SSH tunnel options of the connection at index
+func (cm *connectionManager) showSSHForm(title string, conn model.Connection, index int) {
+	port := ""
+	if conn.SSHPort != 0 {
+		port = strconv.Itoa(conn.SSHPort)
+	}
+
+	form := &popup.Form{
+		Name:  "sshForm",
+		Title: title,
+		Fields: []popup.FormField{
+			{Label: "SSH host (empty disables the tunnel)", Value: conn.SSHHost},
+			{Label: "SSH port (default 22)", Value: port},
+			{Label: "SSH user (default: current user)", Value: conn.SSHUser},
+			{Label: "Private key file (empty uses ssh-agent)", Value: conn.SSHKeyFile},
+			{Label: "known_hosts file (default ~/.ssh/known_hosts)", Value: conn.SSHKnownHosts},
+			{Label: "Skip host key check (yes/no)", Value: formatBool(conn.SSHInsecureHostKey)},
+		},
+		OnCancel: cm.focusList,
+	}
+	form.OnSave = func(values []string) {
+		c := conn
+		c.SSHHost = values[0]
+		c.SSHUser = values[2]
+		c.SSHKeyFile = values[3]
+		c.SSHKnownHosts = values[4]
+
+		// Show the form again with the entered values and the problem in the title
+		retry := func(problem string) {
+			c.SSHPort, _ = strconv.Atoi(values[1])
+			c.SSHInsecureHostKey, _ = parseBool(values[5])
+			cm.showSSHForm(retryTitle(title, problem), c, index)
+		}
+
+		c.SSHPort = 0
+		if values[1] != "" {
+			p, err := strconv.Atoi(values[1])
+			if err != nil || p < 1 || p > 65535 {
+				retry("port must be a number between 1 and 65535")
+				return
+			}
+			c.SSHPort = p
+		}
+		var ok bool
+		if c.SSHInsecureHostKey, ok = parseBool(values[5]); !ok {
+			retry("skip host key check must be yes or no")
+			return
+		}
+
+		if c != conn {
+			cm.closeSession(conn.Name)
+		}
+		conns := cm.connections()
+		conns[index] = c
+		cm.save(conns, index)
+	}
+
+	if err := form.Show(cm.g); err != nil {
+		log.Panicln(err)
+	}
+	form.BindKeys(cm.g)
+}
+
+// save writes the connections to the config file and refreshes the list
+func (cm *connectionManager) save(conns []model.Connection, selected int) {
+	defer cm.focusList()
+
+	if err := model.SaveConnections(conns); err != nil {
+		log.Printf("Failed to save connections: %v", err)
+		popup.ShowInfo(cm.g, "Failed to save connections: "+err.Error())
+		return
+	}
+
+	cm.m.LoadedConnections = conns
+	cm.m.Connections = model.ConnectionNames(conns)
+	if selected < 0 {
+		selected = 0
+	}
+	cm.m.SelectedConnectionIndex = selected
+	cm.list.Items = connectionItems(cm.m.Connections)
+	cm.list.Selected = selected
+	cm.list.Update(cm.g)
+}
+
+// Keys returns the actions of the connection keys on the list, which main
+// binds per level. New and Delete are handled by the global N and Del bindings.
+func (cm *connectionManager) Keys() map[rune]func() {
+	return map[rune]func(){
+		'e': cm.Edit,
+		'c': cm.Clone,
+		't': cm.TLS,
+		's': cm.SSH,
+		'i': cm.Diagnose,
+		'x': cm.CloseSession,
+		'K': func() { cm.Move(-1) },
+		'J': func() { cm.Move(1) },
+	}
+}
+
+// connectionItems lists the connections, marking the ones with an open session
+func connectionItems(names []string) []list.Item {
+	items := make([]list.Item, 0, len(names))
+	for _, name := range names {
+		label := "  " + name
+		if db.Lookup(name) != nil {
+			label = "● " + name
+		}
+		items = append(items, list.Item{Label: label, Value: name})
+	}
+	return items
+}
+
+// formatBool shows a boolean form value
+func formatBool(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
+
+// parseBool reads a yes/no form value; empty means no
+func parseBool(s string) (value, ok bool) {
+	switch strings.ToLower(s) {
+	case "yes", "y", "true", "on", "1":
+		return true, true
+	case "no", "n", "false", "off", "0", "":
+		return false, true
+	}
+	return false, false
+}
+
+// indexOf returns the index of the connection with the given name, or -1
+func indexOf(conns []model.Connection, name string) int {
+	for i, c := range conns {
+		if c.Name == name {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/ksiezykm/FerretMate/model"
+)
+
+func TestFormConnectionKeepsTLS(t *testing.T) {
+	conn := model.Connection{
+		Name:          "prod",
+		Host:          "db.example.com",
+		Port:          27017,
+		Username:      "admin",
+		Password:      "old",
+		TLS:           true,
+		TLSCAFile:     "/etc/ssl/ca.pem",
+		TLSCertFile:   "/etc/ssl/client.pem",
+		TLSKeyFile:    "/etc/ssl/client.key",
+		TLSInsecure:   true,
+		TLSServerName: "mongo.internal",
+		AuthMechanism: model.AuthX509,
+	}
+
+	c := formConnection(conn, []string{"prod", "", "db2.example.com", "27018", "admin", "new", "app"})
+
+	want := conn
+	want.Host, want.Port, want.Password, want.Database = "db2.example.com", 27018, "new", "app"
+	if c != want {
+		t.Errorf("formConnection = %+v, want %+v", c, want)
+	}
+}
+
+func TestFormConnectionKeepsSSH(t *testing.T) {
+	conn := model.Connection{
+		Name:               "tunnelled",
+		Host:               "10.0.0.5",
+		Port:               27017,
+		SSHHost:            "bastion.example.com",
+		SSHPort:            2222,
+		SSHUser:            "deploy",
+		SSHKeyFile:         "/home/deploy/.ssh/id_ed25519",
+		SSHKnownHosts:      "/home/deploy/.ssh/known_hosts",
+		SSHInsecureHostKey: true,
+	}
+	values := []string{"tunnelled", "", "10.0.0.5", "27017", "", "", ""}
+
+	// Saving the form unchanged leaves the connection, and its session, alone
+	if c := formConnection(conn, values); c != conn {
+		t.Errorf("formConnection = %+v, want %+v", c, conn)
+	}
+
+	values[2] = "10.0.0.6"
+	c := formConnection(conn, values)
+	want := conn
+	want.Host = "10.0.0.6"
+	if c != want {
+		t.Errorf("formConnection = %+v, want %+v", c, want)
+	}
+}
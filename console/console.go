@@ -0,0 +1,232 @@
+package console
+
+import (
+	"log"
+	"strings"
+
+	"github.com/awesome-gocui/gocui"
+)
+
+// maxCompletions limits the rows of the completion list
+const maxCompletions = 6
+
+// Console is a single-line command input with history and name completion
+type Console struct {
+	Name     string
+	Title    string
+	History  []string                     // earlier commands, oldest first
+	Complete func(prefix string) []string // returns the names starting with prefix
+	OnRun    func(text string)            // callback when Enter is pressed
+	OnClose  func()                       // callback when Esc is pressed
+
+	historyPos int    // position in History while browsing, len(History) when not
+	draft      string // the input before browsing the history
+	matches    []string
+}
+
+func (c *Console) completionName() string { return c.Name + "Completion" }
+
+// Layout draws the input line at row y0 between x0 and x1, with the
+// completion list above it
+func (c *Console) Layout(g *gocui.Gui, x0, y0, x1 int) error {
+	v, err := g.SetView(c.Name, x0, y0, x1, y0+2, 0)
+	if err != nil {
+		if err != gocui.ErrUnknownView {
+			return err
+		}
+		v.Title = c.Title
+		v.Subtitle = " Enter: Run | ↑↓: History | Tab: Complete | PgUp/PgDn: Scroll | ESC: Close "
+		v.Editable = true
+		v.Editor = c
+		v.Wrap = false
+		v.FrameColor = gocui.ColorCyan
+		c.historyPos = len(c.History)
+	}
+
+	if len(c.matches) == 0 {
+		g.DeleteView(c.completionName())
+		return nil
+	}
+	rows := len(c.matches)
+	if rows > maxCompletions {
+		rows = maxCompletions
+	}
+	width := 0
+	for _, m := range c.matches[:rows] {
+		if len(m) > width {
+			width = len(m)
+		}
+	}
+	cv, err := g.SetView(c.completionName(), x0+1, y0-rows-1, x0+width+3, y0, 0)
+	if err != nil && err != gocui.ErrUnknownView {
+		return err
+	}
+	cv.Clear()
+	cv.Write([]byte(strings.Join(c.matches[:rows], "\n")))
+	return nil
+}
+
+// Focus makes the input the current view and shows the cursor
+func (c *Console) Focus(g *gocui.Gui) {
+	g.SetCurrentView(c.Name)
+	g.Cursor = true
+}
+
+// Hide removes the console views
+func (c *Console) Hide(g *gocui.Gui) {
+	g.Cursor = false
+	c.matches = nil
+	g.DeleteView(c.completionName())
+	g.DeleteView(c.Name)
+}
+
+// Text returns the current input
+func (c *Console) Text(g *gocui.Gui) string {
+	v, err := g.View(c.Name)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(strings.ReplaceAll(v.Buffer(), "\n", ""))
+}
+
+// setText replaces the input and puts the cursor at its end
+func (c *Console) setText(v *gocui.View, text string) {
+	v.Clear()
+	v.Write([]byte(text))
+	v.SetOrigin(0, 0)
+	v.SetCursor(len([]rune(text)), 0)
+	c.updateCompletion(text)
+}
+
+// Edit implements gocui.Editor; it updates the completion list while typing
+func (c *Console) Edit(v *gocui.View, key gocui.Key, ch rune, mod gocui.Modifier) {
+	gocui.DefaultEditor.Edit(v, key, ch, mod)
+	c.updateCompletion(strings.ReplaceAll(v.Buffer(), "\n", ""))
+}
+
+// word returns the command name being typed: the first key of the
+// document, or the whole input if it is a bare name
+func word(text string) (prefix string, ok bool) {
+	text = strings.TrimLeft(text, " {")
+	if text == "" || strings.ContainsAny(text, " :,'\"}") {
+		return "", false
+	}
+	return text, true
+}
+
+// updateCompletion lists the names matching the word being typed
+func (c *Console) updateCompletion(text string) {
+	c.matches = nil
+	if prefix, ok := word(text); ok && c.Complete != nil {
+		c.matches = c.Complete(prefix)
+		if len(c.matches) == 1 && c.matches[0] == prefix {
+			c.matches = nil
+		}
+	}
+}
+
+// CompleteWord completes the word being typed to the longest common prefix
+// of the matching names, adding ": " once the name is unique
+func (c *Console) CompleteWord(g *gocui.Gui, v *gocui.View) error {
+	text := strings.ReplaceAll(v.Buffer(), "\n", "")
+	prefix, ok := word(text)
+	if !ok || c.Complete == nil {
+		return nil
+	}
+	matches := c.Complete(prefix)
+	if len(matches) == 0 {
+		return nil
+	}
+
+	completed := matches[0]
+	for _, m := range matches[1:] {
+		completed = commonPrefix(completed, m)
+	}
+	before := text[:len(text)-len(strings.TrimLeft(text, " {"))]
+	if len(matches) == 1 && strings.HasPrefix(before, "{") {
+		completed += ": "
+	}
+	if len(completed) >= len(prefix) {
+		c.setText(v, before+completed)
+	}
+	return nil
+}
+
+// commonPrefix returns the longest common prefix of two names, ignoring case
+func commonPrefix(a, b string) string {
+	n := 0
+	for n < len(a) && n < len(b) && strings.EqualFold(a[n:n+1], b[n:n+1]) {
+		n++
+	}
+	return a[:n]
+}
+
+// HistoryUp shows the previous command of the history
+func (c *Console) HistoryUp(g *gocui.Gui, v *gocui.View) error {
+	if c.historyPos == 0 {
+		return nil
+	}
+	if c.historyPos == len(c.History) {
+		c.draft = strings.ReplaceAll(v.Buffer(), "\n", "")
+	}
+	c.historyPos--
+	c.setText(v, c.History[c.historyPos])
+	return nil
+}
+
+// HistoryDown shows the next command of the history, or the draft after the last one
+func (c *Console) HistoryDown(g *gocui.Gui, v *gocui.View) error {
+	if c.historyPos >= len(c.History) {
+		return nil
+	}
+	c.historyPos++
+	if c.historyPos == len(c.History) {
+		c.setText(v, c.draft)
+	} else {
+		c.setText(v, c.History[c.historyPos])
+	}
+	return nil
+}
+
+// Run passes the input to OnRun and clears it
+func (c *Console) Run(g *gocui.Gui, v *gocui.View) error {
+	text := c.Text(g)
+	if text == "" {
+		return nil
+	}
+	c.setText(v, "")
+	c.matches = nil
+	if c.OnRun != nil {
+		c.OnRun(text)
+	}
+	c.historyPos = len(c.History)
+	c.draft = ""
+	return nil
+}
+
+// Close calls OnClose
+func (c *Console) Close(g *gocui.Gui, v *gocui.View) error {
+	if c.OnClose != nil {
+		c.OnClose()
+	}
+	return nil
+}
+
+// BindKeys registers the keys of the console
+func (c *Console) BindKeys(g *gocui.Gui) {
+	bindings := []struct {
+		key     gocui.Key
+		handler func(*gocui.Gui, *gocui.View) error
+	}{
+		{gocui.KeyEnter, c.Run},
+		{gocui.KeyArrowUp, c.HistoryUp},
+		{gocui.KeyArrowDown, c.HistoryDown},
+		{gocui.KeyTab, c.CompleteWord},
+		{gocui.KeyEsc, c.Close},
+	}
+	for _, b := range bindings {
+		if err := g.SetKeybinding(c.Name, b.key, gocui.ModNone, b.handler); err != nil {
+			log.Panicln(err)
+		}
+	}
+}
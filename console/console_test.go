@@ -0,0 +1,60 @@
+package console
+
+import (
+	"testing"
+
+	"github.com/awesome-gocui/gocui"
+)
+
+// TestDeleteEditsInput checks that Delete typed in the console deletes the
+// character under the cursor and does not reach the Delete binding of the
+// list, which asks to drop the database under the cursor
+func TestDeleteEditsInput(t *testing.T) {
+	g, err := gocui.NewGui(gocui.OutputSimulator, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+
+	c := &Console{Name: "console", Complete: func(string) []string { return nil }}
+	g.SetManagerFunc(func(g *gocui.Gui) error {
+		maxX, maxY := g.Size()
+		if _, err := g.SetView("listView", 0, 0, maxX/2-1, maxY-1, 0); err != nil && err != gocui.ErrUnknownView {
+			return err
+		}
+		if err := c.Layout(g, maxX/2, maxY-5, maxX-1); err != nil {
+			return err
+		}
+		if g.CurrentView() == nil {
+			c.Focus(g)
+		}
+		return nil
+	})
+	c.BindKeys(g)
+
+	deleted := false
+	if err := g.SetKeybinding("listView", gocui.KeyDelete, gocui.ModNone, func(g *gocui.Gui, v *gocui.View) error {
+		deleted = true
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	screen := g.GetTestingScreen()
+	cleanup := screen.StartGui()
+	defer cleanup()
+
+	screen.SendStringAsKeys("ping")
+	screen.WaitSync()
+	for range "ping" {
+		screen.SendKeySync(gocui.KeyArrowLeft)
+	}
+	screen.SendKeySync(gocui.KeyDelete)
+
+	if deleted {
+		t.Error("Delete in the console reached the list binding")
+	}
+	if got := c.Text(g); got != "ing" {
+		t.Errorf("console text = %q, want %q", got, "ing")
+	}
+}
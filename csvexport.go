@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"log"
+	"strings"
+
+	"github.com/ksiezykm/FerretMate/db"
+	"github.com/ksiezykm/FerretMate/model"
+	"github.com/ksiezykm/FerretMate/popup"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// csvSampleSize is the number of documents read to discover the columns
+const csvSampleSize = 1000
+
+// tableFormats are the spreadsheet layouts offered after exportFormats
+var tableFormats = []struct {
+	label string
+	comma rune
+	ext   string
+}{
+	{"CSV (.csv)", ',', ".csv"},
+	{"TSV (.tsv)", '\t', ".tsv"},
+}
+
+// csvExporter exports a collection or query result as CSV or TSV: it samples
+// the documents for their fields, lets the columns be picked and ordered and
+// then exports as a background job
+type csvExporter struct {
+	level
+	jobs *jobsPanel
+}
+
+// Open samples the documents of a collection matching the query and asks
+// for the columns of table format i
+func (ce *csvExporter) Open(dbName, collName string, query model.Query, i int) {
+	client := ce.sessionClient()
+	if client == nil {
+		return
+	}
+
+	var sample db.FieldSample
+	popup.ShowTask(ce.g, "Export as "+tableFormats[i].label, "Sampling the fields of the documents...", func(ctx context.Context) error {
+		var err error
+		sample, err = db.SampleFields(ctx, client, dbName, collName, query, csvSampleSize)
+		return err
+	}, func(err error) {
+		switch {
+		case err != nil:
+			popup.ShowInfo(ce.g, "Failed to sample fields: "+err.Error())
+			log.Printf("Failed to sample fields: %v", err)
+		case len(sample.Fields) == 0:
+			popup.ShowInfo(ce.g, "No documents to export")
+		default:
+			ce.showForm("Columns of "+dbName+"."+collName, []string{strings.Join(sample.Fields, ", "), "join", ";"},
+				func(columns []string, indexed bool, separator string) {
+					if indexed {
+						columns = db.IndexColumns(columns, sample.ArrayLengths)
+					}
+					ce.export(client, dbName, collName, query, i, db.CSVOptions{Columns: columns, Separator: separator})
+				})
+		}
+	})
+}
+
+// showForm asks for the columns, in order, and how arrays are written
+func (ce *csvExporter) showForm(title string, values []string, onSave func(columns []string, indexed bool, separator string)) {
+	form := &popup.Form{
+		Name:  "csvForm",
+		Title: title,
+		Fields: []popup.FormField{
+			{Label: "Columns, in order (dotted paths, comma separated; remove or reorder as needed)", Value: values[0]},
+			{Label: "Arrays: join (one cell) or index (one column per element)", Value: values[1]},
+			{Label: "Join separator", Value: values[2]},
+		},
+		OnCancel: ce.focusList,
+	}
+	form.OnSave = func(values []string) {
+		retry := func(problem string) {
+			ce.showForm(retryTitle(title, problem), values, onSave)
+		}
+
+		var columns []string
+		for _, column := range strings.Split(values[0], ",") {
+			if column = strings.TrimSpace(column); column != "" {
+				columns = append(columns, column)
+			}
+		}
+		if len(columns) == 0 {
+			retry("at least one column is required")
+			return
+		}
+		mode := strings.ToLower(strings.TrimSpace(values[1]))
+		if mode != "join" && mode != "index" {
+			retry("arrays must be join or index")
+			return
+		}
+		onSave(columns, mode == "index", values[2])
+	}
+
+	if err := form.Show(ce.g); err != nil {
+		log.Panicln(err)
+	}
+	form.BindKeys(ce.g)
+}
+
+// export writes the file below ./exports/<db> as a background job
+func (ce *csvExporter) export(client *mongo.Client, dbName, collName string, query model.Query, i int, opts db.CSVOptions) {
+	opts.Comma, opts.Query = tableFormats[i].comma, query
+	exportPath := "./exports/" + dbName + "/" + exportName(collName, query) + tableFormats[i].ext
+	ce.jobs.Start("Export "+dbName+"."+collName+" to "+exportPath, func(ctx context.Context, progress func(done, total int64)) error {
+		_, err := db.ExportCSV(ctx, client, dbName, collName, exportPath, opts, progress)
+		return err
+	}, nil)
+}
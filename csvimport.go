@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ksiezykm/FerretMate/db"
+	"github.com/ksiezykm/FerretMate/notepad"
+	"github.com/ksiezykm/FerretMate/popup"
+)
+
+// csvPreviewShown is the number of sample values shown per column
+const csvPreviewShown = 3
+
+// importModes are the accepted answers for rows whose _id exists, by name
+var importModes = map[string]db.ImportMode{
+	"insert": db.ImportInsert,
+	"upsert": db.ImportUpsert,
+	"skip":   db.ImportSkip,
+}
+
+// isTableFile reports whether a file is imported as CSV or TSV rather than JSON
+func isTableFile(filePath string) bool {
+	ext := strings.ToLower(filepath.Ext(filePath))
+	return ext == ".csv" || ext == ".tsv"
+}
+
+// csvImporter imports a CSV or TSV file into a collection: it previews the
+// file with the inferred column types, asks for the mapping of the columns
+// to fields and then imports as a background job
+type csvImporter struct {
+	level
+	note  *notepad.Notepad
+	jobs  *jobsPanel
+	stats *statsPanel
+
+	// onDone is called after an import into dbName.collName succeeded
+	onDone func(dbName, collName string)
+}
+
+// Open previews a CSV or TSV file and asks how to import it into dbName.collName
+func (ci *csvImporter) Open(dbName, collName, filePath string) {
+	comma := ','
+	if strings.EqualFold(filepath.Ext(filePath), ".tsv") {
+		comma = '\t'
+	}
+	preview, err := db.PreviewCSV(filePath, comma)
+	if err != nil {
+		popup.ShowInfo(ci.g, "Failed to preview file: "+err.Error())
+		log.Printf("Failed to preview %s: %v", filePath, err)
+		return
+	}
+	if len(preview.Columns) == 0 {
+		popup.ShowInfo(ci.g, "The file has no columns")
+		return
+	}
+
+	if v, err := ci.g.View(ci.note.Name); err == nil {
+		v.Title = "Import " + filepath.Base(filePath) + " into " + dbName + "." + collName
+		v.SetOrigin(0, 0)
+		v.SetCursor(0, 0)
+	}
+	ci.note.Editable = false
+	ci.note.Update(ci.g, previewText(preview))
+
+	imp := &csvImport{dbName: dbName, collName: collName, filePath: filePath, comma: comma, columns: preview.Columns}
+	ci.showMapping(imp)
+}
+
+// csvImport is an import being set up
+type csvImport struct {
+	dbName, collName string
+	filePath         string
+	comma            rune
+	columns          []db.CSVColumn
+}
+
+// previewText lists the columns with their inferred types and sample values
+func previewText(preview db.CSVPreview) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d columns, types inferred from the first %d rows\n\n", len(preview.Columns), len(preview.Rows))
+	for i, column := range preview.Columns {
+		var samples []string
+		for _, row := range preview.Rows {
+			if len(samples) == csvPreviewShown {
+				break
+			}
+			if i < len(row) && strings.TrimSpace(row[i]) != "" {
+				samples = append(samples, row[i])
+			}
+		}
+		fmt.Fprintf(&b, "%3d. %-24s %-9s %s\n", i+1, column.Header, column.Type, strings.Join(samples, " | "))
+	}
+	b.WriteString("\nPick a column to change its target path or type; an empty path skips it.\n")
+	b.WriteString("Dotted paths build nested documents. Empty cells are left out.\n")
+	return b.String()
+}
+
+// showMapping lists the columns with their target path and type; picking a
+// column edits it, the last entry goes on to the import
+func (ci *csvImporter) showMapping(imp *csvImport) {
+	width := 0
+	for _, column := range imp.columns {
+		width = max(width, len([]rune(column.Header)))
+	}
+	options := make([]string, 0, len(imp.columns)+1)
+	for _, column := range imp.columns {
+		target := "(skipped)"
+		if column.Path != "" {
+			target = column.Path + " : " + column.Type.String()
+		}
+		options = append(options, fmt.Sprintf("%-*s -> %s", width, column.Header, target))
+	}
+	options = append(options, "Import...")
+
+	popup.ShowChoice(ci.g, "Map the columns of "+filepath.Base(imp.filePath), options, func(i int) {
+		if i == len(imp.columns) {
+			ci.showModeForm("Import into "+imp.dbName+"."+imp.collName, "insert", imp)
+			return
+		}
+		column := imp.columns[i]
+		ci.showColumnForm("Column "+column.Header, []string{column.Path, column.Type.String()}, imp, i)
+	}, ci.focusList)
+}
+
+// showColumnForm asks for the target path and the type of column i
+func (ci *csvImporter) showColumnForm(title string, values []string, imp *csvImport, i int) {
+	form := &popup.Form{
+		Name:  "csvColumnForm",
+		Title: title,
+		Fields: []popup.FormField{
+			{Label: "Target path (dotted paths build nested documents; empty skips the column)", Value: values[0]},
+			{Label: "Type: string, int, long, double, bool, date or objectId", Value: values[1]},
+		},
+		OnCancel: func() { ci.showMapping(imp) },
+	}
+	form.OnSave = func(values []string) {
+		retry := func(problem string) {
+			ci.showColumnForm(retryTitle(title, problem), values, imp, i)
+		}
+
+		path := strings.TrimSpace(values[0])
+		t, ok := db.ParseColumnType(values[1])
+		switch {
+		case path != "" && (strings.HasPrefix(path, ".") || strings.HasSuffix(path, ".") || strings.Contains(path, "..")):
+			retry("invalid path")
+			return
+		case !ok:
+			retry("unknown type " + strings.TrimSpace(values[1]))
+			return
+		}
+		imp.columns[i].Path, imp.columns[i].Type = path, t
+		ci.showMapping(imp)
+	}
+
+	if err := form.Show(ci.g); err != nil {
+		log.Panicln(err)
+	}
+	form.BindKeys(ci.g)
+}
+
+// showModeForm asks what to do with existing _ids and starts the import
+func (ci *csvImporter) showModeForm(title, value string, imp *csvImport) {
+	form := &popup.Form{
+		Name:  "csvImportForm",
+		Title: title,
+		Fields: []popup.FormField{
+			{Label: "Existing _id: insert (report the row), upsert or skip", Value: value},
+		},
+		OnCancel: func() { ci.showMapping(imp) },
+	}
+	form.OnSave = func(values []string) {
+		mapped := false
+		for _, column := range imp.columns {
+			mapped = mapped || column.Path != ""
+		}
+		mode, ok := importModes[strings.ToLower(strings.TrimSpace(values[0]))]
+		switch {
+		case !mapped:
+			ci.showModeForm(retryTitle(title, "at least one column must be mapped"), values[0], imp)
+			return
+		case !ok:
+			ci.showModeForm(retryTitle(title, "existing _id must be insert, upsert or skip"), values[0], imp)
+			return
+		}
+		ci.importFile(imp.dbName, imp.collName, imp.filePath, imp.comma, imp.columns, mode)
+	}
+
+	if err := form.Show(ci.g); err != nil {
+		log.Panicln(err)
+	}
+	form.BindKeys(ci.g)
+}
+
+// importFile runs the import as a background job; failed rows are reported
+// next to the file
+func (ci *csvImporter) importFile(dbName, collName, filePath string, comma rune, columns []db.CSVColumn, mode db.ImportMode) {
+	client := ci.sessionClient()
+	if client == nil {
+		return
+	}
+	conn := ci.m.SelectedConnection
+	ci.focusList()
+
+	reportPath := strings.TrimSuffix(filePath, filepath.Ext(filePath)) + "-errors-" + time.Now().Format("20060102-150405") + ".csv"
+	var result db.ImportResult
+	ci.jobs.Start("Import "+filepath.Base(filePath)+" to "+dbName+"."+collName, func(ctx context.Context, progress func(done, total int64)) error {
+		var err error
+		result, err = db.ImportCSV(ctx, client, dbName, collName, filePath, comma, columns, mode, reportPath, progress)
+		return err
+	}, func(err error) {
+		ci.stats.Forget(conn, dbName)
+		if err != nil {
+			return
+		}
+		summary := fmt.Sprintf("Imported into %s.%s: %d inserted, %d replaced, %d skipped, %d failed",
+			dbName, collName, result.Inserted, result.Replaced, result.Skipped, result.Failed)
+		if result.Report != "" {
+			summary += " (see " + result.Report + ")"
+		}
+		popup.ShowToast(ci.g, summary)
+		if ci.onDone != nil {
+			ci.onDone(dbName, collName)
+		}
+	})
+}
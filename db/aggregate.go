@@ -0,0 +1,93 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ksiezykm/FerretMate/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ParseStage parses one aggregation stage in mongo-shell syntax, e.g.
+// {$match: {status: 'active'}}. A stage has exactly one $-prefixed key.
+func ParseStage(text string) (bson.D, error) {
+	stage, err := ParseShellDocument(text)
+	if err != nil {
+		return nil, err
+	}
+	if len(stage) != 1 || !strings.HasPrefix(stage[0].Key, "$") {
+		return nil, fmt.Errorf("a stage must have exactly one operator, e.g. {$match: {...}}")
+	}
+	return stage, nil
+}
+
+// BuildPipeline parses the enabled stages up to and including stage last
+func BuildPipeline(stages []model.Stage, last int) (bson.A, error) {
+	pipeline := bson.A{}
+	for i, s := range stages {
+		if i > last {
+			break
+		}
+		if s.Disabled {
+			continue
+		}
+		stage, err := ParseStage(s.Text)
+		if err != nil {
+			return nil, fmt.Errorf("stage %d: %w", i+1, err)
+		}
+		pipeline = append(pipeline, stage)
+	}
+	return pipeline, nil
+}
+
+// PreviewPipeline runs a pipeline and returns its first limit documents as Extended JSON
+func PreviewPipeline(ctx context.Context, client *mongo.Client, dbName, collName string, pipeline bson.A, limit int) ([]string, error) {
+	limited := append(bson.A{}, pipeline...)
+	limited = append(limited, bson.D{{Key: "$limit", Value: limit}})
+
+	cursor, err := client.Database(dbName).Collection(collName).Aggregate(ctx, limited)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var docs []string
+	for cursor.Next(ctx) {
+		doc, err := FormatDocument(cursor.Current)
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, doc)
+	}
+	return docs, cursor.Err()
+}
+
+// ExportPipeline writes the enabled stages as a JSON array of relaxed Extended JSON stages
+func ExportPipeline(stages []model.Stage, filePath string) error {
+	pipeline, err := BuildPipeline(stages, len(stages)-1)
+	if err != nil {
+		return err
+	}
+
+	parts := make([]string, 0, len(pipeline))
+	for _, stage := range pipeline {
+		out, err := bson.MarshalExtJSONIndent(stage, false, false, "  ", "  ")
+		if err != nil {
+			return err
+		}
+		parts = append(parts, "  "+string(out))
+	}
+	content := "[\n" + strings.Join(parts, ",\n") + "\n]\n"
+	if len(parts) == 0 {
+		content = "[]\n"
+	}
+
+	if err := createDirIfNotExists(filepath.Dir(filePath)); err != nil {
+		return err
+	}
+	return os.WriteFile(filePath, []byte(content), 0644)
+}
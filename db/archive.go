@@ -0,0 +1,451 @@
+package db
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"hash/crc64"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// The mongodump --archive format: a magic number, a header document, the
+// metadata of every collection and a terminator (the prelude), followed by
+// blocks of a namespace header, documents of that namespace and a
+// terminator. A block whose header has EOF set ends a namespace and carries
+// the CRC-64 of all its documents.
+const (
+	archiveMagic      = 0x8199e26d
+	archiveTerminator = 0xffffffff
+	archiveVersion    = "0.1"
+)
+
+// archiveCRC is the checksum table mongodump uses for the EOF headers
+var archiveCRC = crc64.MakeTable(crc64.ECMA)
+
+// archiveHeader is the document following the magic number
+type archiveHeader struct {
+	ConcurrentCollections int32  `bson:"concurrent_collections"`
+	Version               string `bson:"version"`
+	ServerVersion         string `bson:"server_version"`
+	ToolVersion           string `bson:"tool_version"`
+}
+
+// archiveCollection is the prelude entry of a collection; Metadata holds
+// what a dump directory has in <coll>.metadata.json
+type archiveCollection struct {
+	DB         string `bson:"db"`
+	Collection string `bson:"collection"`
+	Metadata   string `bson:"metadata"`
+	Size       int64  `bson:"size"`
+	Type       string `bson:"type"`
+}
+
+// archiveNamespace is the header of a block
+type archiveNamespace struct {
+	DB         string `bson:"db"`
+	Collection string `bson:"collection"`
+	EOF        bool   `bson:"EOF"`
+	CRC        int64  `bson:"CRC"`
+}
+
+// dumpArchive writes the collections of a database to the single archive
+// file path (path.gz with compress)
+func dumpArchive(ctx context.Context, database *mongo.Database, specs []*mongo.CollectionSpecification, path string, compress bool, written func(done int64)) error {
+	if err := createDirIfNotExists(filepath.Dir(path)); err != nil {
+		return err
+	}
+	out, err := createDumpFile(path, compress)
+	if err != nil {
+		return err
+	}
+	defer out.file.Close()
+	archive := archiveWriter{out}
+
+	header := archiveHeader{ConcurrentCollections: 1, Version: archiveVersion, ServerVersion: serverVersion(ctx, database.Client()), ToolVersion: "FerretMate"}
+	collections := make([]archiveCollection, 0, len(specs))
+	for _, spec := range specs {
+		metaJSON, err := dumpMetadata(ctx, database, spec)
+		if err != nil {
+			return fmt.Errorf("%s: %w", spec.Name, err)
+		}
+		collections = append(collections, archiveCollection{DB: database.Name(), Collection: spec.Name, Metadata: string(metaJSON), Type: spec.Type})
+	}
+	if err := archive.writePrelude(header, collections); err != nil {
+		return err
+	}
+
+	var done int64
+	for _, spec := range specs {
+		if spec.Type == "view" {
+			continue
+		}
+		count, err := archive.writeNamespace(database.Name(), spec.Name, func(out io.Writer) (int64, error) {
+			return dumpDocuments(ctx, database.Collection(spec.Name), out, func(n int64) {
+				written(done + n)
+			})
+		})
+		done += count
+		if err != nil {
+			return fmt.Errorf("%s: %w", spec.Name, err)
+		}
+	}
+	return out.Close()
+}
+
+// archiveWriter writes the parts of an archive
+type archiveWriter struct {
+	w io.Writer
+}
+
+// writeDocument writes a document of the prelude or a namespace header
+func (a archiveWriter) writeDocument(v interface{}) error {
+	raw, err := bson.Marshal(v)
+	if err == nil {
+		_, err = a.w.Write(raw)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write to file: %w", err)
+	}
+	return nil
+}
+
+// writeUint32 writes the magic number or a terminator
+func (a archiveWriter) writeUint32(n uint32) error {
+	if err := binary.Write(a.w, binary.LittleEndian, n); err != nil {
+		return fmt.Errorf("failed to write to file: %w", err)
+	}
+	return nil
+}
+
+// writePrelude writes the magic number, the header and the collections
+func (a archiveWriter) writePrelude(header archiveHeader, collections []archiveCollection) error {
+	if err := a.writeUint32(archiveMagic); err != nil {
+		return err
+	}
+	if err := a.writeDocument(header); err != nil {
+		return err
+	}
+	for _, c := range collections {
+		if err := a.writeDocument(c); err != nil {
+			return err
+		}
+	}
+	return a.writeUint32(archiveTerminator)
+}
+
+// writeNamespace writes a block with the documents that write writes, if
+// any, and the EOF block of the namespace. It returns what write returns.
+func (a archiveWriter) writeNamespace(dbName, collName string, write func(out io.Writer) (int64, error)) (int64, error) {
+	ns := archiveNamespace{DB: dbName, Collection: collName}
+	block := &archiveBlock{w: a.w, header: ns, crc: crc64.New(archiveCRC)}
+	count, err := write(block)
+	if err == nil && block.started {
+		err = a.writeUint32(archiveTerminator)
+	}
+	if err != nil {
+		return count, err
+	}
+
+	ns.EOF, ns.CRC = true, int64(block.crc.Sum64())
+	if err := a.writeDocument(ns); err != nil {
+		return count, err
+	}
+	return count, a.writeUint32(archiveTerminator)
+}
+
+// archiveBlock writes the documents of one namespace, preceded by its
+// header once there is a document
+type archiveBlock struct {
+	w       io.Writer
+	header  archiveNamespace
+	crc     hash.Hash64
+	started bool
+}
+
+// Write writes one document
+func (b *archiveBlock) Write(doc []byte) (int, error) {
+	if !b.started {
+		raw, err := bson.Marshal(b.header)
+		if err != nil {
+			return 0, err
+		}
+		if _, err := b.w.Write(raw); err != nil {
+			return 0, err
+		}
+		b.started = true
+	}
+	b.crc.Write(doc)
+	return b.w.Write(doc)
+}
+
+// serverVersion returns the version of the server, for the archive header
+func serverVersion(ctx context.Context, client *mongo.Client) string {
+	var info struct {
+		Version string `bson:"version"`
+	}
+	if err := client.Database("admin").RunCommand(ctx, bson.D{{Key: "buildInfo", Value: 1}}).Decode(&info); err != nil || info.Version == "" {
+		return "0.0.0"
+	}
+	return info.Version
+}
+
+// openArchive opens an archive, gzipped or not, and reads its prelude
+func openArchive(path string) (*dumpReader, []archiveCollection, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	r := &dumpReader{Reader: bufio.NewReader(file), file: file}
+
+	// mongorestore --gzip takes any file name, so look at the content
+	if head, err := r.Peek(2); err == nil && head[0] == 0x1f && head[1] == 0x8b {
+		zipped, err := gzip.NewReader(r.Reader)
+		if err != nil {
+			file.Close()
+			return nil, nil, fmt.Errorf("failed to read %s: %w", filepath.Base(path), err)
+		}
+		r.Reader = bufio.NewReader(zipped)
+	}
+
+	collections, err := readArchivePrelude(r.Reader)
+	if err != nil {
+		file.Close()
+		return nil, nil, fmt.Errorf("%s: %w", filepath.Base(path), err)
+	}
+	return r, collections, nil
+}
+
+// readArchivePrelude checks the magic number and reads the header and the
+// collections of an archive
+func readArchivePrelude(r *bufio.Reader) ([]archiveCollection, error) {
+	var magic uint32
+	if err := binary.Read(r, binary.LittleEndian, &magic); err != nil || magic != archiveMagic {
+		return nil, fmt.Errorf("not a mongodump archive")
+	}
+	raw, err := readBSON(r)
+	if err != nil {
+		return nil, fmt.Errorf("invalid archive header: %w", err)
+	}
+	var header archiveHeader
+	if err := bson.Unmarshal(raw, &header); err != nil {
+		return nil, fmt.Errorf("invalid archive header: %w", err)
+	}
+
+	var collections []archiveCollection
+	for {
+		raw, err := readArchiveBSON(r)
+		if err != nil {
+			return nil, fmt.Errorf("invalid archive prelude: %w", err)
+		}
+		if raw == nil {
+			return collections, nil
+		}
+		var c archiveCollection
+		if err := bson.Unmarshal(raw, &c); err != nil {
+			return nil, fmt.Errorf("invalid archive prelude: %w", err)
+		}
+		collections = append(collections, c)
+	}
+}
+
+// readArchiveBSON reads the next document of an archive, or nil at a terminator
+func readArchiveBSON(r *bufio.Reader) (bson.Raw, error) {
+	if size, err := r.Peek(4); err == nil && binary.LittleEndian.Uint32(size) == archiveTerminator {
+		_, err := r.Discard(4)
+		return nil, err
+	}
+	return readBSON(r)
+}
+
+// eachArchiveDocument reads the blocks of an archive after its prelude,
+// calling doc for every document and eof at the end of every namespace,
+// whose checksum it verifies
+func eachArchiveDocument(r *bufio.Reader, doc func(ns archiveNamespace, raw bson.Raw) error, eof func(ns archiveNamespace) error) error {
+	crcs := map[archiveNamespace]hash.Hash64{}
+	for {
+		raw, err := readArchiveBSON(r)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("invalid namespace header: %w", err)
+		}
+		if raw == nil {
+			return fmt.Errorf("archive block without a namespace header")
+		}
+		var ns archiveNamespace
+		if err := bson.Unmarshal(raw, &ns); err != nil {
+			return fmt.Errorf("invalid namespace header: %w", err)
+		}
+		key := archiveNamespace{DB: ns.DB, Collection: ns.Collection}
+		if crcs[key] == nil {
+			crcs[key] = crc64.New(archiveCRC)
+		}
+
+		for {
+			raw, err := readArchiveBSON(r)
+			if err == io.EOF {
+				return fmt.Errorf("truncated archive in %s.%s", ns.DB, ns.Collection)
+			}
+			if err != nil {
+				return fmt.Errorf("%s.%s: %w", ns.DB, ns.Collection, err)
+			}
+			if raw == nil {
+				break
+			}
+			crcs[key].Write(raw)
+			if err := doc(ns, raw); err != nil {
+				return err
+			}
+		}
+
+		if ns.EOF {
+			if ns.CRC != int64(crcs[key].Sum64()) {
+				return fmt.Errorf("checksum mismatch in %s.%s", ns.DB, ns.Collection)
+			}
+			if eof != nil {
+				if err := eof(ns); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+// archiveDatabase returns the database and the collections of a single
+// database archive, without the system collections, sorted by name
+func archiveDatabase(entries []archiveCollection) (string, []dumpedCollection, error) {
+	databases := map[string]bool{}
+	var collections []dumpedCollection
+	for _, e := range entries {
+		databases[e.DB] = true
+		if strings.HasPrefix(e.Collection, "system.") {
+			continue
+		}
+		c := dumpedCollection{name: e.Collection}
+		if e.Metadata != "" {
+			if err := bson.UnmarshalExtJSON([]byte(e.Metadata), false, &c.metadata); err != nil {
+				return "", nil, fmt.Errorf("invalid metadata of %s: %w", e.Collection, err)
+			}
+		}
+		collections = append(collections, c)
+	}
+
+	names := make([]string, 0, len(databases))
+	for name := range databases {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	switch len(names) {
+	case 0:
+		return "", nil, fmt.Errorf("the archive holds no collections")
+	case 1:
+	default:
+		return "", nil, fmt.Errorf("the archive holds several databases (%s); dump one database at a time", strings.Join(names, ", "))
+	}
+	sort.Slice(collections, func(i, j int) bool { return collections[i].name < collections[j].name })
+	return names[0], collections, nil
+}
+
+// restoreArchive restores a mongodump --archive file into database
+func restoreArchive(ctx context.Context, database *mongo.Database, path string, progress func(done, total int64)) (RestoreResult, error) {
+	var result RestoreResult
+
+	// A first pass counts the documents and verifies the archive before
+	// anything is written
+	r, entries, err := openArchive(path)
+	if err != nil {
+		return result, err
+	}
+	var total int64
+	err = eachArchiveDocument(r.Reader, func(ns archiveNamespace, raw bson.Raw) error {
+		total++
+		return nil
+	}, nil)
+	r.Close()
+	if err != nil {
+		return result, err
+	}
+	source, collections, err := archiveDatabase(entries)
+	if err != nil {
+		return result, err
+	}
+
+	create, err := collectionCreator(ctx, database)
+	if err != nil {
+		return result, err
+	}
+	indexes := make(map[string][]bson.D, len(collections))
+	for _, c := range collections {
+		meta, err := create(c.name, c.metadata)
+		if err != nil {
+			return result, err
+		}
+		indexes[c.name] = meta.Indexes
+	}
+
+	r, _, err = openArchive(path)
+	if err != nil {
+		return result, err
+	}
+	defer r.Close()
+
+	// The blocks of several collections may be interleaved
+	batches := make(map[string][]interface{})
+	var done int64
+	flush := func(name string) error {
+		batch := batches[name]
+		if len(batch) == 0 {
+			return nil
+		}
+		inserted, duplicates, err := insertUnordered(ctx, database.Collection(name), batch)
+		result.Inserted += inserted
+		result.Duplicates += duplicates
+		done += inserted + duplicates
+		batches[name] = batch[:0]
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		progress(done, total)
+		return nil
+	}
+	err = eachArchiveDocument(r.Reader, func(ns archiveNamespace, raw bson.Raw) error {
+		if ns.DB != source || strings.HasPrefix(ns.Collection, "system.") {
+			return nil
+		}
+		if _, ok := indexes[ns.Collection]; !ok {
+			return fmt.Errorf("documents of %s are not in the archive prelude", ns.Collection)
+		}
+		batches[ns.Collection] = append(batches[ns.Collection], raw)
+		if len(batches[ns.Collection]) == uploadBatchSize {
+			return flush(ns.Collection)
+		}
+		return nil
+	}, func(ns archiveNamespace) error {
+		return flush(ns.Collection)
+	})
+	if err != nil {
+		return result, err
+	}
+
+	for _, c := range collections {
+		if err := flush(c.name); err != nil {
+			return result, err
+		}
+		if err := restoreIndexes(ctx, database, c.name, indexes[c.name]); err != nil {
+			return result, fmt.Errorf("%s: %w", c.name, err)
+		}
+		result.Collections++
+	}
+	return result, nil
+}
@@ -0,0 +1,64 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// CommandNames are offered for completion in the command console
+var CommandNames = []string{
+	"aggregate", "buildInfo", "collMod", "collStats", "compact", "connectionStatus",
+	"count", "create", "createIndexes", "createUser", "currentOp", "dataSize",
+	"dbHash", "dbStats", "delete", "distinct", "drop", "dropDatabase", "dropIndexes",
+	"dropUser", "explain", "find", "findAndModify", "getCmdLineOpts", "getLog",
+	"getMore", "getParameter", "grantRolesToUser", "hello", "hostInfo", "insert",
+	"isMaster", "killCursors", "killOp", "listCollections", "listCommands",
+	"listDatabases", "listIndexes", "logRotate", "ping", "profile", "reIndex",
+	"renameCollection", "replSetGetConfig", "replSetGetStatus", "revokeRolesFromUser",
+	"rolesInfo", "serverStatus", "setParameter", "shutdown", "top", "update",
+	"updateUser", "usersInfo", "validate", "whatsmyuri",
+}
+
+// CompleteCommand returns the command names starting with prefix (case-insensitive), sorted
+func CompleteCommand(prefix string) []string {
+	prefix = strings.ToLower(prefix)
+	var matches []string
+	for _, name := range CommandNames {
+		if strings.HasPrefix(strings.ToLower(name), prefix) {
+			matches = append(matches, name)
+		}
+	}
+	sort.Strings(matches)
+	return matches
+}
+
+// ParseCommand parses a command in mongo-shell syntax, e.g. {serverStatus: 1}.
+// A bare command name is run with the value 1.
+func ParseCommand(text string) (bson.D, error) {
+	text = strings.TrimSpace(text)
+	if text != "" && !strings.HasPrefix(text, "{") && !strings.ContainsAny(text, " :,") {
+		return bson.D{{Key: text, Value: 1}}, nil
+	}
+	cmd, err := ParseShellDocument(text)
+	if err != nil {
+		return nil, err
+	}
+	if len(cmd) == 0 {
+		return nil, fmt.Errorf("empty command")
+	}
+	return cmd, nil
+}
+
+// RunCommand runs a command against a database and returns the reply as Extended JSON
+func RunCommand(ctx context.Context, client *mongo.Client, dbName string, cmd bson.D) (string, error) {
+	raw, err := client.Database(dbName).RunCommand(ctx, cmd).Raw()
+	if err != nil {
+		return "", err
+	}
+	return FormatDocument(raw)
+}
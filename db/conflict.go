@@ -0,0 +1,128 @@
+package db
+
+import (
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// ConflictError is returned by UpdateDocument when the stored document no longer
+// matches the snapshot taken when it was opened
+type ConflictError struct {
+	Theirs  string // current stored version as Extended JSON ("" if deleted)
+	Deleted bool   // true if the document was deleted in the meantime
+}
+
+func (e *ConflictError) Error() string {
+	if e.Deleted {
+		return "document was deleted by someone else since it was opened"
+	}
+	return "document was modified by someone else since it was opened"
+}
+
+// snapshotFilter matches the document only while it equals the snapshot as a
+// whole, so a field added, removed or changed in between fails the match.
+// $literal keeps values starting with $ from being read as field paths.
+func snapshotFilter(snapshot bson.D) bson.D {
+	filter := bson.D{}
+	if id, ok := documentID(snapshot); ok {
+		// Lets the server find the document by its index first
+		filter = append(filter, bson.E{Key: "_id", Value: bson.D{{Key: "$eq", Value: id}}})
+	}
+	return append(filter, bson.E{Key: "$expr", Value: bson.D{{Key: "$eq", Value: bson.A{
+		"$$ROOT",
+		bson.D{{Key: "$literal", Value: snapshot}},
+	}}}})
+}
+
+// MergeDocuments does a three-way merge of top-level fields. A field changed only
+// on one side takes that side's value; fields changed on both sides differently are
+// conflicts, which keep mine and are returned by name.
+func MergeDocuments(base, mine, theirs string) (string, []string, error) {
+	baseDoc, err := ParseDocument(base)
+	if err != nil {
+		return "", nil, err
+	}
+	mineDoc, err := ParseDocument(mine)
+	if err != nil {
+		return "", nil, err
+	}
+	theirsDoc := bson.D{}
+	if theirs != "" {
+		if theirsDoc, err = ParseDocument(theirs); err != nil {
+			return "", nil, err
+		}
+	}
+
+	// Field order follows theirs, followed by fields only present in mine
+	keys := make([]string, 0, len(theirsDoc)+len(mineDoc))
+	seen := make(map[string]bool)
+	for _, doc := range []bson.D{theirsDoc, mineDoc} {
+		for _, e := range doc {
+			if !seen[e.Key] {
+				seen[e.Key] = true
+				keys = append(keys, e.Key)
+			}
+		}
+	}
+	for _, e := range baseDoc {
+		if !seen[e.Key] {
+			seen[e.Key] = true
+			keys = append(keys, e.Key)
+		}
+	}
+
+	merged := bson.D{}
+	var conflicts []string
+	for _, key := range keys {
+		b, inBase := field(baseDoc, key)
+		mv, inMine := field(mineDoc, key)
+		tv, inTheirs := field(theirsDoc, key)
+
+		mineChanged := inMine != inBase || (inMine && !sameValue(mv, b))
+		theirsChanged := inTheirs != inBase || (inTheirs && !sameValue(tv, b))
+
+		switch {
+		case !mineChanged:
+			if inTheirs {
+				merged = append(merged, bson.E{Key: key, Value: tv})
+			}
+		case !theirsChanged || (inMine == inTheirs && (!inMine || sameValue(mv, tv))):
+			if inMine {
+				merged = append(merged, bson.E{Key: key, Value: mv})
+			}
+		default:
+			conflicts = append(conflicts, key)
+			if inMine {
+				merged = append(merged, bson.E{Key: key, Value: mv})
+			}
+		}
+	}
+
+	raw, err := bson.Marshal(merged)
+	if err != nil {
+		return "", nil, err
+	}
+	out, err := FormatDocument(raw)
+	if err != nil {
+		return "", nil, err
+	}
+	return out, conflicts, nil
+}
+
+// field returns the value of a top-level field
+func field(doc bson.D, key string) (interface{}, bool) {
+	for _, e := range doc {
+		if e.Key == key {
+			return e.Value, true
+		}
+	}
+	return nil, false
+}
+
+// sameSnapshot reports whether a stored document still equals the snapshot
+func sameSnapshot(raw bson.Raw, snapshot string) bool {
+	current, err := FormatDocument(raw)
+	if err != nil {
+		return false
+	}
+	return current == snapshot
+}
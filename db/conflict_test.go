@@ -0,0 +1,131 @@
+package db
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestSnapshotFilter(t *testing.T) {
+	snapshot := bson.D{
+		{Key: "_id", Value: int32(1)},
+		{Key: "tags", Value: bson.A{"a", "b"}},
+		{Key: "a.b", Value: "$price"},
+	}
+	want := bson.D{
+		{Key: "_id", Value: bson.D{{Key: "$eq", Value: int32(1)}}},
+		{Key: "$expr", Value: bson.D{{Key: "$eq", Value: bson.A{
+			"$$ROOT",
+			bson.D{{Key: "$literal", Value: snapshot}},
+		}}}},
+	}
+	if got := snapshotFilter(snapshot); !reflect.DeepEqual(got, want) {
+		t.Errorf("snapshotFilter = %v, want %v", got, want)
+	}
+
+	// Without an _id only the whole document is compared
+	got := snapshotFilter(bson.D{{Key: "x", Value: int32(1)}})
+	if len(got) != 1 || got[0].Key != "$expr" {
+		t.Errorf("snapshotFilter without _id = %v", got)
+	}
+}
+
+func TestMergeDocuments(t *testing.T) {
+	tests := []struct {
+		name               string
+		base, mine, theirs string
+		want               string
+		conflicts          []string
+	}{
+		{
+			name:   "changed on different fields",
+			base:   `{"_id": 1, "a": 1, "b": 1}`,
+			mine:   `{"_id": 1, "a": 2, "b": 1}`,
+			theirs: `{"_id": 1, "a": 1, "b": 3}`,
+			want:   `{"_id": 1, "a": 2, "b": 3}`,
+		},
+		{
+			name:   "same change on both sides",
+			base:   `{"_id": 1, "a": 1}`,
+			mine:   `{"_id": 1, "a": 2}`,
+			theirs: `{"_id": 1, "a": 2}`,
+			want:   `{"_id": 1, "a": 2}`,
+		},
+		{
+			name:      "different changes keep mine",
+			base:      `{"_id": 1, "a": 1}`,
+			mine:      `{"_id": 1, "a": 2}`,
+			theirs:    `{"_id": 1, "a": 3}`,
+			want:      `{"_id": 1, "a": 2}`,
+			conflicts: []string{"a"},
+		},
+		{
+			name:   "added and removed fields",
+			base:   `{"_id": 1, "a": 1, "b": 1}`,
+			mine:   `{"_id": 1, "a": 1, "b": 1, "c": 1}`,
+			theirs: `{"_id": 1, "b": 1, "d": 1}`,
+			want:   `{"_id": 1, "b": 1, "d": 1, "c": 1}`,
+		},
+		{
+			name:      "removed by them, changed by me",
+			base:      `{"_id": 1, "a": 1}`,
+			mine:      `{"_id": 1, "a": 2}`,
+			theirs:    `{"_id": 1}`,
+			want:      `{"_id": 1, "a": 2}`,
+			conflicts: []string{"a"},
+		},
+		{
+			name:   "document deleted",
+			base:   `{"_id": 1, "a": 1}`,
+			mine:   `{"_id": 1, "a": 1}`,
+			theirs: "",
+			want:   `{}`,
+		},
+		{
+			name:   "type change is a change",
+			base:   `{"_id": 1, "a": 1}`,
+			mine:   `{"_id": 1, "a": 1}`,
+			theirs: `{"_id": 1, "a": {"$numberLong": "1"}}`,
+			want:   `{"_id": 1, "a": {"$numberLong": "1"}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, conflicts, err := MergeDocuments(tt.base, tt.mine, tt.theirs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(conflicts, tt.conflicts) {
+				t.Errorf("conflicts = %v, want %v", conflicts, tt.conflicts)
+			}
+			if compact(got) != compact(canonical(t, tt.want)) {
+				t.Errorf("merged = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// canonical formats a relaxed Extended JSON document as FormatDocument does
+func canonical(t *testing.T, doc string) string {
+	t.Helper()
+	parsed, err := ParseDocument(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := bson.Marshal(parsed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := FormatDocument(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+// compact drops the whitespace of formatted JSON
+func compact(s string) string {
+	return strings.Join(strings.Fields(s), "")
+}
@@ -3,7 +3,9 @@ package db
 import (
 	"context"
 	"fmt"
+	"net"
 	"net/url"
+	"strconv"
 	"time"
 
 	"github.com/ksiezykm/FerretMate/model"
@@ -11,42 +13,154 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-var Client *mongo.Client
+// defaultPort is used when a host is given without a port
+const defaultPort = 27017
 
-func Connect(c model.Connection) error {
-	var uri string
-	if c.Username != "" && c.Password != "" {
-		uri = fmt.Sprintf("mongodb://%s:%s@%s:%d/?directConnection=true",
-			url.QueryEscape(c.Username),
-			url.QueryEscape(c.Password),
-			c.Host, c.Port)
-	} else {
-		uri = fmt.Sprintf("mongodb://%s:%d/?directConnection=true",
-			c.Host, c.Port)
+// clientOptions builds the driver options for a connection. A connection string is
+// used as-is, with the host, port and credentials fields applied on top of it.
+// Without one the URI is built from the fields and connects directly to that host.
+func clientOptions(c model.Connection) (*options.ClientOptions, error) {
+	if c.URI == "" {
+		var uri string
+		if c.Username != "" && c.Password != "" {
+			uri = fmt.Sprintf("mongodb://%s:%s@%s:%d/?directConnection=true",
+				url.QueryEscape(c.Username),
+				url.QueryEscape(c.Password),
+				c.Host, c.Port)
+		} else {
+			uri = fmt.Sprintf("mongodb://%s:%d/?directConnection=true",
+				c.Host, c.Port)
+		}
+		opts := options.Client().ApplyURI(uri)
+		if err := applyTLS(opts, c); err != nil {
+			return nil, err
+		}
+		return opts, nil
+	}
+
+	opts := options.Client().ApplyURI(c.URI)
+	if err := opts.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid connection string: %w", err)
+	}
+
+	if c.Host != "" {
+		port := c.Port
+		if port == 0 {
+			port = defaultPort
+		}
+		opts.SetHosts([]string{c.Host + ":" + strconv.Itoa(port)})
+	}
+
+	if c.Username != "" {
+		// Keep the auth source and mechanism from the connection string
+		auth := options.Credential{}
+		if opts.Auth != nil {
+			auth = *opts.Auth
+		}
+		auth.Username = c.Username
+		if c.Password != "" {
+			auth.Password = c.Password
+			auth.PasswordSet = true
+		}
+		opts.SetAuth(auth)
+	}
+
+	if err := applyTLS(opts, c); err != nil {
+		return nil, err
+	}
+	return opts, nil
+}
+
+// connect opens a client for a connection, with its SSH tunnel if it has one,
+// and checks it with a ping
+func connect(c model.Connection) (*mongo.Client, *sshTunnel, error) {
+	opts, err := clientOptions(c)
+	if err != nil {
+		return nil, nil, redactError(c, err)
+	}
+
+	var t *sshTunnel
+	if c.UsesSSH() {
+		if t, err = tunnelOptions(opts, c); err != nil {
+			return nil, nil, redactError(c, err)
+		}
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	client, err := mongo.Connect(ctx, opts)
 	if err != nil {
-		return err
+		if t != nil {
+			t.Close()
+		}
+		return nil, nil, redactError(c, err)
 	}
 
 	if err := client.Ping(ctx, nil); err != nil {
-		return err
+		client.Disconnect(context.Background())
+		if t != nil {
+			t.Close()
+		}
+		return nil, nil, redactError(c, err)
 	}
 
-	Client = client
-	return nil
+	return client, t, nil
 }
 
-// Disconnect closes the MongoDB connection
-func Disconnect() error {
-	if Client == nil {
-		return nil
+// tunnelOptions opens the SSH tunnel of a connection and points the options at it.
+// The driver then talks to a single server through the local end of the tunnel.
+func tunnelOptions(opts *options.ClientOptions, c model.Connection) (*sshTunnel, error) {
+	if len(opts.Hosts) != 1 {
+		return nil, fmt.Errorf("an SSH tunnel needs exactly one host, the connection has %d", len(opts.Hosts))
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-	return Client.Disconnect(ctx)
+	remote := opts.Hosts[0]
+	if _, _, err := net.SplitHostPort(remote); err != nil {
+		remote = net.JoinHostPort(remote, strconv.Itoa(defaultPort))
+	}
+
+	t, err := openTunnel(c, remote)
+	if err != nil {
+		return nil, err
+	}
+
+	opts.SetHosts([]string{t.Addr()})
+	opts.SetDirect(true)
+
+	// Certificates are issued for the real host, not the local tunnel end
+	if opts.TLSConfig != nil && opts.TLSConfig.ServerName == "" {
+		cfg := opts.TLSConfig.Clone()
+		cfg.ServerName, _, _ = net.SplitHostPort(remote)
+		opts.SetTLSConfig(cfg)
+	}
+	return t, nil
+}
+
+// ValidateURI reports whether a connection string can be parsed
+func ValidateURI(uri string) error {
+	return options.Client().ApplyURI(uri).Validate()
+}
+
+// redactedError is an error whose message has the credentials hidden; the
+// cause is kept for errors.Is and errors.As, e.g. in ClassifyError
+type redactedError struct {
+	msg   string
+	cause error
+}
+
+func (e *redactedError) Error() string {
+	return e.msg
+}
+
+func (e *redactedError) Unwrap() error {
+	return e.cause
+}
+
+// redactError hides the connection's credentials in an error message
+func redactError(c model.Connection, err error) error {
+	msg := err.Error()
+	if redacted := c.RedactText(msg); redacted != msg {
+		return &redactedError{msg: redacted, cause: err}
+	}
+	return err
 }
@@ -0,0 +1,282 @@
+package db
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ksiezykm/FerretMate/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// maxIndexColumns limits the columns an array is spread over by IndexColumns
+const maxIndexColumns = 50
+
+// CSVOptions select the documents and the columns of ExportCSV
+type CSVOptions struct {
+	Columns   []string    // dotted paths, in column order
+	Comma     rune        // ',' for CSV, '\t' for TSV
+	Separator string      // joins the values of a column that goes through an array
+	Query     model.Query // filter, projection and sort
+}
+
+// FieldSample is the result of SampleFields
+type FieldSample struct {
+	Fields       []string       // dotted paths of the values, in first-seen order
+	ArrayLengths map[string]int // longest array seen at each array path
+}
+
+// SampleFields reads up to limit documents matching the query and returns
+// the dotted paths of their values. Nested documents are followed; an array
+// of documents contributes the paths of its elements (items.sku) and an
+// array of values its own path (tags).
+func SampleFields(ctx context.Context, client *mongo.Client, dbName, collName string, query model.Query, limit int64) (FieldSample, error) {
+	sample := FieldSample{ArrayLengths: map[string]int{}}
+	filter, err := queryFilter(query)
+	if err != nil {
+		return sample, err
+	}
+	opts, err := findOptions(query)
+	if err != nil {
+		return sample, err
+	}
+	opts.SetLimit(limit)
+
+	cursor, err := client.Database(dbName).Collection(collName).Find(ctx, filter, opts)
+	if err != nil {
+		return sample, fmt.Errorf("failed to find documents: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	seen := map[string]bool{}
+	for cursor.Next(ctx) {
+		var doc bson.D
+		if err := cursor.Decode(&doc); err != nil {
+			return sample, fmt.Errorf("failed to decode document: %w", err)
+		}
+		sample.walk("", doc, seen)
+	}
+	if err := cursor.Err(); err != nil {
+		return sample, fmt.Errorf("failed to read documents: %w", err)
+	}
+	return sample, nil
+}
+
+// walk records the paths of a value found at path
+func (s *FieldSample) walk(path string, value interface{}, seen map[string]bool) {
+	add := func(path string) {
+		if path != "" && !seen[path] {
+			seen[path] = true
+			s.Fields = append(s.Fields, path)
+		}
+	}
+
+	switch v := value.(type) {
+	case bson.D:
+		for _, e := range v {
+			s.walk(joinPath(path, e.Key), e.Value, seen)
+		}
+	case bson.A:
+		if len(v) > s.ArrayLengths[path] {
+			s.ArrayLengths[path] = len(v)
+		}
+		for _, elem := range v {
+			if doc, ok := elem.(bson.D); ok {
+				s.walk(path, doc, seen)
+			} else {
+				add(path)
+			}
+		}
+	default:
+		add(path)
+	}
+}
+
+// joinPath appends a key to a dotted path
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// IndexColumns spreads the columns that go through an array over one column
+// per element (at the first array of the path), using the longest arrays of
+// the sample: tags becomes tags.0, tags.1, ... and items.sku becomes
+// items.0.sku, items.1.sku, ...
+func IndexColumns(columns []string, arrayLengths map[string]int) []string {
+	var out []string
+	for _, column := range columns {
+		segments := strings.Split(column, ".")
+		expanded := false
+		for i := 1; i <= len(segments) && !expanded; i++ {
+			prefix := strings.Join(segments[:i], ".")
+			n, ok := arrayLengths[prefix]
+			if !ok {
+				continue
+			}
+			n = min(n, maxIndexColumns)
+			for k := 0; k < n; k++ {
+				out = append(out, strings.Join(append([]string{prefix, strconv.Itoa(k)}, segments[i:]...), "."))
+			}
+			expanded = true
+		}
+		if !expanded {
+			out = append(out, column)
+		}
+	}
+	return out
+}
+
+// ExportCSV writes the documents of a collection matching the query to a
+// CSV or TSV file with a header row of the column paths. Dates are written
+// in ISO 8601 (UTC), ObjectIds as hex, binary data as base64 and nested
+// documents as Extended JSON. Like StreamExport, it writes to a temporary
+// file, renames it on success and has no deadline. progress receives the
+// rows written out of the estimated total.
+func ExportCSV(ctx context.Context, client *mongo.Client, dbName, collName, filePath string, opts CSVOptions, progress func(done, total int64)) (int64, error) {
+	if len(opts.Columns) == 0 {
+		return 0, fmt.Errorf("no columns selected")
+	}
+	filter, err := queryFilter(opts.Query)
+	if err != nil {
+		return 0, err
+	}
+	findOpts, err := findOptions(opts.Query)
+	if err != nil {
+		return 0, err
+	}
+
+	coll := client.Database(dbName).Collection(collName)
+	total := estimateCount(coll, filter)
+	if total < 0 {
+		total = 0
+	}
+
+	cursor, err := coll.Find(ctx, filter, findOpts)
+	if err != nil {
+		return 0, fmt.Errorf("failed to find documents: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var count int64
+	err = writeExportFile(filePath, false, func(out io.Writer) error {
+		w := csv.NewWriter(out)
+		w.Comma = opts.Comma
+		if err := w.Write(opts.Columns); err != nil {
+			return fmt.Errorf("failed to write to file: %w", err)
+		}
+
+		row := make([]string, len(opts.Columns))
+		for cursor.Next(ctx) {
+			var doc bson.D
+			if err := cursor.Decode(&doc); err != nil {
+				return fmt.Errorf("failed to decode document: %w", err)
+			}
+			for i, column := range opts.Columns {
+				row[i] = csvCell(resolvePath(doc, strings.Split(column, ".")), opts.Separator)
+			}
+			if err := w.Write(row); err != nil {
+				return fmt.Errorf("failed to write to file: %w", err)
+			}
+			count++
+			progress(count, total)
+		}
+		if err := cursor.Err(); err != nil {
+			return fmt.Errorf("failed to read documents: %w", err)
+		}
+		w.Flush()
+		return w.Error()
+	})
+	return count, err
+}
+
+// resolvePath returns the values at a dotted path, following the MongoDB
+// rules: a numeric segment indexes an array, any other segment applied to an
+// array is applied to each of its elements. An array at the end of the path
+// yields its elements.
+func resolvePath(value interface{}, segments []string) []interface{} {
+	if len(segments) == 0 {
+		if arr, ok := value.(bson.A); ok {
+			var values []interface{}
+			for _, elem := range arr {
+				values = append(values, resolvePath(elem, nil)...)
+			}
+			return values
+		}
+		return []interface{}{value}
+	}
+
+	switch v := value.(type) {
+	case bson.D:
+		for _, e := range v {
+			if e.Key == segments[0] {
+				return resolvePath(e.Value, segments[1:])
+			}
+		}
+	case bson.A:
+		if i, err := strconv.Atoi(segments[0]); err == nil {
+			if i >= 0 && i < len(v) {
+				return resolvePath(v[i], segments[1:])
+			}
+			return nil
+		}
+		var values []interface{}
+		for _, elem := range v {
+			values = append(values, resolvePath(elem, segments)...)
+		}
+		return values
+	}
+	return nil
+}
+
+// csvCell formats the values of a column, joined by separator
+func csvCell(values []interface{}, separator string) string {
+	parts := make([]string, 0, len(values))
+	for _, v := range values {
+		parts = append(parts, csvValue(v))
+	}
+	return strings.Join(parts, separator)
+}
+
+// csvValue formats a single value for a CSV cell
+func csvValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil, primitive.Undefined:
+		return ""
+	case string:
+		return v
+	case bool:
+		return strconv.FormatBool(v)
+	case int32:
+		return strconv.FormatInt(int64(v), 10)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case primitive.ObjectID:
+		return v.Hex()
+	case primitive.DateTime:
+		return v.Time().UTC().Format("2006-01-02T15:04:05.000Z")
+	case primitive.Timestamp:
+		return time.Unix(int64(v.T), 0).UTC().Format(time.RFC3339)
+	case primitive.Decimal128:
+		return v.String()
+	case primitive.Binary:
+		return base64.StdEncoding.EncodeToString(v.Data)
+	case primitive.Regex:
+		return "/" + v.Pattern + "/" + v.Options
+	case bson.D:
+		if out, err := bson.MarshalExtJSON(v, false, false); err == nil {
+			return string(out)
+		}
+	}
+	return fmt.Sprint(value)
+}
@@ -0,0 +1,143 @@
+package db
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestResolvePath(t *testing.T) {
+	doc := bson.D{
+		{Key: "name", Value: "Ada"},
+		{Key: "tags", Value: bson.A{"a", "b", bson.A{"c"}}},
+		{Key: "address", Value: bson.D{{Key: "city", Value: "Oslo"}}},
+		{Key: "items", Value: bson.A{
+			bson.D{{Key: "sku", Value: "x1"}, {Key: "qty", Value: int32(2)}},
+			bson.D{{Key: "sku", Value: "x2"}},
+			bson.D{{Key: "sku", Value: bson.A{"x3", "x4"}}},
+			"loose",
+		}},
+		{Key: "matrix", Value: bson.A{bson.A{int32(1), int32(2)}, bson.A{int32(3)}}},
+	}
+
+	tests := []struct {
+		path string
+		want []interface{}
+	}{
+		{"name", []interface{}{"Ada"}},
+		{"address.city", []interface{}{"Oslo"}},
+		{"address", []interface{}{bson.D{{Key: "city", Value: "Oslo"}}}},
+		{"tags", []interface{}{"a", "b", "c"}},
+		{"tags.1", []interface{}{"b"}},
+		{"tags.-1", nil},
+		{"tags.9", nil},
+		{"items.sku", []interface{}{"x1", "x2", "x3", "x4"}},
+		{"items.qty", []interface{}{int32(2)}},
+		{"items.0.sku", []interface{}{"x1"}},
+		{"items.2.sku.1", []interface{}{"x4"}},
+		{"items.3", []interface{}{"loose"}},
+		{"matrix.1.0", []interface{}{int32(3)}},
+		{"matrix.0", []interface{}{int32(1), int32(2)}},
+		{"missing", nil},
+		{"name.first", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := resolvePath(doc, strings.Split(tt.path, ".")); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("resolvePath(%s) = %v, want %v", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIndexColumns(t *testing.T) {
+	var capped []string
+	for k := 0; k < maxIndexColumns; k++ {
+		capped = append(capped, "log."+strconv.Itoa(k))
+	}
+
+	tests := []struct {
+		name    string
+		columns []string
+		lengths map[string]int
+		want    []string
+	}{
+		{"no arrays", []string{"_id", "a.b"}, map[string]int{}, []string{"_id", "a.b"}},
+		{"array of values", []string{"_id", "tags"}, map[string]int{"tags": 2}, []string{"_id", "tags.0", "tags.1"}},
+		{"array of documents", []string{"items.sku", "items.qty"}, map[string]int{"items": 2},
+			[]string{"items.0.sku", "items.1.sku", "items.0.qty", "items.1.qty"}},
+		{"first array of the path", []string{"a.items.sku"}, map[string]int{"a.items": 1, "a.items.sku": 3}, []string{"a.items.0.sku"}},
+		{"empty arrays", []string{"tags", "x"}, map[string]int{"tags": 0}, []string{"x"}},
+		{"capped", []string{"log"}, map[string]int{"log": maxIndexColumns + 10}, capped},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IndexColumns(tt.columns, tt.lengths); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("IndexColumns = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFieldSampleWalk(t *testing.T) {
+	sample := FieldSample{ArrayLengths: map[string]int{}}
+	seen := map[string]bool{}
+	sample.walk("", bson.D{
+		{Key: "_id", Value: int32(1)},
+		{Key: "tags", Value: bson.A{"a", "b"}},
+		{Key: "items", Value: bson.A{bson.D{{Key: "sku", Value: "x"}}, bson.D{{Key: "sku", Value: "y"}, {Key: "qty", Value: int32(1)}}}},
+	}, seen)
+	sample.walk("", bson.D{{Key: "tags", Value: bson.A{"c", "d", "e"}}, {Key: "note", Value: "n"}}, seen)
+
+	if want := []string{"_id", "tags", "items.sku", "items.qty", "note"}; !reflect.DeepEqual(sample.Fields, want) {
+		t.Errorf("Fields = %v, want %v", sample.Fields, want)
+	}
+	if want := map[string]int{"tags": 3, "items": 2}; !reflect.DeepEqual(sample.ArrayLengths, want) {
+		t.Errorf("ArrayLengths = %v, want %v", sample.ArrayLengths, want)
+	}
+}
+
+func TestCSVValue(t *testing.T) {
+	oid, _ := primitive.ObjectIDFromHex("65a1b2c3d4e5f60718293a4b")
+	decimal, _ := primitive.ParseDecimal128("1.50")
+	at := time.Date(2024, 1, 2, 3, 4, 5, 6e6, time.UTC)
+
+	tests := []struct {
+		name  string
+		value interface{}
+		want  string
+	}{
+		{"nil", nil, ""},
+		{"undefined", primitive.Undefined{}, ""},
+		{"string", "a,b", "a,b"},
+		{"bool", true, "true"},
+		{"int32", int32(-7), "-7"},
+		{"int64", int64(5000000000), "5000000000"},
+		{"double", 2.5, "2.5"},
+		{"large double", 1e21, "1e+21"},
+		{"ObjectId", oid, oid.Hex()},
+		{"date", primitive.NewDateTimeFromTime(at), "2024-01-02T03:04:05.006Z"},
+		{"timestamp", primitive.Timestamp{T: uint32(at.Unix()), I: 1}, "2024-01-02T03:04:05Z"},
+		{"decimal", decimal, "1.50"},
+		{"binary", primitive.Binary{Data: []byte("hi")}, "aGk="},
+		{"regex", primitive.Regex{Pattern: "^a", Options: "i"}, "/^a/i"},
+		{"document", bson.D{{Key: "a", Value: int32(1)}, {Key: "at", Value: primitive.NewDateTimeFromTime(at)}},
+			`{"a":1,"at":{"$date":"2024-01-02T03:04:05.006Z"}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := csvValue(tt.value); got != tt.want {
+				t.Errorf("csvValue(%#v) = %q, want %q", tt.value, got, tt.want)
+			}
+		})
+	}
+
+	if got := csvCell([]interface{}{"a", int32(1), nil}, "|"); got != "a|1|" {
+		t.Errorf("csvCell = %q, want a|1|", got)
+	}
+}
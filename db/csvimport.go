@@ -0,0 +1,475 @@
+package db
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ColumnType is the BSON type the values of a CSV column are converted to
+type ColumnType int
+
+const (
+	TypeString ColumnType = iota
+	TypeInt
+	TypeLong
+	TypeDouble
+	TypeBool
+	TypeDate
+	TypeObjectID
+)
+
+// columnTypeNames are the names of the column types, as typed in the mapping
+var columnTypeNames = map[ColumnType]string{
+	TypeString:   "string",
+	TypeInt:      "int",
+	TypeLong:     "long",
+	TypeDouble:   "double",
+	TypeBool:     "bool",
+	TypeDate:     "date",
+	TypeObjectID: "objectId",
+}
+
+func (t ColumnType) String() string {
+	return columnTypeNames[t]
+}
+
+// ParseColumnType returns the column type with the given name (case-insensitive)
+func ParseColumnType(name string) (ColumnType, bool) {
+	for t, n := range columnTypeNames {
+		if strings.EqualFold(n, strings.TrimSpace(name)) {
+			return t, true
+		}
+	}
+	return TypeString, false
+}
+
+// csvDateLayouts are the accepted date formats, tried in order
+var csvDateLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+var objectIDPattern = regexp.MustCompile(`^[0-9a-fA-F]{24}$`)
+
+// CSVColumn maps a CSV column to a field of the imported documents
+type CSVColumn struct {
+	Header string     // the column name in the file
+	Path   string     // dotted target path; empty skips the column
+	Type   ColumnType // inferred from the preview, may be changed
+}
+
+// CSVPreview is the start of a CSV file with the inferred column types
+type CSVPreview struct {
+	Columns []CSVColumn
+	Rows    [][]string // the first rows after the header
+}
+
+// csvPreviewRows is the number of rows read to infer the column types
+const csvPreviewRows = 200
+
+// newCSVReader returns a reader for CSV (comma ',') or TSV (comma '\t') data
+func newCSVReader(r io.Reader, comma rune) *csv.Reader {
+	reader := csv.NewReader(r)
+	reader.Comma = comma
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	return reader
+}
+
+// PreviewCSV reads the header and the first rows of a CSV or TSV file and
+// infers the type of each column. The target paths default to the headers.
+func PreviewCSV(filePath string, comma rune) (CSVPreview, error) {
+	var preview CSVPreview
+	file, err := os.Open(filePath)
+	if err != nil {
+		return preview, fmt.Errorf("failed to read file: %w", err)
+	}
+	defer file.Close()
+
+	reader := newCSVReader(file, comma)
+	header, err := reader.Read()
+	if err != nil {
+		return preview, fmt.Errorf("failed to read the header: %w", err)
+	}
+	for len(preview.Rows) < csvPreviewRows {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return preview, fmt.Errorf("failed to read row %d: %w", len(preview.Rows)+1, err)
+		}
+		preview.Rows = append(preview.Rows, row)
+	}
+
+	for i, name := range header {
+		name = strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))
+		values := make([]string, 0, len(preview.Rows))
+		for _, row := range preview.Rows {
+			if i < len(row) {
+				values = append(values, row[i])
+			}
+		}
+		preview.Columns = append(preview.Columns, CSVColumn{Header: name, Path: name, Type: inferType(values)})
+	}
+	return preview, nil
+}
+
+// inferType returns the narrowest type all non-empty values convert to.
+// A column with a value past the int32 range is long as a whole, and
+// ObjectId comes before double, as all-digit ids parse as numbers too.
+func inferType(values []string) ColumnType {
+	candidates := []ColumnType{TypeInt, TypeLong, TypeObjectID, TypeDouble, TypeBool, TypeDate}
+	seen := false
+	for _, v := range values {
+		if strings.TrimSpace(v) == "" {
+			continue
+		}
+		seen = true
+		kept := candidates[:0]
+		for _, t := range candidates {
+			if _, err := convertValue(v, t); err == nil {
+				kept = append(kept, t)
+			}
+		}
+		candidates = kept
+	}
+	if !seen || len(candidates) == 0 {
+		return TypeString
+	}
+	return candidates[0]
+}
+
+// convertValue converts a cell to the given type
+func convertValue(value string, t ColumnType) (interface{}, error) {
+	trimmed := strings.TrimSpace(value)
+	switch t {
+	case TypeInt:
+		n, err := strconv.ParseInt(trimmed, 10, 32)
+		if errors.Is(err, strconv.ErrRange) {
+			return nil, fmt.Errorf("%q is out of the int range, use long", value)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%q is not an int", value)
+		}
+		return int32(n), nil
+	case TypeLong:
+		n, err := strconv.ParseInt(trimmed, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a long", value)
+		}
+		return n, nil
+	case TypeDouble:
+		f, err := strconv.ParseFloat(trimmed, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a double", value)
+		}
+		return f, nil
+	case TypeBool:
+		switch strings.ToLower(trimmed) {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		}
+		return nil, fmt.Errorf("%q is not a bool", value)
+	case TypeDate:
+		for _, layout := range csvDateLayouts {
+			if d, err := time.Parse(layout, trimmed); err == nil {
+				return primitive.NewDateTimeFromTime(d), nil
+			}
+		}
+		return nil, fmt.Errorf("%q is not a date", value)
+	case TypeObjectID:
+		if !objectIDPattern.MatchString(trimmed) {
+			return nil, fmt.Errorf("%q is not an ObjectId", value)
+		}
+		return primitive.ObjectIDFromHex(trimmed)
+	}
+	return value, nil
+}
+
+// buildDocument converts a row to a document, creating the nested documents
+// of dotted paths. Empty cells are left out.
+func buildDocument(columns []CSVColumn, row []string) (bson.D, error) {
+	doc := bson.D{}
+	for i, column := range columns {
+		if column.Path == "" || i >= len(row) || strings.TrimSpace(row[i]) == "" {
+			continue
+		}
+		value, err := convertValue(row[i], column.Type)
+		if err != nil {
+			return nil, fmt.Errorf("column %s: %w", column.Header, err)
+		}
+		if doc, err = setPath(doc, strings.Split(column.Path, "."), value); err != nil {
+			return nil, fmt.Errorf("column %s: %w", column.Header, err)
+		}
+	}
+	return doc, nil
+}
+
+// setPath sets a dotted path of doc, creating the documents on the way
+func setPath(doc bson.D, segments []string, value interface{}) (bson.D, error) {
+	for i, e := range doc {
+		if e.Key != segments[0] {
+			continue
+		}
+		if len(segments) == 1 {
+			return nil, fmt.Errorf("field %s is set twice", segments[0])
+		}
+		sub, ok := e.Value.(bson.D)
+		if !ok {
+			return nil, fmt.Errorf("field %s is not a document", segments[0])
+		}
+		sub, err := setPath(sub, segments[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		doc[i].Value = sub
+		return doc, nil
+	}
+
+	if len(segments) == 1 {
+		return append(doc, bson.E{Key: segments[0], Value: value}), nil
+	}
+	sub, err := setPath(bson.D{}, segments[1:], value)
+	if err != nil {
+		return nil, err
+	}
+	return append(doc, bson.E{Key: segments[0], Value: sub}), nil
+}
+
+// ImportMode decides what ImportCSV does with a row whose _id already exists
+type ImportMode int
+
+const (
+	ImportInsert ImportMode = iota // the row fails and goes to the report
+	ImportUpsert                   // the stored document is replaced
+	ImportSkip                     // the row is skipped
+)
+
+// ImportResult summarises a CSV import
+type ImportResult struct {
+	Inserted int64
+	Replaced int64
+	Skipped  int64  // rows whose _id already existed (skip mode)
+	Failed   int64  // rows written to the report
+	Report   string // path of the error report, empty if no row failed
+}
+
+// importRow is a converted row waiting in a batch
+type importRow struct {
+	number int // 1 for the first row after the header
+	record []string
+	doc    bson.D
+}
+
+// ImportCSV imports a CSV or TSV file into a collection with the given
+// column mapping. Rows are written in unordered batches; a row that cannot
+// be converted or written is listed with its error in a CSV report at
+// reportPath (created only if a row fails) and the import goes on.
+// progress receives the rows processed out of all rows.
+func ImportCSV(ctx context.Context, client *mongo.Client, dbName, collName, filePath string, comma rune, columns []CSVColumn, mode ImportMode, reportPath string, progress func(done, total int64)) (ImportResult, error) {
+	var result ImportResult
+	total, err := countCSVRows(filePath, comma)
+	if err != nil {
+		return result, err
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return result, fmt.Errorf("failed to read file: %w", err)
+	}
+	defer file.Close()
+	reader := newCSVReader(file, comma)
+	header, err := reader.Read()
+	if err != nil {
+		return result, fmt.Errorf("failed to read the header: %w", err)
+	}
+
+	report := &importReport{path: reportPath, header: header}
+	defer report.close()
+	fail := func(row importRow, err error) error {
+		result.Failed++
+		result.Report = reportPath
+		return report.write(row, err)
+	}
+
+	coll := client.Database(dbName).Collection(collName)
+	var done int64
+	batch := make([]importRow, 0, uploadBatchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		failures, err := writeImportBatch(ctx, coll, batch, mode, &result)
+		if err != nil {
+			return err
+		}
+		for i, row := range batch {
+			if rowErr, ok := failures[i]; ok {
+				if err := fail(row, rowErr); err != nil {
+					return err
+				}
+			}
+		}
+		done += int64(len(batch))
+		batch = batch[:0]
+		progress(done, total)
+		return nil
+	}
+
+	for number := 1; ; number++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		var parseErr *csv.ParseError
+		if err != nil && !errors.As(err, &parseErr) {
+			return result, fmt.Errorf("failed to read file: %w", err)
+		}
+		row := importRow{number: number, record: record}
+		if err == nil {
+			row.doc, err = buildDocument(columns, record)
+		}
+		if err != nil {
+			done++
+			if err := fail(row, err); err != nil {
+				return result, err
+			}
+			continue
+		}
+		batch = append(batch, row)
+		if len(batch) == uploadBatchSize {
+			if err := flush(); err != nil {
+				return result, err
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return result, err
+	}
+	return result, report.close()
+}
+
+// countCSVRows returns the number of rows after the header
+func countCSVRows(filePath string, comma rune) (int64, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read file: %w", err)
+	}
+	defer file.Close()
+
+	reader := newCSVReader(file, comma)
+	reader.ReuseRecord = true
+	var rows int64 = -1 // the header
+	for {
+		_, err := reader.Read()
+		if err == io.EOF {
+			return max(rows, 0), nil
+		}
+		var parseErr *csv.ParseError
+		if err != nil && !errors.As(err, &parseErr) {
+			return 0, fmt.Errorf("failed to read file: %w", err)
+		}
+		rows++
+	}
+}
+
+// writeImportBatch writes a batch of rows and returns the errors of the
+// rows that failed, by position in the batch
+func writeImportBatch(ctx context.Context, coll *mongo.Collection, batch []importRow, mode ImportMode, result *ImportResult) (map[int]error, error) {
+	models := make([]mongo.WriteModel, 0, len(batch))
+	for _, row := range batch {
+		id, hasID := documentID(row.doc)
+		if mode == ImportUpsert && hasID {
+			models = append(models, mongo.NewReplaceOneModel().
+				SetFilter(bson.D{{Key: "_id", Value: id}}).
+				SetReplacement(row.doc).
+				SetUpsert(true))
+		} else {
+			models = append(models, mongo.NewInsertOneModel().SetDocument(row.doc))
+		}
+	}
+
+	failures := map[int]error{}
+	res, err := coll.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+	if err != nil {
+		var bulkErr mongo.BulkWriteException
+		if !errors.As(err, &bulkErr) || bulkErr.WriteConcernError != nil {
+			return nil, fmt.Errorf("failed to write documents: %w", err)
+		}
+		for _, we := range bulkErr.WriteErrors {
+			// A duplicate key (code 11000) is skipped in skip mode
+			if mode == ImportSkip && we.Code == 11000 {
+				result.Skipped++
+				continue
+			}
+			failures[we.Index] = errors.New(we.Message)
+		}
+	}
+	if res != nil {
+		result.Inserted += res.InsertedCount + res.UpsertedCount
+		result.Replaced += res.MatchedCount
+	}
+	return failures, nil
+}
+
+// importReport is the CSV file listing the rows that failed, with the row
+// number, the error and the original values
+type importReport struct {
+	path   string
+	header []string
+	file   *os.File
+	writer *csv.Writer
+}
+
+// write adds a failed row, creating the report on the first one
+func (r *importReport) write(row importRow, rowErr error) error {
+	if r.writer == nil {
+		if err := createDirIfNotExists(filepath.Dir(r.path)); err != nil {
+			return err
+		}
+		file, err := os.Create(r.path)
+		if err != nil {
+			return fmt.Errorf("failed to create the error report: %w", err)
+		}
+		r.file, r.writer = file, csv.NewWriter(file)
+		r.writer.Write(append([]string{"row", "error"}, r.header...))
+	}
+	r.writer.Write(append([]string{strconv.Itoa(row.number), rowErr.Error()}, row.record...))
+	return r.writer.Error()
+}
+
+// close flushes and closes the report, if one was created
+func (r *importReport) close() error {
+	if r.writer == nil {
+		return nil
+	}
+	r.writer.Flush()
+	err := r.writer.Error()
+	if cerr := r.file.Close(); err == nil {
+		err = cerr
+	}
+	r.writer = nil
+	if err != nil {
+		return fmt.Errorf("failed to write the error report: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package db
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestInferType(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []string
+		want   ColumnType
+	}{
+		{"ints", []string{"1", " -2 ", "", "2147483647"}, TypeInt},
+		{"past the int range", []string{"1", "2147483648"}, TypeLong},
+		{"past the long range", []string{"1", "9223372036854775808"}, TypeDouble},
+		{"ints and doubles", []string{"1", "2.5"}, TypeDouble},
+		{"all-digit ObjectIds", []string{"650000000000000000000001", "650000000000000000000002"}, TypeObjectID},
+		{"hex ObjectIds", []string{"65a1b2c3d4e5f60718293a4b"}, TypeObjectID},
+		{"bools", []string{"true", "FALSE"}, TypeBool},
+		{"dates", []string{"2024-01-01", "2024-01-01T10:00:00Z", "2024-01-01 10:00:00"}, TypeDate},
+		{"mixed", []string{"1", "true"}, TypeString},
+		{"empty", []string{"", " "}, TypeString},
+		{"no rows", nil, TypeString},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := inferType(tt.values); got != tt.want {
+				t.Errorf("inferType(%q) = %v, want %v", tt.values, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConvertValueIntWidth(t *testing.T) {
+	tests := []struct {
+		value string
+		t     ColumnType
+		want  interface{}
+		err   string
+	}{
+		{"7", TypeInt, int32(7), ""},
+		{"7", TypeLong, int64(7), ""},
+		{"2147483648", TypeLong, int64(2147483648), ""},
+		{"2147483648", TypeInt, nil, "out of the int range, use long"},
+		{"7.5", TypeInt, nil, "is not an int"},
+		{"x", TypeLong, nil, "is not a long"},
+	}
+	for _, tt := range tests {
+		got, err := convertValue(tt.value, tt.t)
+		switch {
+		case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+			t.Errorf("convertValue(%q, %v) = %v, %v, want error %q", tt.value, tt.t, got, err, tt.err)
+		case tt.err == "" && (err != nil || got != tt.want):
+			t.Errorf("convertValue(%q, %v) = %#v, %v, want %#v", tt.value, tt.t, got, err, tt.want)
+		}
+	}
+
+	// Every cell of an inferred column gets the same BSON type
+	values := []string{"1", "5000000000", "2"}
+	column := []CSVColumn{{Header: "n", Path: "n", Type: inferType(values)}}
+	for _, v := range values {
+		doc, err := buildDocument(column, []string{v})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := doc[0].Value.(int64); !ok {
+			t.Errorf("%s converted to %T, want int64", v, doc[0].Value)
+		}
+	}
+}
+
+func TestBuildDocument(t *testing.T) {
+	columns := []CSVColumn{
+		{Header: "id", Path: "_id", Type: TypeObjectID},
+		{Header: "city", Path: "address.city", Type: TypeString},
+		{Header: "zip", Path: "address.zip", Type: TypeInt},
+		{Header: "lat", Path: "address.geo.lat", Type: TypeDouble},
+		{Header: "note", Path: "", Type: TypeString},
+		{Header: "since", Path: "since", Type: TypeDate},
+	}
+	oid, _ := primitive.ObjectIDFromHex("65a1b2c3d4e5f60718293a4b")
+	since := primitive.NewDateTimeFromTime(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	tests := []struct {
+		name string
+		row  []string
+		want bson.D
+	}{
+		{"nested paths", []string{oid.Hex(), "Oslo", "150", "59.9", "skipped", "2024-01-01"}, bson.D{
+			{Key: "_id", Value: oid},
+			{Key: "address", Value: bson.D{
+				{Key: "city", Value: "Oslo"},
+				{Key: "zip", Value: int32(150)},
+				{Key: "geo", Value: bson.D{{Key: "lat", Value: 59.9}}},
+			}},
+			{Key: "since", Value: since},
+		}},
+		{"empty cells left out", []string{oid.Hex(), "", " ", "59.9"}, bson.D{
+			{Key: "_id", Value: oid},
+			{Key: "address", Value: bson.D{{Key: "geo", Value: bson.D{{Key: "lat", Value: 59.9}}}}},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := buildDocument(columns, tt.row)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("buildDocument = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := buildDocument(columns, []string{"x"}); err == nil || !strings.Contains(err.Error(), "column id:") {
+		t.Errorf("buildDocument with an invalid ObjectId = %v", err)
+	}
+}
+
+func TestSetPathErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		columns []CSVColumn
+		want    string
+	}{
+		{"set twice", []CSVColumn{{Header: "a", Path: "x"}, {Header: "b", Path: "x"}}, "column b: field x is set twice"},
+		{"nested set twice", []CSVColumn{{Header: "a", Path: "x.y"}, {Header: "b", Path: "x.y"}}, "column b: field y is set twice"},
+		{"document over a value", []CSVColumn{{Header: "a", Path: "x.y"}, {Header: "b", Path: "x"}}, "column b: field x is set twice"},
+		{"value under a value", []CSVColumn{{Header: "a", Path: "x"}, {Header: "b", Path: "x.y"}}, "column b: field x is not a document"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := buildDocument(tt.columns, []string{"1", "2"})
+			if err == nil || err.Error() != tt.want {
+				t.Errorf("buildDocument = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,329 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ksiezykm/FerretMate/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// pingCount is the number of round trips measured by Diagnose
+const pingCount = 5
+
+// diagnosticStep is the outcome of one command of a diagnostics run
+type diagnosticStep struct {
+	name     string
+	duration time.Duration
+	note     string
+	err      error
+}
+
+// Diagnose connects to a connection with its own client, independent of its
+// session, and runs ping, buildInfo, hello, connectionStatus and listDatabases. It returns
+// a plain text report with latency, server and FerretDB versions, the backend
+// and the privileges of the user. Failed commands are reported and skipped.
+func Diagnose(c model.Connection) string {
+	var steps []diagnosticStep
+	var b strings.Builder
+
+	target := c.Host + ":" + fmt.Sprint(c.Port)
+	if c.URI != "" {
+		target = model.RedactURI(c.URI)
+	}
+	fmt.Fprintf(&b, "Diagnostics: %s\nTarget: %s\n", c.Name, target)
+	if c.UsesSSH() {
+		fmt.Fprintf(&b, "Tunnel: SSH via %s\n", c.SSHHost)
+	}
+	b.WriteString("\n")
+
+	// Connect
+	start := time.Now()
+	client, closeClient, err := diagnosticClient(c)
+	steps = append(steps, diagnosticStep{name: "connect", duration: time.Since(start), err: err})
+	if err != nil {
+		writeSteps(&b, steps)
+		return b.String()
+	}
+	defer closeClient()
+
+	admin := client.Database("admin")
+	run := func(name string, cmd bson.D) (bson.M, diagnosticStep) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		start := time.Now()
+		var result bson.M
+		err := admin.RunCommand(ctx, cmd).Decode(&result)
+		return result, diagnosticStep{name: name, duration: time.Since(start), err: err}
+	}
+
+	// Ping, several round trips for the latency
+	var latencies []time.Duration
+	var pingErr error
+	for i := 0; i < pingCount; i++ {
+		_, step := run("ping", bson.D{{Key: "ping", Value: 1}})
+		if step.err != nil {
+			pingErr = step.err
+			break
+		}
+		latencies = append(latencies, step.duration)
+	}
+	steps = append(steps, pingStep(latencies, pingErr))
+
+	buildInfo, step := run("buildInfo", bson.D{{Key: "buildInfo", Value: 1}})
+	steps = append(steps, step)
+
+	hello, step := run("hello", bson.D{{Key: "hello", Value: 1}})
+	steps = append(steps, step)
+
+	status, step := run("connectionStatus", bson.D{{Key: "connectionStatus", Value: 1}, {Key: "showPrivileges", Value: true}})
+	steps = append(steps, step)
+
+	databases, step := run("listDatabases", bson.D{{Key: "listDatabases", Value: 1}, {Key: "nameOnly", Value: true}})
+	dbNames := names(databases["databases"], "name")
+	if step.err == nil {
+		step.note = fmt.Sprintf("%d databases", len(dbNames))
+	}
+	steps = append(steps, step)
+
+	writeSteps(&b, steps)
+
+	// Server
+	b.WriteString("\nServer\n")
+	writeField(&b, "Version", buildInfo["version"])
+	writeField(&b, "Git version", buildInfo["gitVersion"])
+	ferret := ferretDBFacts(buildInfo, hello)
+	if len(ferret) == 0 {
+		writeField(&b, "FerretDB", "not detected")
+	}
+	for _, fact := range ferret {
+		writeField(&b, fact[0], fact[1])
+	}
+	writeField(&b, "Topology", topologyOf(hello))
+	writeField(&b, "Max wire version", hello["maxWireVersion"])
+
+	// User
+	b.WriteString("\nUser\n")
+	authInfo, _ := status["authInfo"].(bson.M)
+	users := userNames(authInfo["authenticatedUsers"], "user")
+	if len(users) == 0 {
+		users = []string{"(not authenticated)"}
+	}
+	writeField(&b, "Authenticated as", strings.Join(users, ", "))
+	if roles := userNames(authInfo["authenticatedUserRoles"], "role"); len(roles) > 0 {
+		writeField(&b, "Roles", strings.Join(roles, ", "))
+	}
+	if privileges := privilegeLines(authInfo["authenticatedUserPrivileges"]); len(privileges) > 0 {
+		b.WriteString("  Privileges:\n")
+		for _, line := range privileges {
+			b.WriteString("    " + line + "\n")
+		}
+	} else if status != nil {
+		writeField(&b, "Privileges", "not reported by the server")
+	}
+
+	if len(dbNames) > 0 {
+		fmt.Fprintf(&b, "\nDatabases (%d)\n  %s\n", len(dbNames), strings.Join(dbNames, ", "))
+	}
+
+	return b.String()
+}
+
+// diagnosticClient connects a separate client for a diagnostics run, with its
+// own SSH tunnel if needed. The returned func disconnects it.
+func diagnosticClient(c model.Connection) (*mongo.Client, func(), error) {
+	client, t, err := connect(c)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return client, func() {
+		client.Disconnect(context.Background())
+		if t != nil {
+			t.Close()
+		}
+	}, nil
+}
+
+// pingStep summarizes the ping round trips
+func pingStep(latencies []time.Duration, err error) diagnosticStep {
+	step := diagnosticStep{name: "ping", err: err}
+	if len(latencies) == 0 {
+		return step
+	}
+	min, max, sum := latencies[0], latencies[0], time.Duration(0)
+	for _, l := range latencies {
+		if l < min {
+			min = l
+		}
+		if l > max {
+			max = l
+		}
+		sum += l
+	}
+	step.duration = sum / time.Duration(len(latencies))
+	step.note = fmt.Sprintf("round trip min %s / avg %s / max %s (%d pings)",
+		roundDuration(min), roundDuration(step.duration), roundDuration(max), len(latencies))
+	return step
+}
+
+// writeSteps writes one status line per step, followed by the errors of failed steps
+func writeSteps(b *strings.Builder, steps []diagnosticStep) {
+	var errs []string
+	for _, s := range steps {
+		status := "OK"
+		note := s.note
+		if s.err != nil {
+			kind, message := ClassifyError(s.err)
+			status = "FAILED"
+			note = kind
+			errs = append(errs, fmt.Sprintf("  %s: %s", s.name, message))
+		}
+		fmt.Fprintf(b, "  %-18s %-7s %8s  %s\n", s.name, status, roundDuration(s.duration), note)
+	}
+	if len(errs) > 0 {
+		b.WriteString("\nErrors\n" + strings.Join(errs, "\n") + "\n")
+	}
+}
+
+// writeField writes a "Label: value" line, skipping missing values
+func writeField(b *strings.Builder, label string, value interface{}) {
+	if value == nil || value == "" {
+		return
+	}
+	fmt.Fprintf(b, "  %-18s %v\n", label+":", value)
+}
+
+// roundDuration rounds a duration for display
+func roundDuration(d time.Duration) time.Duration {
+	if d > time.Millisecond {
+		return d.Round(100 * time.Microsecond)
+	}
+	return d.Round(time.Microsecond)
+}
+
+// ferretDBFacts finds FerretDB versions and backend information in the command
+// results. FerretDB reports them in fields such as ferretdbVersion or a ferretdb
+// sub-document, which differ between releases, so matching keys are collected.
+func ferretDBFacts(docs ...bson.M) [][2]string {
+	keywords := []string{"ferretdb", "backend", "handler", "postgres", "sqlite", "documentdb"}
+	seen := make(map[string]bool)
+	var facts [][2]string
+	for _, doc := range docs {
+		flattenFields("", doc, func(path string, value interface{}) {
+			lower := strings.ToLower(path)
+			for _, k := range keywords {
+				if strings.Contains(lower, k) && !seen[path] {
+					seen[path] = true
+					facts = append(facts, [2]string{path, fmt.Sprint(value)})
+					return
+				}
+			}
+		})
+	}
+	sort.Slice(facts, func(i, j int) bool { return facts[i][0] < facts[j][0] })
+	return facts
+}
+
+// flattenFields calls fn for every scalar field of a document with its dotted path
+func flattenFields(prefix string, doc bson.M, fn func(path string, value interface{})) {
+	for key, value := range doc {
+		path := key
+		if prefix != "" {
+			path = prefix + "." + key
+		}
+		if sub, ok := value.(bson.M); ok {
+			flattenFields(path, sub, fn)
+			continue
+		}
+		fn(path, value)
+	}
+}
+
+// topologyOf describes the server role from a hello response
+func topologyOf(hello bson.M) string {
+	if hello == nil {
+		return ""
+	}
+	if set, ok := hello["setName"].(string); ok {
+		role := "secondary"
+		if primary, _ := hello["isWritablePrimary"].(bool); primary {
+			role = "primary"
+		}
+		return fmt.Sprintf("replica set %s (%s)", set, role)
+	}
+	if msg, _ := hello["msg"].(string); msg == "isdbgrid" {
+		return "sharded cluster (mongos)"
+	}
+	return "standalone"
+}
+
+// names returns a string field of each document in an array
+func names(value interface{}, field string) []string {
+	arr, _ := value.(bson.A)
+	var out []string
+	for _, item := range arr {
+		if doc, ok := item.(bson.M); ok {
+			if name, ok := doc[field].(string); ok {
+				out = append(out, name)
+			}
+		}
+	}
+	return out
+}
+
+// userNames formats users or roles as name@db
+func userNames(value interface{}, field string) []string {
+	arr, _ := value.(bson.A)
+	var out []string
+	for _, item := range arr {
+		if doc, ok := item.(bson.M); ok {
+			out = append(out, fmt.Sprintf("%v@%v", doc[field], doc["db"]))
+		}
+	}
+	return out
+}
+
+// privilegeLines formats connectionStatus privileges as "resource: actions"
+func privilegeLines(value interface{}) []string {
+	arr, _ := value.(bson.A)
+	var out []string
+	for _, item := range arr {
+		doc, ok := item.(bson.M)
+		if !ok {
+			continue
+		}
+
+		resource := "?"
+		if res, ok := doc["resource"].(bson.M); ok {
+			if cluster, _ := res["cluster"].(bool); cluster {
+				resource = "cluster"
+			} else {
+				dbName, _ := res["db"].(string)
+				collName, _ := res["collection"].(string)
+				if dbName == "" {
+					dbName = "*"
+				}
+				if collName == "" {
+					collName = "*"
+				}
+				resource = dbName + "." + collName
+			}
+		}
+
+		var actions []string
+		if acts, ok := doc["actions"].(bson.A); ok {
+			for _, a := range acts {
+				actions = append(actions, fmt.Sprint(a))
+			}
+		}
+		sort.Strings(actions)
+		out = append(out, fmt.Sprintf("%s: %s", resource, strings.Join(actions, ", ")))
+	}
+	sort.Strings(out)
+	return out
+}
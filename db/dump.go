@@ -0,0 +1,643 @@
+package db
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// DumpOptions select what DumpDatabase writes
+type DumpOptions struct {
+	Collections []string // collections to dump; empty dumps all but system collections
+	Gzip        bool     // gzip each file, or the whole archive, as mongodump --gzip does
+	Archive     bool     // write a single file, as mongodump --archive does
+}
+
+// DumpDatabase writes a database in the mongodump layout: <db>/<coll>.bson
+// with the raw documents and <coll>.metadata.json with the collection
+// options and index definitions, inside the directory outPath. With Gzip
+// the files are compressed one by one and named .bson.gz and
+// .metadata.json.gz, which mongorestore --gzip reads. With Archive the
+// same content goes to the single file outPath instead, in the format of
+// mongodump --archive (and --gzip). progress receives the documents written
+// out of the estimated total.
+func DumpDatabase(ctx context.Context, client *mongo.Client, dbName, outPath string, opts DumpOptions, progress func(done, total int64)) error {
+	database := client.Database(dbName)
+	specs, err := database.ListCollectionSpecifications(ctx, bson.D{})
+	if err != nil {
+		return fmt.Errorf("failed to list collections: %w", err)
+	}
+
+	// Keep the requested collections, in a stable order
+	wanted := make(map[string]bool, len(opts.Collections))
+	for _, name := range opts.Collections {
+		wanted[name] = true
+	}
+	selected := specs[:0]
+	for _, spec := range specs {
+		if len(wanted) > 0 && !wanted[spec.Name] || len(wanted) == 0 && strings.HasPrefix(spec.Name, "system.") {
+			continue
+		}
+		selected = append(selected, spec)
+	}
+	if len(selected) == 0 {
+		return fmt.Errorf("no collections to dump")
+	}
+	sort.Slice(selected, func(i, j int) bool { return selected[i].Name < selected[j].Name })
+
+	var total int64
+	for _, spec := range selected {
+		if spec.Type == "view" {
+			continue
+		}
+		n, err := database.Collection(spec.Name).EstimatedDocumentCount(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to count documents of %s: %w", spec.Name, err)
+		}
+		total += n
+	}
+
+	if opts.Archive {
+		return dumpArchive(ctx, database, selected, outPath, opts.Gzip, func(done int64) {
+			progress(done, total)
+		})
+	}
+
+	dir := filepath.Join(outPath, dbName)
+	if err := createDirIfNotExists(dir); err != nil {
+		return err
+	}
+
+	var done int64
+	for _, spec := range selected {
+		count, err := dumpCollection(ctx, database, spec, dir, opts.Gzip, func(n int64) {
+			progress(done+n, total)
+		})
+		done += count
+		if err != nil {
+			return fmt.Errorf("%s: %w", spec.Name, err)
+		}
+	}
+	return nil
+}
+
+// dumpCollection writes the .bson and .metadata.json files of one
+// collection (views get only the metadata), gzipped with compress, and
+// returns the documents written
+func dumpCollection(ctx context.Context, database *mongo.Database, spec *mongo.CollectionSpecification, dir string, compress bool, written func(n int64)) (int64, error) {
+	metaJSON, err := dumpMetadata(ctx, database, spec)
+	if err != nil {
+		return 0, err
+	}
+	metaFile, err := createDumpFile(filepath.Join(dir, spec.Name+".metadata.json"), compress)
+	if err != nil {
+		return 0, err
+	}
+	defer metaFile.file.Close()
+	if _, err := metaFile.Write(metaJSON); err != nil {
+		return 0, fmt.Errorf("failed to write to file: %w", err)
+	}
+	if err := metaFile.Close(); err != nil {
+		return 0, err
+	}
+	if spec.Type == "view" {
+		return 0, nil
+	}
+
+	out, err := createDumpFile(filepath.Join(dir, spec.Name+".bson"), compress)
+	if err != nil {
+		return 0, err
+	}
+	defer out.file.Close()
+
+	count, err := dumpDocuments(ctx, database.Collection(spec.Name), out, written)
+	if err != nil {
+		return count, err
+	}
+	return count, out.Close()
+}
+
+// dumpMetadata returns the .metadata.json content of a collection: its
+// options and index definitions
+func dumpMetadata(ctx context.Context, database *mongo.Database, spec *mongo.CollectionSpecification) ([]byte, error) {
+	meta := bson.D{{Key: "options", Value: bson.D{}}}
+	if spec.Options != nil {
+		meta[0].Value = spec.Options
+	}
+	indexes := bson.A{}
+	if spec.Type != "view" {
+		cursor, err := database.Collection(spec.Name).Indexes().List(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list indexes: %w", err)
+		}
+		var specs []bson.D
+		if err := cursor.All(ctx, &specs); err != nil {
+			return nil, fmt.Errorf("failed to list indexes: %w", err)
+		}
+		for _, index := range specs {
+			// The namespace is implied by the file
+			indexes = append(indexes, withoutKeys(index, "ns"))
+		}
+	}
+	meta = append(meta, bson.E{Key: "indexes", Value: indexes})
+	if spec.UUID != nil {
+		meta = append(meta, bson.E{Key: "uuid", Value: hex.EncodeToString(spec.UUID.Data)})
+	}
+	meta = append(meta,
+		bson.E{Key: "collectionName", Value: spec.Name},
+		bson.E{Key: "type", Value: spec.Type},
+	)
+	metaJSON, err := bson.MarshalExtJSON(meta, true, false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal metadata: %w", err)
+	}
+	return metaJSON, nil
+}
+
+// dumpDocuments writes the raw documents of a collection to out and returns
+// how many were written
+func dumpDocuments(ctx context.Context, coll *mongo.Collection, out io.Writer, written func(n int64)) (int64, error) {
+	cursor, err := coll.Find(ctx, bson.D{})
+	if err != nil {
+		return 0, fmt.Errorf("failed to find documents: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var count int64
+	for cursor.Next(ctx) {
+		// The raw document bytes, exactly as stored
+		if _, err := out.Write(cursor.Current); err != nil {
+			return count, fmt.Errorf("failed to write to file: %w", err)
+		}
+		count++
+		written(count)
+	}
+	if err := cursor.Err(); err != nil {
+		return count, fmt.Errorf("failed to read documents: %w", err)
+	}
+	return count, nil
+}
+
+// dumpWriter writes a dump file, gzip-compressed as by mongodump --gzip
+type dumpWriter struct {
+	*bufio.Writer
+	file   *os.File
+	zipped *gzip.Writer // nil when not compressed
+}
+
+// createDumpFile creates a dump file; compress appends .gz to its name
+func createDumpFile(path string, compress bool) (*dumpWriter, error) {
+	if compress {
+		path += ".gz"
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create file: %w", err)
+	}
+	w := &dumpWriter{file: file}
+	if compress {
+		w.zipped = gzip.NewWriter(file)
+		w.Writer = bufio.NewWriter(w.zipped)
+	} else {
+		w.Writer = bufio.NewWriter(file)
+	}
+	return w, nil
+}
+
+// Close flushes the buffered data and the compression and closes the file
+func (w *dumpWriter) Close() error {
+	err := w.Flush()
+	if w.zipped != nil && err == nil {
+		err = w.zipped.Close()
+	}
+	if cerr := w.file.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write to file: %w", err)
+	}
+	return nil
+}
+
+// dumpReader reads a dump file, decompressing the .gz files of mongodump --gzip
+type dumpReader struct {
+	*bufio.Reader
+	file *os.File
+}
+
+// openDumpFile opens a dump file for reading
+func openDumpFile(path string) (*dumpReader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	var r io.Reader = file
+	if strings.HasSuffix(path, ".gz") {
+		zipped, err := gzip.NewReader(file)
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("failed to read %s: %w", filepath.Base(path), err)
+		}
+		r = zipped
+	}
+	return &dumpReader{Reader: bufio.NewReader(r), file: file}, nil
+}
+
+// Close closes the file
+func (r *dumpReader) Close() error {
+	return r.file.Close()
+}
+
+// withoutKeys returns doc without the given top-level keys
+func withoutKeys(doc bson.D, keys ...string) bson.D {
+	out := make(bson.D, 0, len(doc))
+	for _, e := range doc {
+		drop := false
+		for _, k := range keys {
+			drop = drop || e.Key == k
+		}
+		if !drop {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// dumpedCollection is a collection found in a dump directory
+type dumpedCollection struct {
+	name     string
+	bsonPath string // .bson or .bson.gz file, empty for views
+	metadata bson.D
+}
+
+// collectionMetadata is the part of a .metadata.json file needed to restore
+type collectionMetadata struct {
+	Options bson.D   `bson:"options"`
+	Indexes []bson.D `bson:"indexes"`
+	Type    string   `bson:"type"`
+}
+
+// findDumpDir returns the directory holding the dump files: source itself,
+// or its only subdirectory with dump files (the <db> directory of a dump)
+func findDumpDir(source string) (string, error) {
+	hasDumpFiles := func(dir string) bool {
+		for _, pattern := range []string{"*.bson", "*.bson.gz", "*.metadata.json", "*.metadata.json.gz"} {
+			if matches, _ := filepath.Glob(filepath.Join(dir, pattern)); len(matches) > 0 {
+				return true
+			}
+		}
+		return false
+	}
+	if hasDumpFiles(source) {
+		return source, nil
+	}
+
+	entries, err := os.ReadDir(source)
+	if err != nil {
+		return "", fmt.Errorf("failed to read dump: %w", err)
+	}
+	var found []string
+	for _, e := range entries {
+		if e.IsDir() && hasDumpFiles(filepath.Join(source, e.Name())) {
+			found = append(found, e.Name())
+		}
+	}
+	switch len(found) {
+	case 0:
+		return "", fmt.Errorf("no .bson or .metadata.json files found in %s", source)
+	case 1:
+		return filepath.Join(source, found[0]), nil
+	}
+	return "", fmt.Errorf("the dump holds several databases (%s); give the path of one", strings.Join(found, ", "))
+}
+
+// readDumpDir lists the collections of a dump directory, plain or written
+// with mongodump --gzip
+func readDumpDir(dir string) ([]dumpedCollection, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read dump: %w", err)
+	}
+
+	byName := map[string]*dumpedCollection{}
+	get := func(name string) *dumpedCollection {
+		if byName[name] == nil {
+			byName[name] = &dumpedCollection{name: name}
+		}
+		return byName[name]
+	}
+	for _, e := range entries {
+		path := filepath.Join(dir, e.Name())
+		name := strings.TrimSuffix(e.Name(), ".gz")
+		switch {
+		case e.IsDir():
+		case strings.HasSuffix(name, ".metadata.json"):
+			meta, err := readMetadata(path)
+			if err != nil {
+				return nil, err
+			}
+			get(strings.TrimSuffix(name, ".metadata.json")).metadata = meta
+		case strings.HasSuffix(name, ".bson"):
+			get(strings.TrimSuffix(name, ".bson")).bsonPath = path
+		}
+	}
+
+	collections := make([]dumpedCollection, 0, len(byName))
+	for name, c := range byName {
+		// System collections belong to the server that wrote the dump
+		if strings.HasPrefix(name, "system.") {
+			continue
+		}
+		collections = append(collections, *c)
+	}
+	sort.Slice(collections, func(i, j int) bool { return collections[i].name < collections[j].name })
+	return collections, nil
+}
+
+// readMetadata reads a .metadata.json or .metadata.json.gz file
+func readMetadata(path string) (bson.D, error) {
+	r, err := openDumpFile(path)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", filepath.Base(path), err)
+	}
+	var meta bson.D
+	if err := bson.UnmarshalExtJSON(data, false, &meta); err != nil {
+		return nil, fmt.Errorf("invalid metadata in %s: %w", filepath.Base(path), err)
+	}
+	return meta, nil
+}
+
+// maxBSONSize bounds the documents read from a .bson file (16 MiB plus headroom)
+const maxBSONSize = 16*1024*1024 + 16*1024
+
+// readBSON reads the next document of a .bson file; io.EOF at the end
+func readBSON(r *bufio.Reader) (bson.Raw, error) {
+	var size [4]byte
+	if _, err := io.ReadFull(r, size[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, fmt.Errorf("truncated document")
+		}
+		return nil, err
+	}
+	n := binary.LittleEndian.Uint32(size[:])
+	if n < 5 || n > maxBSONSize {
+		return nil, fmt.Errorf("invalid document size %d", n)
+	}
+	doc := make([]byte, n)
+	copy(doc, size[:])
+	if _, err := io.ReadFull(r, doc[4:]); err != nil {
+		return nil, fmt.Errorf("truncated document")
+	}
+	return doc, bson.Raw(doc).Validate()
+}
+
+// countBSON returns the number of documents in a .bson or .bson.gz file
+// by skipping from one length prefix to the next
+func countBSON(path string) (int64, error) {
+	r, err := openDumpFile(path)
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+
+	var count int64
+	var size [4]byte
+	for {
+		if _, err := io.ReadFull(r, size[:]); err != nil {
+			if err == io.EOF {
+				return count, nil
+			}
+			return count, err
+		}
+		n := binary.LittleEndian.Uint32(size[:])
+		if n < 5 {
+			return count, fmt.Errorf("invalid document size %d", n)
+		}
+		if _, err := r.Discard(int(n) - 4); err != nil {
+			return count, fmt.Errorf("truncated document")
+		}
+		count++
+	}
+}
+
+// RestoreResult summarises a restore
+type RestoreResult struct {
+	Collections int   // collections restored
+	Inserted    int64 // documents inserted
+	Duplicates  int64 // documents skipped because their _id already existed
+	Replaced    int64 // existing documents overwritten
+	Invalid     int64 // files that could not be read
+}
+
+// RestoreDump restores a mongodump-style dump into a database. source is a
+// directory with .bson and .metadata.json files (or their .gz versions from
+// mongodump --gzip), a dump directory holding one such <db> directory, or a
+// single file written by mongodump --archive, gzipped or not. Missing
+// collections are created with their dumped options, documents are inserted
+// in batches (existing _ids are skipped, as mongorestore does) and the
+// dumped indexes are created. progress receives the documents restored.
+func RestoreDump(ctx context.Context, client *mongo.Client, source, dbName string, progress func(done, total int64)) (RestoreResult, error) {
+	var result RestoreResult
+
+	if info, err := os.Stat(source); err == nil && !info.IsDir() {
+		return restoreArchive(ctx, client.Database(dbName), source, progress)
+	}
+	dir, err := findDumpDir(source)
+	if err != nil {
+		return result, err
+	}
+	collections, err := readDumpDir(dir)
+	if err != nil {
+		return result, err
+	}
+
+	var total int64
+	for _, c := range collections {
+		if c.bsonPath == "" {
+			continue
+		}
+		n, err := countBSON(c.bsonPath)
+		if err != nil {
+			return result, fmt.Errorf("%s: %w", filepath.Base(c.bsonPath), err)
+		}
+		total += n
+	}
+
+	database := client.Database(dbName)
+	create, err := collectionCreator(ctx, database)
+	if err != nil {
+		return result, err
+	}
+
+	var done int64
+	for _, c := range collections {
+		meta, err := create(c.name, c.metadata)
+		if err != nil {
+			return result, err
+		}
+
+		if c.bsonPath != "" {
+			inserted, duplicates, err := restoreDocuments(ctx, database.Collection(c.name), c.bsonPath, func(n int64) {
+				progress(done+n, total)
+			})
+			done += inserted + duplicates
+			result.Inserted += inserted
+			result.Duplicates += duplicates
+			if err != nil {
+				return result, fmt.Errorf("%s: %w", c.name, err)
+			}
+		}
+
+		if err := restoreIndexes(ctx, database, c.name, meta.Indexes); err != nil {
+			return result, fmt.Errorf("%s: %w", c.name, err)
+		}
+		result.Collections++
+	}
+	return result, nil
+}
+
+// collectionCreator returns a function that reads the dumped metadata of a
+// collection and creates the collection with its options unless it exists
+func collectionCreator(ctx context.Context, database *mongo.Database) (func(name string, metadata bson.D) (collectionMetadata, error), error) {
+	existing, err := database.ListCollectionNames(ctx, bson.D{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list collections: %w", err)
+	}
+	exists := make(map[string]bool, len(existing))
+	for _, name := range existing {
+		exists[name] = true
+	}
+
+	return func(name string, metadata bson.D) (collectionMetadata, error) {
+		var meta collectionMetadata
+		if metadata != nil {
+			raw, err := bson.Marshal(metadata)
+			if err == nil {
+				err = bson.Unmarshal(raw, &meta)
+			}
+			if err != nil {
+				return meta, fmt.Errorf("invalid metadata of %s: %w", name, err)
+			}
+		}
+		if !exists[name] {
+			create := append(bson.D{{Key: "create", Value: name}}, meta.Options...)
+			if err := database.RunCommand(ctx, create).Err(); err != nil {
+				return meta, fmt.Errorf("failed to create collection %s: %w", name, err)
+			}
+			exists[name] = true
+		}
+		return meta, nil
+	}, nil
+}
+
+// restoreDocuments inserts the documents of a .bson file in unordered
+// batches and returns how many were inserted and how many were skipped as
+// duplicate keys
+func restoreDocuments(ctx context.Context, coll *mongo.Collection, path string, restored func(n int64)) (inserted, duplicates int64, err error) {
+	r, err := openDumpFile(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer r.Close()
+
+	batch := make([]interface{}, 0, uploadBatchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		n, dups, err := insertUnordered(ctx, coll, batch)
+		inserted += n
+		duplicates += dups
+		if err != nil {
+			return err
+		}
+		batch = batch[:0]
+		restored(inserted + duplicates)
+		return nil
+	}
+
+	for {
+		doc, err := readBSON(r.Reader)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return inserted, duplicates, fmt.Errorf("document %d: %w", inserted+duplicates+int64(len(batch))+1, err)
+		}
+		batch = append(batch, doc)
+		if len(batch) == uploadBatchSize {
+			if err := flush(); err != nil {
+				return inserted, duplicates, err
+			}
+		}
+	}
+	return inserted, duplicates, flush()
+}
+
+// insertUnordered inserts a batch of documents, skipping those whose _id
+// already exists, and returns how many were inserted and skipped
+func insertUnordered(ctx context.Context, coll *mongo.Collection, batch []interface{}) (inserted, duplicates int64, err error) {
+	// A duplicate key (code 11000) skips the document; other errors stop
+	failed := 0
+	if _, err := coll.InsertMany(ctx, batch, options.InsertMany().SetOrdered(false)); err != nil {
+		var bulkErr mongo.BulkWriteException
+		if !errors.As(err, &bulkErr) || bulkErr.WriteConcernError != nil {
+			return 0, 0, fmt.Errorf("failed to insert documents: %w", err)
+		}
+		for _, we := range bulkErr.WriteErrors {
+			if we.Code != 11000 {
+				return 0, 0, fmt.Errorf("failed to insert documents: %w", err)
+			}
+		}
+		failed = len(bulkErr.WriteErrors)
+	}
+	return int64(len(batch) - failed), int64(failed), nil
+}
+
+// restoreIndexes creates the dumped indexes other than the _id index
+func restoreIndexes(ctx context.Context, database *mongo.Database, collName string, indexes []bson.D) error {
+	specs := bson.A{}
+	for _, index := range indexes {
+		if name, _ := valueOf(index, "name").(string); name == "_id_" {
+			continue
+		}
+		// The index version is chosen by the server
+		specs = append(specs, withoutKeys(index, "v", "ns"))
+	}
+	if len(specs) == 0 {
+		return nil
+	}
+	cmd := bson.D{{Key: "createIndexes", Value: collName}, {Key: "indexes", Value: specs}}
+	if err := database.RunCommand(ctx, cmd).Err(); err != nil {
+		return fmt.Errorf("failed to create indexes: %w", err)
+	}
+	return nil
+}
+
+// valueOf returns the value of a top-level key of doc, or nil
+func valueOf(doc bson.D, key string) interface{} {
+	for _, e := range doc {
+		if e.Key == key {
+			return e.Value
+		}
+	}
+	return nil
+}
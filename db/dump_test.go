@@ -0,0 +1,306 @@
+package db
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// testDocuments returns n small BSON documents
+func testDocuments(t *testing.T, n int) []bson.Raw {
+	t.Helper()
+	docs := make([]bson.Raw, n)
+	for i := range docs {
+		raw, err := bson.Marshal(bson.D{{Key: "_id", Value: int32(i)}, {Key: "name", Value: strings.Repeat("x", i)}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		docs[i] = raw
+	}
+	return docs
+}
+
+// writeFile writes data to dir/name, gzipped if name ends with .gz
+func writeFile(t *testing.T, dir, name string, data []byte) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if strings.HasSuffix(name, ".gz") {
+		var b bytes.Buffer
+		zw := gzip.NewWriter(&b)
+		zw.Write(data)
+		zw.Close()
+		data = b.Bytes()
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReadBSON(t *testing.T) {
+	docs := testDocuments(t, 3)
+	data := bytes.Join([][]byte{docs[0], docs[1], docs[2]}, nil)
+
+	r := bufio.NewReader(bytes.NewReader(data))
+	for i, want := range docs {
+		got, err := readBSON(r)
+		if err != nil {
+			t.Fatalf("document %d: %v", i, err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("document %d = %v, want %v", i, got, want)
+		}
+	}
+	if _, err := readBSON(r); err != io.EOF {
+		t.Errorf("at the end: %v, want io.EOF", err)
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"truncated size", data[:2], "truncated document"},
+		{"truncated document", docs[0][:len(docs[0])-1], "truncated document"},
+		{"too small", []byte{4, 0, 0, 0}, "invalid document size 4"},
+		{"too large", []byte{0xff, 0xff, 0xff, 0x7f}, "invalid document size"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := readBSON(bufio.NewReader(bytes.NewReader(tt.data)))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("readBSON = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCountBSON(t *testing.T) {
+	dir := t.TempDir()
+	docs := testDocuments(t, 5)
+	data := bytes.Join([][]byte{docs[0], docs[1], docs[2], docs[3], docs[4]}, nil)
+
+	for _, name := range []string{"plain.bson", "zipped.bson.gz"} {
+		n, err := countBSON(writeFile(t, dir, name, data))
+		if err != nil || n != 5 {
+			t.Errorf("%s: countBSON = %d, %v, want 5", name, n, err)
+		}
+	}
+	if _, err := countBSON(writeFile(t, dir, "cut.bson", data[:len(data)-3])); err == nil {
+		t.Error("countBSON of a truncated file succeeded")
+	}
+}
+
+func TestReadDumpDir(t *testing.T) {
+	dir := t.TempDir()
+	meta := []byte(`{"options":{"capped":true,"size":{"$numberInt":"4096"}},"indexes":[],"collectionName":"logs","type":"collection"}`)
+	writeFile(t, dir, "logs.bson.gz", nil)
+	writeFile(t, dir, "logs.metadata.json.gz", meta)
+	writeFile(t, dir, "users.bson", nil)
+	writeFile(t, dir, "recent.metadata.json", []byte(`{"options":{"viewOn":"logs"},"indexes":[],"type":"view"}`))
+	writeFile(t, dir, "system.views.bson", nil)
+	writeFile(t, dir, "notes.txt", nil)
+
+	collections, err := readDumpDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, c := range collections {
+		names = append(names, c.name)
+	}
+	if want := []string{"logs", "recent", "users"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("collections = %v, want %v", names, want)
+	}
+
+	logs, recent, users := collections[0], collections[1], collections[2]
+	if logs.bsonPath != filepath.Join(dir, "logs.bson.gz") || valueOf(logs.metadata, "collectionName") != "logs" {
+		t.Errorf("logs = %+v", logs)
+	}
+	if recent.bsonPath != "" || valueOf(recent.metadata, "type") != "view" {
+		t.Errorf("recent = %+v", recent)
+	}
+	if users.bsonPath != filepath.Join(dir, "users.bson") || users.metadata != nil {
+		t.Errorf("users = %+v", users)
+	}
+
+	writeFile(t, dir, "broken.metadata.json", []byte(`{"options":`))
+	if _, err := readDumpDir(dir); err == nil || !strings.Contains(err.Error(), "broken.metadata.json") {
+		t.Errorf("readDumpDir with invalid metadata = %v", err)
+	}
+}
+
+func TestFindDumpDir(t *testing.T) {
+	root := t.TempDir()
+	mkdir := func(path ...string) string {
+		dir := filepath.Join(append([]string{root}, path...)...)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		return dir
+	}
+
+	flat := mkdir("flat")
+	writeFile(t, flat, "users.bson", nil)
+	single := mkdir("single")
+	shop := mkdir("single", "shop")
+	writeFile(t, shop, "orders.metadata.json.gz", []byte("{}"))
+	several := mkdir("several")
+	writeFile(t, mkdir("several", "a"), "x.bson", nil)
+	writeFile(t, mkdir("several", "b"), "y.bson.gz", nil)
+	empty := mkdir("empty")
+
+	tests := []struct {
+		name, source, want, err string
+	}{
+		{"files in source", flat, flat, ""},
+		{"one database directory", single, shop, ""},
+		{"several databases", several, "", "several databases (a, b)"},
+		{"no dump files", empty, "", "no .bson or .metadata.json files"},
+		{"missing", filepath.Join(root, "missing"), "", "failed to read dump"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := findDumpDir(tt.source)
+			switch {
+			case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+				t.Errorf("findDumpDir = %q, %v, want error %q", got, err, tt.err)
+			case tt.err == "" && (err != nil || got != tt.want):
+				t.Errorf("findDumpDir = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+// writeTestArchive writes an archive of the collections with their
+// documents; views get no documents
+func writeTestArchive(t *testing.T, w io.Writer, collections []archiveCollection, docs map[string][]bson.Raw) {
+	t.Helper()
+	archive := archiveWriter{w}
+	if err := archive.writePrelude(archiveHeader{ConcurrentCollections: 1, Version: archiveVersion}, collections); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range collections {
+		if c.Type == "view" {
+			continue
+		}
+		_, err := archive.writeNamespace(c.DB, c.Collection, func(out io.Writer) (int64, error) {
+			for _, doc := range docs[c.Collection] {
+				if _, err := out.Write(doc); err != nil {
+					return 0, err
+				}
+			}
+			return int64(len(docs[c.Collection])), nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestArchiveRoundTrip(t *testing.T) {
+	collections := []archiveCollection{
+		{DB: "shop", Collection: "orders", Metadata: `{"options":{},"indexes":[{"v":2,"key":{"_id":1},"name":"_id_"}],"type":"collection"}`, Type: "collection"},
+		{DB: "shop", Collection: "empty", Metadata: `{"options":{},"indexes":[],"type":"collection"}`, Type: "collection"},
+		{DB: "shop", Collection: "recent", Metadata: `{"options":{"viewOn":"orders"},"indexes":[],"type":"view"}`, Type: "view"},
+		{DB: "shop", Collection: "system.js", Type: "collection"},
+	}
+	docs := map[string][]bson.Raw{"orders": testDocuments(t, 4), "system.js": testDocuments(t, 1)}
+
+	var archive bytes.Buffer
+	writeTestArchive(t, &archive, collections, docs)
+
+	dir := t.TempDir()
+	for _, name := range []string{"shop.archive", "shop.archive.gz"} {
+		t.Run(name, func(t *testing.T) {
+			r, entries, err := openArchive(writeFile(t, dir, name, archive.Bytes()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Close()
+
+			source, dumped, err := archiveDatabase(entries)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var names []string
+			for _, c := range dumped {
+				names = append(names, c.name)
+			}
+			if want := []string{"empty", "orders", "recent"}; source != "shop" || !reflect.DeepEqual(names, want) {
+				t.Errorf("archiveDatabase = %q, %v, want shop, %v", source, names, want)
+			}
+			if valueOf(dumped[2].metadata, "type") != "view" {
+				t.Errorf("metadata of recent = %v", dumped[2].metadata)
+			}
+
+			read := map[string][]bson.Raw{}
+			var ended []string
+			err = eachArchiveDocument(r.Reader, func(ns archiveNamespace, raw bson.Raw) error {
+				read[ns.Collection] = append(read[ns.Collection], raw)
+				return nil
+			}, func(ns archiveNamespace) error {
+				ended = append(ended, ns.Collection)
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(read, docs) {
+				t.Errorf("documents = %v, want %v", read, docs)
+			}
+			if want := []string{"orders", "empty", "system.js"}; !reflect.DeepEqual(ended, want) {
+				t.Errorf("ended namespaces = %v, want %v", ended, want)
+			}
+		})
+	}
+}
+
+func TestArchiveErrors(t *testing.T) {
+	orders := []archiveCollection{{DB: "shop", Collection: "orders", Type: "collection"}}
+	docs := testDocuments(t, 2)
+	var valid bytes.Buffer
+	writeTestArchive(t, &valid, orders, map[string][]bson.Raw{"orders": docs})
+
+	corrupt := append([]byte(nil), valid.Bytes()...)
+	// The last byte of the second document's name
+	corrupt[bytes.LastIndex(corrupt, []byte("x\x00"))] = 'y'
+
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"not an archive", []byte("{}"), "not a mongodump archive"},
+		{"checksum", corrupt, "checksum mismatch in shop.orders"},
+		{"truncated document", valid.Bytes()[:bytes.LastIndex(valid.Bytes(), []byte("x\x00"))], "shop.orders: truncated document"},
+		{"truncated block", valid.Bytes()[:bytes.Index(valid.Bytes(), docs[1])], "truncated archive in shop.orders"},
+		{"truncated EOF header", valid.Bytes()[:valid.Len()-10], "invalid namespace header: truncated document"},
+	}
+	dir := t.TempDir()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, _, err := openArchive(writeFile(t, dir, tt.name, tt.data))
+			if err == nil {
+				err = eachArchiveDocument(r.Reader, func(archiveNamespace, bson.Raw) error { return nil }, nil)
+				r.Close()
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("reading = %v, want %q", err, tt.want)
+			}
+		})
+	}
+
+	_, _, err := archiveDatabase([]archiveCollection{{DB: "a", Collection: "x"}, {DB: "b", Collection: "y"}})
+	if err == nil || !strings.Contains(err.Error(), "several databases (a, b)") {
+		t.Errorf("archiveDatabase of two databases = %v", err)
+	}
+}
@@ -0,0 +1,104 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"syscall"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/topology"
+)
+
+// Kinds of connection errors reported by ClassifyError
+const (
+	ErrKindDNS             = "DNS failure"
+	ErrKindRefused         = "Connection refused"
+	ErrKindTimeout         = "Timeout"
+	ErrKindAuth            = "Authentication failed"
+	ErrKindTLS             = "TLS error"
+	ErrKindSSH             = "SSH tunnel error"
+	ErrKindServerSelection = "Server selection error"
+	ErrKindOther           = "Error"
+)
+
+// authFailedCode is the server error code for failed authentication
+const authFailedCode = 18
+
+// ClassifyError returns the kind of a connection error and a readable message.
+// Server selection errors are classified by the last error of the servers they
+// tried, which is the real cause (e.g. a refused connection).
+func ClassifyError(err error) (kind, message string) {
+	if err == nil {
+		return "", ""
+	}
+
+	var selErr topology.ServerSelectionError
+	if errors.As(err, &selErr) {
+		lastErr := ""
+		for _, s := range selErr.Desc.Servers {
+			if s.LastError == nil {
+				continue
+			}
+			kind, message := classifyCause(s.LastError)
+			if kind != ErrKindOther {
+				return kind, s.Addr.String() + ": " + message
+			}
+			if lastErr == "" {
+				lastErr = s.Addr.String() + ": " + message
+			}
+		}
+		switch {
+		case len(selErr.Desc.Servers) == 0:
+			return ErrKindServerSelection, "no servers found for the connection string"
+		case lastErr != "":
+			return ErrKindServerSelection, "no usable server, last error: " + lastErr
+		case errors.Is(err, context.DeadlineExceeded):
+			return ErrKindTimeout, "no server answered in time (check the host, port and firewall)"
+		}
+		return ErrKindServerSelection, "no suitable server found: " + selErr.Desc.String()
+	}
+
+	return classifyCause(err)
+}
+
+// classifyCause classifies a single (non server selection) error
+func classifyCause(err error) (string, string) {
+	msg := err.Error()
+
+	if tlsMsg := describeTLSError(err); tlsMsg != "" {
+		return ErrKindTLS, tlsMsg
+	}
+
+	if strings.HasPrefix(msg, "SSH ") || strings.Contains(msg, "ssh-agent") || strings.Contains(msg, "known_hosts") {
+		return ErrKindSSH, msg
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && !dnsErr.IsTimeout {
+		return ErrKindDNS, "cannot resolve host " + dnsErr.Name
+	}
+	if strings.Contains(msg, "no such host") {
+		return ErrKindDNS, msg
+	}
+
+	if errors.Is(err, syscall.ECONNREFUSED) || strings.Contains(msg, "connection refused") {
+		return ErrKindRefused, "nothing is listening on the server port (is the server running, and is the port right?)"
+	}
+
+	var cmdErr mongo.CommandError
+	if errors.As(err, &cmdErr) && cmdErr.Code == authFailedCode {
+		return ErrKindAuth, "wrong user name, password or auth source"
+	}
+	if strings.Contains(msg, "auth error") || strings.Contains(msg, "AuthenticationFailed") || strings.Contains(msg, "Authentication failed") {
+		return ErrKindAuth, "wrong user name, password or auth source: " + msg
+	}
+
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) || strings.Contains(msg, "i/o timeout") {
+		return ErrKindTimeout, "the server did not answer in time (check the host, port and firewall)"
+	}
+
+	return ErrKindOther, msg
+}
@@ -0,0 +1,174 @@
+package db
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/ksiezykm/FerretMate/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ExportFormat is the layout of a streamed export file
+type ExportFormat string
+
+const (
+	FormatJSONLines ExportFormat = "jsonl" // one document per line
+	FormatJSONArray ExportFormat = "json"  // a JSON array of documents
+)
+
+// ExportOptions select the documents and the file layout of StreamExport
+type ExportOptions struct {
+	Format ExportFormat
+	Gzip   bool
+	Query  model.Query // filter, projection and sort; empty exports everything
+}
+
+// Extension returns the file extension of the export, e.g. ".jsonl.gz"
+func (o ExportOptions) Extension() string {
+	ext := "." + string(o.Format)
+	if o.Gzip {
+		ext += ".gz"
+	}
+	return ext
+}
+
+// StreamExport writes the documents of a collection matching the query to a
+// single file as relaxed Extended JSON: one document per line for
+// FormatJSONLines, or a single JSON array of documents for FormatJSONArray,
+// gzipped if opts.Gzip is set. The file is written to a temporary file next
+// to filePath and renamed on success, so an interrupted export never leaves a
+// partial file behind. There is no deadline: the export runs until done or
+// until ctx is cancelled. progress receives the documents written out of the
+// estimated total (0 if unknown). It returns the number of documents written.
+func StreamExport(ctx context.Context, client *mongo.Client, dbName, collName, filePath string, opts ExportOptions, progress func(done, total int64)) (int64, error) {
+	filter, err := queryFilter(opts.Query)
+	if err != nil {
+		return 0, err
+	}
+	findOpts, err := findOptions(opts.Query)
+	if err != nil {
+		return 0, err
+	}
+
+	coll := client.Database(dbName).Collection(collName)
+	total := estimateCount(coll, filter)
+	if total < 0 {
+		total = 0
+	}
+
+	cursor, err := coll.Find(ctx, filter, findOpts)
+	if err != nil {
+		return 0, fmt.Errorf("failed to find documents: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var count int64
+	err = writeExportFile(filePath, opts.Gzip, func(out io.Writer) error {
+		var err error
+		count, err = writeDocuments(ctx, cursor, out, opts.Format, func(done int64) {
+			progress(done, total)
+		})
+		return err
+	})
+	return count, err
+}
+
+// writeExportFile creates filePath with the output of write, optionally
+// gzip-compressed. The output goes to a temporary file next to filePath that
+// is renamed on success and removed on failure.
+func writeExportFile(filePath string, compress bool, write func(out io.Writer) error) error {
+	dir := filepath.Dir(filePath)
+	if err := createDirIfNotExists(dir); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(filePath)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+	defer func() {
+		// Only left over when the export failed
+		tmp.Close()
+		os.Remove(tmp.Name())
+	}()
+
+	buffered := bufio.NewWriter(tmp)
+	var out io.Writer = buffered
+	var zipped *gzip.Writer
+	if compress {
+		zipped = gzip.NewWriter(buffered)
+		out = zipped
+	}
+	if err := write(out); err != nil {
+		return err
+	}
+
+	if zipped != nil {
+		if err := zipped.Close(); err != nil {
+			return fmt.Errorf("failed to write to file: %w", err)
+		}
+	}
+	if err := buffered.Flush(); err != nil {
+		return fmt.Errorf("failed to write to file: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		return fmt.Errorf("failed to write to file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write to file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), filePath); err != nil {
+		return fmt.Errorf("failed to rename export file: %w", err)
+	}
+	return nil
+}
+
+// writeDocuments writes the documents of a cursor in the given format and
+// returns the number written
+func writeDocuments(ctx context.Context, cursor *mongo.Cursor, out io.Writer, format ExportFormat, written func(done int64)) (int64, error) {
+	write := func(parts ...[]byte) error {
+		for _, p := range parts {
+			if _, err := out.Write(p); err != nil {
+				return fmt.Errorf("failed to write to file: %w", err)
+			}
+		}
+		return nil
+	}
+
+	var count int64
+	for cursor.Next(ctx) {
+		line, err := bson.MarshalExtJSON(cursor.Current, false, false)
+		if err != nil {
+			return count, fmt.Errorf("failed to marshal document: %w", err)
+		}
+		switch {
+		case format == FormatJSONLines:
+			err = write(line, []byte("\n"))
+		case count == 0:
+			err = write([]byte("[\n"), line)
+		default:
+			err = write([]byte(",\n"), line)
+		}
+		if err != nil {
+			return count, err
+		}
+		count++
+		written(count)
+	}
+	if err := cursor.Err(); err != nil {
+		return count, fmt.Errorf("failed to read documents: %w", err)
+	}
+
+	if format == FormatJSONArray {
+		if count == 0 {
+			return 0, write([]byte("[]\n"))
+		}
+		return count, write([]byte("\n]\n"))
+	}
+	return count, nil
+}
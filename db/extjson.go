@@ -0,0 +1,165 @@
+package db
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// FormatDocument renders a raw BSON document as indented canonical Extended JSON.
+// Canonical mode keeps every BSON type (int64, dates, Decimal128, binary...) intact,
+// so parsing the output with ParseDocument gives back the exact same bytes.
+func FormatDocument(raw bson.Raw) (string, error) {
+	out, err := bson.MarshalExtJSONIndent(raw, true, false, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+// ParseError is a JSON syntax error with its position in the input
+type ParseError struct {
+	Line   int // 1-based line of the error
+	Column int // 1-based column of the error
+	Err    error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("line %d, column %d: %v", e.Line, e.Column, e.Err)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// newParseError converts a byte offset in text into a line/column ParseError
+func newParseError(text string, offset int64, err error) *ParseError {
+	if offset > int64(len(text)) {
+		offset = int64(len(text))
+	}
+	before := text[:offset]
+	line := strings.Count(before, "\n") + 1
+	column := len([]rune(before[strings.LastIndex(before, "\n")+1:]))
+	if column < 1 {
+		column = 1
+	}
+	return &ParseError{Line: line, Column: column, Err: err}
+}
+
+// ParseDocument parses canonical or relaxed Extended JSON into an ordered document.
+// Syntax errors are reported as *ParseError with the line and column of the problem.
+func ParseDocument(docJSON string) (bson.D, error) {
+	// Check the plain JSON syntax first, as it reports where the error is
+	var syntax json.RawMessage
+	if err := json.Unmarshal([]byte(docJSON), &syntax); err != nil {
+		var syntaxErr *json.SyntaxError
+		if errors.As(err, &syntaxErr) {
+			return nil, newParseError(docJSON, syntaxErr.Offset, err)
+		}
+		return nil, err
+	}
+
+	var doc bson.D
+	if err := bson.UnmarshalExtJSON([]byte(docJSON), false, &doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// parseDocuments parses Extended JSON holding either a single document or an
+// array of documents, as written by an export or an upload file. A plain
+// 24-hex string _id is read as an ObjectId, as older exports wrote them so.
+func parseDocuments(data []byte) ([]bson.D, error) {
+	var items []json.RawMessage
+	if err := json.Unmarshal(data, &items); err != nil {
+		doc, err := ParseDocument(string(data))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse JSON (not a valid object or array): %w", err)
+		}
+		legacyObjectID(doc)
+		return []bson.D{doc}, nil
+	}
+
+	docs := make([]bson.D, 0, len(items))
+	for i, item := range items {
+		doc, err := ParseDocument(string(item))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse document %d: %w", i, err)
+		}
+		legacyObjectID(doc)
+		docs = append(docs, doc)
+	}
+	return docs, nil
+}
+
+// legacyObjectID turns a plain 24-hex string _id into the ObjectId it was
+// exported from, so that the document matches the original again
+func legacyObjectID(doc bson.D) {
+	for i, e := range doc {
+		if e.Key != "_id" {
+			continue
+		}
+		if s, ok := e.Value.(string); ok && len(s) == 24 {
+			if oid, err := primitive.ObjectIDFromHex(s); err == nil {
+				doc[i].Value = oid
+			}
+		}
+		return
+	}
+}
+
+// documentID returns the _id value of a document
+func documentID(doc bson.D) (interface{}, bool) {
+	for _, e := range doc {
+		if e.Key == "_id" {
+			return e.Value, true
+		}
+	}
+	return nil, false
+}
+
+// sameValue reports whether two values encode to the same BSON type and bytes
+func sameValue(a, b interface{}) bool {
+	ta, da, err := bson.MarshalValue(a)
+	if err != nil {
+		return false
+	}
+	tb, db, err := bson.MarshalValue(b)
+	if err != nil {
+		return false
+	}
+	return ta == tb && bytes.Equal(da, db)
+}
+
+// IDFileName turns a document _id into a safe file name (without extension).
+// ObjectIDs use their hex form, strings are used as-is and any other type
+// is rendered as Extended JSON.
+func IDFileName(id interface{}) string {
+	var name string
+	switch v := id.(type) {
+	case primitive.ObjectID:
+		name = v.Hex()
+	case string:
+		name = v
+	default:
+		t, data, err := bson.MarshalValue(id)
+		if err != nil {
+			name = fmt.Sprintf("%v", id)
+			break
+		}
+		name = bson.RawValue{Type: t, Value: data}.String()
+	}
+
+	// Clean filename from invalid characters
+	replacer := strings.NewReplacer("/", "_", "\\", "_", ":", "_", "\"", "", "*", "_", "?", "_", "<", "_", ">", "_", "|", "_")
+	name = replacer.Replace(name)
+	if name == "" || name == "." || name == ".." {
+		name = "_"
+	}
+	return name
+}
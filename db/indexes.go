@@ -0,0 +1,156 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ksiezykm/FerretMate/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// IndexSpec describes an index to create
+type IndexSpec struct {
+	Keys          bson.D
+	Name          string // generated by the server when empty
+	Unique        bool
+	Sparse        bool
+	TTL           *int32 // expireAfterSeconds, nil for no TTL
+	PartialFilter bson.D // nil for no partial filter
+}
+
+// ListIndexes returns the indexes of a collection
+func ListIndexes(client *mongo.Client, dbName, collName string) ([]model.Index, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cursor, err := client.Database(dbName).Collection(collName).Indexes().List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var indexes []model.Index
+	for cursor.Next(ctx) {
+		index, err := newIndex(cursor.Current)
+		if err != nil {
+			return nil, err
+		}
+		indexes = append(indexes, index)
+	}
+	return indexes, cursor.Err()
+}
+
+// newIndex reads a listIndexes entry
+func newIndex(raw bson.Raw) (model.Index, error) {
+	var index model.Index
+	if err := raw.Lookup("name").Unmarshal(&index.Name); err != nil {
+		return index, fmt.Errorf("index without a name: %w", err)
+	}
+	if keys, ok := raw.Lookup("key").DocumentOK(); ok {
+		index.Keys = singleLineJSON(keys)
+	}
+	index.Unique, _ = raw.Lookup("unique").BooleanOK()
+	index.Sparse, _ = raw.Lookup("sparse").BooleanOK()
+	if ttl, ok := raw.Lookup("expireAfterSeconds").AsInt64OK(); ok {
+		index.TTL = &ttl
+	}
+	if filter, ok := raw.Lookup("partialFilterExpression").DocumentOK(); ok {
+		index.PartialFilter = singleLineJSON(filter)
+	}
+
+	spec, err := FormatDocument(raw)
+	if err != nil {
+		return index, err
+	}
+	index.Spec = spec
+	return index, nil
+}
+
+// singleLineJSON renders a document as compact relaxed Extended JSON
+func singleLineJSON(raw bson.Raw) string {
+	out, err := bson.MarshalExtJSON(raw, false, false)
+	if err != nil {
+		return raw.String()
+	}
+	return string(out)
+}
+
+// ParseIndexKeys parses an index key document in mongo-shell syntax, e.g.
+// {name: 1, age: -1} or, without braces, name: 1, age: -1. Every key must be
+// 1, -1 or an index type such as "text", "hashed" or "2dsphere".
+func ParseIndexKeys(text string) (bson.D, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return nil, fmt.Errorf("at least one key is required")
+	}
+	if !strings.HasPrefix(text, "{") {
+		text = "{" + text + "}"
+	}
+	keys, err := ParseShellDocument(text)
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("at least one key is required")
+	}
+
+	for _, k := range keys {
+		switch v := k.Value.(type) {
+		case int32:
+			if v == 1 || v == -1 {
+				continue
+			}
+		case int64:
+			if v == 1 || v == -1 {
+				continue
+			}
+		case float64:
+			if v == 1 || v == -1 {
+				continue
+			}
+		case string:
+			if v != "" {
+				continue
+			}
+		}
+		return nil, fmt.Errorf("key '%s' must be 1, -1 or an index type", k.Key)
+	}
+	return keys, nil
+}
+
+// CreateIndex creates an index and returns its name. Cancelling ctx abandons
+// the wait; the server may still finish building the index.
+func CreateIndex(ctx context.Context, client *mongo.Client, dbName, collName string, spec IndexSpec) (string, error) {
+	opts := options.Index()
+	if spec.Name != "" {
+		opts.SetName(spec.Name)
+	}
+	if spec.Unique {
+		opts.SetUnique(true)
+	}
+	if spec.Sparse {
+		opts.SetSparse(true)
+	}
+	if spec.TTL != nil {
+		opts.SetExpireAfterSeconds(*spec.TTL)
+	}
+	if spec.PartialFilter != nil {
+		opts.SetPartialFilterExpression(spec.PartialFilter)
+	}
+
+	coll := client.Database(dbName).Collection(collName)
+	return coll.Indexes().CreateOne(ctx, mongo.IndexModel{Keys: spec.Keys, Options: opts})
+}
+
+// DropIndex drops an index by name
+func DropIndex(client *mongo.Client, dbName, collName, name string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := client.Database(dbName).Collection(collName).Indexes().DropOne(ctx, name)
+	return err
+}
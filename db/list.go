@@ -2,12 +2,13 @@ package db
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"strings"
 	"time"
 
+	"github.com/ksiezykm/FerretMate/model"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -16,7 +17,11 @@ import (
 func ListDatabases(client *mongo.Client) ([]string, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
+	return ListDatabasesContext(ctx, client)
+}
 
+// ListDatabasesContext lists the databases until done or until ctx is cancelled
+func ListDatabasesContext(ctx context.Context, client *mongo.Client) ([]string, error) {
 	result, err := client.ListDatabaseNames(ctx, bson.M{})
 	if err != nil {
 		return nil, err
@@ -27,7 +32,12 @@ func ListDatabases(client *mongo.Client) ([]string, error) {
 func ListCollections(client *mongo.Client, dbName string) ([]string, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
+	return ListCollectionsContext(ctx, client, dbName)
+}
 
+// ListCollectionsContext lists the collections of a database until done or
+// until ctx is cancelled
+func ListCollectionsContext(ctx context.Context, client *mongo.Client, dbName string) ([]string, error) {
 	db := client.Database(dbName)
 	result, err := db.ListCollectionNames(ctx, bson.M{})
 	if err != nil {
@@ -36,54 +46,60 @@ func ListCollections(client *mongo.Client, dbName string) ([]string, error) {
 	return result, nil
 }
 
-type Document struct {
-	ID      interface{}
-	JSON    string
-	Summary string
-}
-
-func ListDocuments(client *mongo.Client, dbName, collName string) ([]Document, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	coll := client.Database(dbName).Collection(collName)
-	cursor, err := coll.Find(ctx, bson.M{})
-	if err != nil {
-		return nil, err
+// newDocument builds a list entry (its _id and a display summary) from a raw document
+func newDocument(raw bson.Raw, query model.Query) (model.Document, error) {
+	var docID interface{}
+	if err := raw.Lookup("_id").Unmarshal(&docID); err != nil {
+		return model.Document{}, err
 	}
-	defer cursor.Close(ctx)
+	summary := ""
 
-	var docs []Document
-	for cursor.Next(ctx) {
-		var doc bson.M
-		if err := cursor.Decode(&doc); err != nil {
-			continue
+	// Display _id as summary
+	if idStr, ok := docID.(string); ok {
+		summary = idStr
+	} else {
+		summary = fmt.Sprintf("%v", docID)
+		if len(summary) > 50 {
+			summary = summary[:50] + "..."
 		}
-		jsonBytes, err := json.MarshalIndent(doc, "", "  ")
-		if err != nil {
-			continue
+	}
+
+	// With a projection, show the projected fields next to the _id
+	if strings.TrimSpace(query.Projection) != "" {
+		if fields := projectedFields(raw); fields != "" {
+			summary += "  " + fields
 		}
+	}
 
-		docID := doc["_id"]
-		summary := ""
+	return model.Document{
+		ID:      docID,
+		Summary: summary,
+	}, nil
+}
 
-		// Display _id as summary
-		if idStr, ok := docID.(string); ok {
-			summary = idStr
-		} else {
-			summary = fmt.Sprintf("%v", docID)
-			if len(summary) > 50 {
-				summary = summary[:50] + "..."
-			}
+// projectedFields renders all fields except _id as compact relaxed Extended JSON
+func projectedFields(raw bson.Raw) string {
+	var doc bson.D
+	if err := bson.Unmarshal(raw, &doc); err != nil {
+		return ""
+	}
+	var rest bson.D
+	for _, e := range doc {
+		if e.Key != "_id" {
+			rest = append(rest, e)
 		}
-
-		docs = append(docs, Document{
-			ID:      docID,
-			JSON:    string(jsonBytes),
-			Summary: summary,
-		})
 	}
-	return docs, nil
+	if len(rest) == 0 {
+		return ""
+	}
+	out, err := bson.MarshalExtJSON(rest, false, false)
+	if err != nil {
+		return ""
+	}
+	if len(out) > 120 {
+		return string(out[:120]) + "..."
+	}
+	return string(out)
 }
 
 func GetDocument(client *mongo.Client, dbName, collName string, docID interface{}) (string, error) {
@@ -91,68 +107,74 @@ func GetDocument(client *mongo.Client, dbName, collName string, docID interface{
 	defer cancel()
 
 	coll := client.Database(dbName).Collection(collName)
-	var doc bson.M
-	err := coll.FindOne(ctx, bson.M{"_id": docID}).Decode(&doc)
+	raw, err := coll.FindOne(ctx, bson.M{"_id": docID}).Raw()
 	if err != nil {
 		return "", err
 	}
 
-	jsonBytes, err := json.MarshalIndent(doc, "", "  ")
-	if err != nil {
-		return "", err
-	}
-	return string(jsonBytes), nil
+	return FormatDocument(raw)
 }
 
-func UpdateDocument(client *mongo.Client, dbName, collName string, docJSON string) error {
+// UpdateDocument replaces the document identified by docID with the edited Extended JSON.
+// The _id inside the edited JSON must still match docID. snapshot is the document as it
+// was when opened (as returned by GetDocument); if the stored document differs from it,
+// nothing is written and a *ConflictError with the current version is returned.
+func UpdateDocument(client *mongo.Client, dbName, collName string, docID interface{}, snapshot, docJSON string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	var doc bson.M
-	if err := json.Unmarshal([]byte(docJSON), &doc); err != nil {
+	doc, err := ParseDocument(docJSON)
+	if err != nil {
 		return fmt.Errorf("failed to parse JSON: %w", err)
 	}
 
-	rawID, ok := doc["_id"]
+	editedID, ok := documentID(doc)
 	if !ok {
 		return fmt.Errorf("document has no _id field")
 	}
+	if !sameValue(editedID, docID) {
+		return fmt.Errorf("_id cannot be changed (was %v, now %v)", docID, editedID)
+	}
 
-	// Convert _id to proper type if it's an ObjectID string
-	var docID interface{}
-	if idMap, ok := rawID.(map[string]interface{}); ok {
-		if oidStr, ok := idMap["$oid"].(string); ok {
-			// Handle {"$oid": "..."} format
-			oid, err := primitive.ObjectIDFromHex(oidStr)
-			if err != nil {
-				docID = rawID
-			} else {
-				docID = oid
-			}
-		} else {
-			docID = rawID
+	original, err := ParseDocument(snapshot)
+	if err != nil {
+		return fmt.Errorf("failed to parse snapshot: %w", err)
+	}
+
+	coll := client.Database(dbName).Collection(collName)
+
+	// Compare the stored version with the snapshot first
+	conflict := func() error {
+		raw, err := coll.FindOne(ctx, bson.M{"_id": docID}).Raw()
+		if err == mongo.ErrNoDocuments {
+			return &ConflictError{Deleted: true}
 		}
-	} else if idStr, ok := rawID.(string); ok {
-		// Handle plain string format
-		oid, err := primitive.ObjectIDFromHex(idStr)
 		if err != nil {
-			docID = rawID
-		} else {
-			docID = oid
+			return fmt.Errorf("failed to read document: %w", err)
 		}
-	} else {
-		docID = rawID
+		if sameSnapshot(raw, snapshot) {
+			return nil
+		}
+		theirs, err := FormatDocument(raw)
+		if err != nil {
+			return err
+		}
+		return &ConflictError{Theirs: theirs}
+	}
+	if err := conflict(); err != nil {
+		return err
 	}
 
-	delete(doc, "_id")
-
-	coll := client.Database(dbName).Collection(collName)
-	result, err := coll.ReplaceOne(ctx, bson.M{"_id": docID}, doc)
+	// Replace with the full original as the filter, so a change made in between is not lost
+	result, err := coll.ReplaceOne(ctx, snapshotFilter(original), doc)
 	if err != nil {
 		return fmt.Errorf("failed to replace document: %w", err)
 	}
 
 	if result.MatchedCount == 0 {
+		if err := conflict(); err != nil {
+			return err
+		}
 		return fmt.Errorf("no document found with _id: %v", docID)
 	}
 
@@ -204,26 +226,27 @@ func CreateDocument(client *mongo.Client, dbName, collName, docJSON string) erro
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	var doc bson.M
-	if err := json.Unmarshal([]byte(docJSON), &doc); err != nil {
+	doc, err := ParseDocument(docJSON)
+	if err != nil {
 		return fmt.Errorf("failed to parse JSON: %w", err)
 	}
 
-	// Generate new ObjectID if _id is not provided or is in template format
-	if rawID, ok := doc["_id"]; ok {
-		if idMap, ok := rawID.(map[string]interface{}); ok {
-			if _, hasOid := idMap["$oid"]; hasOid {
-				// Replace template ObjectID with new one
-				doc["_id"] = primitive.NewObjectID()
+	// Generate new ObjectID if _id is not provided or is the zero template ObjectID
+	if rawID, ok := documentID(doc); ok {
+		if oid, ok := rawID.(primitive.ObjectID); ok && oid.IsZero() {
+			for i := range doc {
+				if doc[i].Key == "_id" {
+					doc[i].Value = primitive.NewObjectID()
+				}
 			}
 		}
 	} else {
 		// No _id provided, generate one
-		doc["_id"] = primitive.NewObjectID()
+		doc = append(bson.D{{Key: "_id", Value: primitive.NewObjectID()}}, doc...)
 	}
 
 	coll := client.Database(dbName).Collection(collName)
-	_, err := coll.InsertOne(ctx, doc)
+	_, err = coll.InsertOne(ctx, doc)
 	if err != nil {
 		return fmt.Errorf("failed to insert document: %w", err)
 	}
@@ -282,13 +305,12 @@ func ExportDocument(client *mongo.Client, dbName, collName string, docID interfa
 	defer cancel()
 
 	coll := client.Database(dbName).Collection(collName)
-	var doc bson.M
-	err := coll.FindOne(ctx, bson.M{"_id": docID}).Decode(&doc)
+	raw, err := coll.FindOne(ctx, bson.M{"_id": docID}).Raw()
 	if err != nil {
 		return fmt.Errorf("failed to find document: %w", err)
 	}
 
-	jsonBytes, err := json.MarshalIndent(doc, "", "  ")
+	jsonText, err := FormatDocument(raw)
 	if err != nil {
 		return fmt.Errorf("failed to marshal document: %w", err)
 	}
@@ -308,7 +330,7 @@ func ExportDocument(client *mongo.Client, dbName, collName string, docID interfa
 	}
 	defer file.Close()
 
-	_, err = file.Write(jsonBytes)
+	_, err = file.WriteString(jsonText)
 	if err != nil {
 		return fmt.Errorf("failed to write to file: %w", err)
 	}
@@ -316,77 +338,85 @@ func ExportDocument(client *mongo.Client, dbName, collName string, docID interfa
 	return nil
 }
 
-// ExportCollection exports all documents from a collection to a directory
-func ExportCollection(client *mongo.Client, dbName, collName, dirPath string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
+// ExportCollection exports all documents from a collection to a directory,
+// one file per document. progress receives the documents written out of
+// the estimated total.
+func ExportCollection(ctx context.Context, client *mongo.Client, dbName, collName, dirPath string, progress func(done, total int64)) error {
+	coll := client.Database(dbName).Collection(collName)
+	total, err := coll.EstimatedDocumentCount(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to count documents: %w", err)
+	}
 
+	count, err := exportDocuments(ctx, coll, dirPath, func(done int64) {
+		progress(done, total)
+	})
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return fmt.Errorf("no documents exported")
+	}
+	return nil
+}
+
+// exportDocuments writes each document of a collection to its own file in
+// dirPath and returns the number written
+func exportDocuments(ctx context.Context, coll *mongo.Collection, dirPath string, written func(done int64)) (int64, error) {
 	// Create directory
 	if err := createDirIfNotExists(dirPath); err != nil {
-		return err
+		return 0, err
 	}
 
-	coll := client.Database(dbName).Collection(collName)
 	cursor, err := coll.Find(ctx, bson.M{})
 	if err != nil {
-		return fmt.Errorf("failed to find documents: %w", err)
+		return 0, fmt.Errorf("failed to find documents: %w", err)
 	}
 	defer cursor.Close(ctx)
 
-	count := 0
+	var count int64
 	for cursor.Next(ctx) {
-		var doc bson.M
-		if err := cursor.Decode(&doc); err != nil {
-			continue
-		}
-
 		// Generate filename based on _id or index
 		var filename string
-		if id, ok := doc["_id"]; ok {
-			filename = fmt.Sprintf("%v.json", id)
-			// Clean filename from invalid characters
-			filename = strings.ReplaceAll(filename, "/", "_")
-			filename = strings.ReplaceAll(filename, "\\", "_")
-			filename = strings.ReplaceAll(filename, ":", "_")
+		if id, err := cursor.Current.LookupErr("_id"); err == nil {
+			var idValue interface{}
+			id.Unmarshal(&idValue)
+			filename = IDFileName(idValue) + ".json"
 		} else {
 			filename = fmt.Sprintf("doc_%d.json", count)
 		}
 
-		jsonBytes, err := json.MarshalIndent(doc, "", "  ")
+		jsonText, err := FormatDocument(cursor.Current)
 		if err != nil {
 			continue
 		}
 
 		filePath := fmt.Sprintf("%s/%s", dirPath, filename)
-		file, err := os.Create(filePath)
-		if err != nil {
-			continue
+		if err := os.WriteFile(filePath, []byte(jsonText), 0644); err != nil {
+			return count, fmt.Errorf("failed to write to file: %w", err)
 		}
-
-		file.Write(jsonBytes)
-		file.Close()
 		count++
+		written(count)
 	}
-
-	if count == 0 {
-		return fmt.Errorf("no documents exported")
+	if err := cursor.Err(); err != nil {
+		return count, fmt.Errorf("failed to read documents: %w", err)
 	}
-
-	return nil
+	return count, nil
 }
 
-// ExportDatabase exports all collections from a database to a directory structure
-func ExportDatabase(client *mongo.Client, dbName, dirPath string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
-	defer cancel()
-
+// ExportDatabase exports all collections from a database to a directory
+// structure. progress receives the documents written out of the estimated
+// total of all collections. A collection that fails does not stop the
+// others; the failures are returned together.
+func ExportDatabase(ctx context.Context, client *mongo.Client, dbName, dirPath string, progress func(done, total int64)) error {
 	// Create base directory
 	if err := createDirIfNotExists(dirPath); err != nil {
 		return err
 	}
 
 	// Get all collections
-	collections, err := client.Database(dbName).ListCollectionNames(ctx, bson.M{})
+	database := client.Database(dbName)
+	collections, err := database.ListCollectionNames(ctx, bson.M{})
 	if err != nil {
 		return fmt.Errorf("failed to list collections: %w", err)
 	}
@@ -395,15 +425,35 @@ func ExportDatabase(client *mongo.Client, dbName, dirPath string) error {
 		return fmt.Errorf("no collections found in database")
 	}
 
+	var total int64
+	for _, collName := range collections {
+		n, err := database.Collection(collName).EstimatedDocumentCount(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to count documents of %s: %w", collName, err)
+		}
+		total += n
+	}
+
 	// Export each collection
+	var done int64
+	var failed []error
 	for _, collName := range collections {
 		collPath := fmt.Sprintf("%s/%s", dirPath, collName)
-		if err := ExportCollection(client, dbName, collName, collPath); err != nil {
-			// Log error but continue with other collections
-			fmt.Printf("Warning: failed to export collection %s: %v\n", collName, err)
+		count, err := exportDocuments(ctx, database.Collection(collName), collPath, func(n int64) {
+			progress(done+n, total)
+		})
+		done += count
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			failed = append(failed, fmt.Errorf("%s: %w", collName, err))
 		}
 	}
 
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to export %d of %d collections: %w", len(failed), len(collections), errors.Join(failed...))
+	}
 	return nil
 }
 
@@ -417,81 +467,52 @@ func createDirIfNotExists(dir string) error {
 	return nil
 }
 
-// UploadDocument uploads document(s) from a JSON file to MongoDB
+// uploadBatchSize is the number of documents inserted at once by UploadDocument
+const uploadBatchSize = 1000
+
+// UploadDocument uploads document(s) from an Extended JSON file to MongoDB
 // Supports both single document (object) and multiple documents (array)
 // If a document doesn't have an _id, MongoDB will automatically generate one
-func UploadDocument(client *mongo.Client, dbName, collName, filePath string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-
+// Documents are inserted in batches; progress receives the documents inserted
+func UploadDocument(ctx context.Context, client *mongo.Client, dbName, collName, filePath string, progress func(done, total int64)) error {
 	// Read the JSON file
 	jsonBytes, err := os.ReadFile(filePath)
 	if err != nil {
 		return fmt.Errorf("failed to read file: %w", err)
 	}
 
-	coll := client.Database(dbName).Collection(collName)
-
-	// Try to parse as array first
-	var docArray []bson.M
-	if err := json.Unmarshal(jsonBytes, &docArray); err == nil {
-		// It's an array of documents
-		if len(docArray) == 0 {
-			return fmt.Errorf("empty document array")
-		}
+	docs, err := parseDocuments(jsonBytes)
+	if err != nil {
+		return err
+	}
+	if len(docs) == 0 {
+		return fmt.Errorf("empty document array")
+	}
 
-		// Process each document
-		var docs []interface{}
-		for _, doc := range docArray {
-			processDocumentID(&doc)
-			docs = append(docs, doc)
-		}
+	coll := client.Database(dbName).Collection(collName)
+	total := int64(len(docs))
 
-		// Insert all documents
-		_, err := coll.InsertMany(ctx, docs)
-		if err != nil {
-			return fmt.Errorf("failed to insert documents: %w", err)
+	if len(docs) == 1 {
+		// Insert the single document
+		if _, err := coll.InsertOne(ctx, docs[0]); err != nil {
+			return fmt.Errorf("failed to insert document: %w", err)
 		}
-
+		progress(1, total)
 		return nil
 	}
 
-	// Not an array, try to parse as single document
-	var doc bson.M
-	if err := json.Unmarshal(jsonBytes, &doc); err != nil {
-		return fmt.Errorf("failed to parse JSON (not a valid object or array): %w", err)
-	}
-
-	// Process the document's _id
-	processDocumentID(&doc)
-
-	// Insert the single document
-	_, err = coll.InsertOne(ctx, doc)
-	if err != nil {
-		return fmt.Errorf("failed to insert document: %w", err)
+	// Insert all documents, one batch at a time
+	for start := 0; start < len(docs); start += uploadBatchSize {
+		end := min(start+uploadBatchSize, len(docs))
+		many := make([]interface{}, 0, end-start)
+		for _, doc := range docs[start:end] {
+			many = append(many, doc)
+		}
+		if _, err := coll.InsertMany(ctx, many); err != nil {
+			return fmt.Errorf("failed to insert documents after %d of %d: %w", start, total, err)
+		}
+		progress(int64(end), total)
 	}
 
 	return nil
 }
-
-// processDocumentID converts _id field to proper ObjectID format if needed
-func processDocumentID(doc *bson.M) {
-	if rawID, ok := (*doc)["_id"]; ok {
-		if idMap, ok := rawID.(map[string]interface{}); ok {
-			if oidStr, ok := idMap["$oid"].(string); ok {
-				// Convert {"$oid": "..."} format to ObjectID
-				oid, err := primitive.ObjectIDFromHex(oidStr)
-				if err == nil {
-					(*doc)["_id"] = oid
-				}
-			}
-		} else if idStr, ok := rawID.(string); ok {
-			// Try to convert plain string to ObjectID
-			oid, err := primitive.ObjectIDFromHex(idStr)
-			if err == nil {
-				(*doc)["_id"] = oid
-			}
-		}
-	}
-	// If no _id is present, MongoDB will automatically generate one during insert
-}
@@ -0,0 +1,133 @@
+package db
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/ksiezykm/FerretMate/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// DocumentPageSize is the number of documents loaded per page
+const DocumentPageSize = 200
+
+// DocumentPager walks a collection page by page over a single server-side cursor.
+// Only _id values (or the query's projection) are loaded; full document bodies
+// are fetched on demand with GetDocument.
+type DocumentPager struct {
+	cursor *mongo.Cursor
+	query  model.Query
+	Total  int64 // estimated number of matching documents, -1 if unknown
+	Loaded int   // number of documents loaded so far
+	Done   bool  // true when the cursor is exhausted
+}
+
+// OpenDocuments starts a paged listing of the documents matching the query
+func OpenDocuments(client *mongo.Client, dbName, collName string, query model.Query) (*DocumentPager, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter, err := queryFilter(query)
+	if err != nil {
+		return nil, err
+	}
+	opts, err := findOptions(query)
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(query.Projection) == "" {
+		// The list only needs the _id of each document
+		opts.SetProjection(bson.D{{Key: "_id", Value: 1}})
+	}
+	opts.SetBatchSize(DocumentPageSize)
+
+	coll := client.Database(dbName).Collection(collName)
+	cursor, err := coll.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DocumentPager{
+		cursor: cursor,
+		query:  query,
+		Total:  estimateCount(coll, filter),
+	}, nil
+}
+
+// estimateCount returns the (approximate) number of documents matching the filter
+func estimateCount(coll *mongo.Collection, filter bson.D) int64 {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var count int64
+	var err error
+	if len(filter) == 0 {
+		count, err = coll.EstimatedDocumentCount(ctx)
+	} else {
+		count, err = coll.CountDocuments(ctx, filter, options.Count().SetMaxTime(2*time.Second))
+	}
+	if err != nil {
+		return -1
+	}
+	return count
+}
+
+// Next loads the next page of documents
+func (p *DocumentPager) Next() ([]model.Document, error) {
+	if p.Done {
+		return nil, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var docs []model.Document
+	for len(docs) < DocumentPageSize {
+		if !p.cursor.Next(ctx) {
+			if err := p.cursor.Err(); err != nil {
+				return docs, err
+			}
+			p.Done = true
+			p.cursor.Close(ctx)
+			break
+		}
+		doc, err := newDocument(p.cursor.Current, p.query)
+		if err != nil {
+			continue
+		}
+		docs = append(docs, doc)
+	}
+
+	p.Loaded += len(docs)
+	return docs, nil
+}
+
+// Pages returns the estimated total number of pages, or -1 if unknown
+func (p *DocumentPager) Pages() int {
+	total := p.Total
+	if total < int64(p.Loaded) {
+		total = int64(p.Loaded)
+	}
+	if p.Total < 0 && !p.Done {
+		return -1
+	}
+	pages := int((total + DocumentPageSize - 1) / DocumentPageSize)
+	if pages < 1 {
+		pages = 1
+	}
+	return pages
+}
+
+// Close releases the server-side cursor
+func (p *DocumentPager) Close() {
+	if p.Done {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	p.cursor.Close(ctx)
+	p.Done = true
+}
@@ -0,0 +1,264 @@
+package db
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/ksiezykm/FerretMate/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ParseShellDocument parses a document written in relaxed mongo-shell syntax,
+// e.g. {status: 'pending', age: {$gt: 30}, _id: ObjectId("...")}.
+// Strict (Extended) JSON is accepted as well. An empty string yields a nil document.
+func ParseShellDocument(text string) (bson.D, error) {
+	if strings.TrimSpace(text) == "" {
+		return nil, nil
+	}
+
+	jsonText, err := shellToJSON(text)
+	if err != nil {
+		return nil, err
+	}
+	return ParseDocument(jsonText)
+}
+
+// findOptions builds the Find options (projection and sort) for a query
+func findOptions(q model.Query) (*options.FindOptions, error) {
+	opts := options.Find()
+
+	projection, err := ParseShellDocument(q.Projection)
+	if err != nil {
+		return nil, fmt.Errorf("invalid projection: %w", err)
+	}
+	if projection != nil {
+		opts.SetProjection(projection)
+	}
+
+	sort, err := ParseShellDocument(q.Sort)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sort: %w", err)
+	}
+	if sort != nil {
+		opts.SetSort(sort)
+	}
+
+	return opts, nil
+}
+
+// queryFilter returns the filter document of a query ({} when empty)
+func queryFilter(q model.Query) (bson.D, error) {
+	filter, err := ParseShellDocument(q.Filter)
+	if err != nil {
+		return nil, fmt.Errorf("invalid filter: %w", err)
+	}
+	if filter == nil {
+		filter = bson.D{}
+	}
+	return filter, nil
+}
+
+// shellFunctions maps mongo-shell constructors to their Extended JSON wrapper key
+var shellFunctions = map[string]string{
+	"ObjectId":      "$oid",
+	"ISODate":       "$date",
+	"Date":          "$date",
+	"NumberLong":    "$numberLong",
+	"NumberInt":     "$numberInt",
+	"NumberDecimal": "$numberDecimal",
+	"UUID":          "$uuid",
+}
+
+// shellToJSON rewrites relaxed mongo-shell syntax into strict JSON:
+// unquoted keys get quoted, single-quoted strings become double-quoted,
+// shell constructors and /regex/ literals become Extended JSON wrappers
+// and trailing commas are dropped.
+func shellToJSON(text string) (string, error) {
+	src := []rune(text)
+	var out strings.Builder
+	i := 0
+
+	skipSpace := func(j int) int {
+		for j < len(src) && unicode.IsSpace(src[j]) {
+			j++
+		}
+		return j
+	}
+
+	// readString reads a quoted string starting at src[j] and returns it as a JSON string literal
+	readString := func(j int) (string, int, error) {
+		quote := src[j]
+		var b strings.Builder
+		b.WriteRune('"')
+		j++
+		for j < len(src) {
+			c := src[j]
+			switch {
+			case c == '\\' && j+1 < len(src):
+				if src[j+1] == '\'' {
+					b.WriteRune('\'')
+				} else {
+					b.WriteRune(c)
+					b.WriteRune(src[j+1])
+				}
+				j += 2
+				continue
+			case c == quote:
+				b.WriteRune('"')
+				return b.String(), j + 1, nil
+			case c == '"':
+				b.WriteString(`\"`)
+			default:
+				b.WriteRune(c)
+			}
+			j++
+		}
+		return "", j, fmt.Errorf("unterminated string at position %d", j)
+	}
+
+	for i < len(src) {
+		c := src[i]
+		switch {
+		case c == '"' || c == '\'':
+			s, next, err := readString(i)
+			if err != nil {
+				return "", err
+			}
+			out.WriteString(s)
+			i = next
+
+		case c == ',':
+			// Drop trailing commas before a closing bracket
+			if j := skipSpace(i + 1); j < len(src) && (src[j] == '}' || src[j] == ']') {
+				i++
+				continue
+			}
+			out.WriteRune(c)
+			i++
+
+		case c == '/':
+			// Regular expression literal: /pattern/flags
+			j := i + 1
+			var pattern strings.Builder
+			for j < len(src) && src[j] != '/' {
+				if src[j] == '\\' && j+1 < len(src) {
+					pattern.WriteRune(src[j])
+					j++
+				}
+				pattern.WriteRune(src[j])
+				j++
+			}
+			if j >= len(src) {
+				return "", fmt.Errorf("unterminated regular expression at position %d", i)
+			}
+			j++
+			var flags strings.Builder
+			for j < len(src) && unicode.IsLetter(src[j]) {
+				flags.WriteRune(src[j])
+				j++
+			}
+			out.WriteString(fmt.Sprintf(`{"$regularExpression": {"pattern": %q, "options": %q}}`, pattern.String(), flags.String()))
+			i = j
+
+		case unicode.IsDigit(c):
+			// A number, or an unquoted key starting with a digit
+			j := i
+			for j < len(src) && (src[j] == '_' || unicode.IsLetter(src[j]) || unicode.IsDigit(src[j])) {
+				j++
+			}
+			if next := skipSpace(j); next < len(src) && src[next] == ':' {
+				out.WriteString(fmt.Sprintf("%q", string(src[i:j])))
+			} else {
+				out.WriteString(string(src[i:j]))
+			}
+			i = j
+
+		case c == '$' || c == '_' || unicode.IsLetter(c):
+			j := i
+			for j < len(src) && (src[j] == '$' || src[j] == '_' || src[j] == '.' || unicode.IsLetter(src[j]) || unicode.IsDigit(src[j])) {
+				j++
+			}
+			word := string(src[i:j])
+			next := skipSpace(j)
+
+			// "new Date(...)" style constructors
+			if word == "new" {
+				i = next
+				continue
+			}
+
+			switch {
+			case next < len(src) && src[next] == ':':
+				out.WriteString(fmt.Sprintf("%q", word))
+				i = j
+			case next < len(src) && src[next] == '(':
+				wrapper, ok := shellFunctions[word]
+				if !ok {
+					return "", fmt.Errorf("unknown function %s() at position %d", word, i)
+				}
+				k := skipSpace(next + 1)
+				arg := ""
+				if k < len(src) && (src[k] == '"' || src[k] == '\'') {
+					s, after, err := readString(k)
+					if err != nil {
+						return "", err
+					}
+					arg = s
+					k = after
+				} else {
+					start := k
+					for k < len(src) && src[k] != ')' {
+						k++
+					}
+					arg = fmt.Sprintf("%q", strings.TrimSpace(string(src[start:k])))
+				}
+				k = skipSpace(k)
+				if k >= len(src) || src[k] != ')' {
+					return "", fmt.Errorf("missing ) after %s at position %d", word, k)
+				}
+				if wrapper == "$date" {
+					arg = shellDate(arg)
+				}
+				out.WriteString(fmt.Sprintf(`{%q: %s}`, wrapper, arg))
+				i = k + 1
+			default:
+				// true, false, null and other bare words are passed through
+				out.WriteString(word)
+				i = j
+			}
+
+		default:
+			out.WriteRune(c)
+			i++
+		}
+	}
+
+	return out.String(), nil
+}
+
+// shellDate returns the Extended JSON value of a Date() or ISODate() argument,
+// read as the shell does: no argument means now, a number counts milliseconds
+// since the epoch, a date without a time is midnight UTC and a time without
+// a zone is UTC
+func shellDate(arg string) string {
+	value, err := strconv.Unquote(arg)
+	if err != nil {
+		return arg
+	}
+	if value == "" {
+		return fmt.Sprintf("%q", time.Now().UTC().Format(time.RFC3339Nano))
+	}
+	if _, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return fmt.Sprintf(`{"$numberLong": %q}`, value)
+	}
+	for _, layout := range []string{time.DateOnly, "2006-01-02T15:04", "2006-01-02T15:04:05.999999999"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return fmt.Sprintf("%q", t.Format(time.RFC3339Nano))
+		}
+	}
+	return arg
+}
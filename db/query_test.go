@@ -0,0 +1,79 @@
+package db
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestParseShellDocument(t *testing.T) {
+	oid, _ := primitive.ObjectIDFromHex("65a1b2c3d4e5f60718293a4b")
+	date := func(value string) primitive.DateTime {
+		tm, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return primitive.NewDateTimeFromTime(tm)
+	}
+
+	tests := []struct {
+		name, text string
+		want       bson.D
+	}{
+		{"ObjectId", `{_id: ObjectId("65a1b2c3d4e5f60718293a4b")}`, bson.D{{Key: "_id", Value: oid}}},
+		{"ObjectId single-quoted", `{_id: ObjectId('65a1b2c3d4e5f60718293a4b')}`, bson.D{{Key: "_id", Value: oid}}},
+		{"ISODate with zone", `{at: ISODate("2024-01-01T10:00:00+02:00")}`, bson.D{{Key: "at", Value: date("2024-01-01T08:00:00Z")}}},
+		{"ISODate without zone", `{at: ISODate("2024-01-01T10:00:00")}`, bson.D{{Key: "at", Value: date("2024-01-01T10:00:00Z")}}},
+		{"ISODate with milliseconds", `{at: ISODate("2024-01-01T10:00:00.250")}`, bson.D{{Key: "at", Value: date("2024-01-01T10:00:00.25Z")}}},
+		{"ISODate without seconds", `{at: ISODate("2024-01-01T10:00")}`, bson.D{{Key: "at", Value: date("2024-01-01T10:00:00Z")}}},
+		{"ISODate date only", `{at: ISODate("2024-01-01")}`, bson.D{{Key: "at", Value: date("2024-01-01T00:00:00Z")}}},
+		{"new Date", `{at: new Date('2024-01-01T10:00:00Z')}`, bson.D{{Key: "at", Value: date("2024-01-01T10:00:00Z")}}},
+		{"Date in milliseconds", `{at: Date(1704103200000)}`, bson.D{{Key: "at", Value: date("2024-01-01T10:00:00Z")}}},
+		{"regex", `{name: /^ad/}`, bson.D{{Key: "name", Value: primitive.Regex{Pattern: "^ad"}}}},
+		{"regex with flags", `{name: /^a\/d/im}`, bson.D{{Key: "name", Value: primitive.Regex{Pattern: `^a\/d`, Options: "im"}}}},
+		{"nested keys", `{address: {city: "Oslo", "zip.code": 150}, $or: [{a: 1}, {b: {$gt: 2.5}}]}`, bson.D{
+			{Key: "address", Value: bson.D{{Key: "city", Value: "Oslo"}, {Key: "zip.code", Value: int32(150)}}},
+			{Key: "$or", Value: bson.A{bson.D{{Key: "a", Value: int32(1)}}, bson.D{{Key: "b", Value: bson.D{{Key: "$gt", Value: 2.5}}}}}},
+		}},
+		{"dotted keys", `{tags.0: "a", items.price: {$lt: 10}}`, bson.D{
+			{Key: "tags.0", Value: "a"},
+			{Key: "items.price", Value: bson.D{{Key: "$lt", Value: int32(10)}}},
+		}},
+		{"single-quoted strings", `{'name': 'O\'Neil "Jr"'}`, bson.D{{Key: "name", Value: `O'Neil "Jr"`}}},
+		{"keys starting with a digit", `{2024: true, 1st: -1, n: 1e3}`, bson.D{
+			{Key: "2024", Value: true},
+			{Key: "1st", Value: int32(-1)},
+			{Key: "n", Value: 1000.0},
+		}},
+		{"trailing commas", `{a: [1, 2,], b: null,}`, bson.D{{Key: "a", Value: bson.A{int32(1), int32(2)}}, {Key: "b", Value: nil}}},
+		{"NumberLong", `{n: NumberLong("5")}`, bson.D{{Key: "n", Value: int64(5)}}},
+		{"empty", "  ", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseShellDocument(tt.text)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseShellDocument(%s) = %#v, want %#v", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseShellDocumentErrors(t *testing.T) {
+	for _, text := range []string{
+		`{name: "Ada}`,
+		`{name: /^ad}`,
+		`{at: Now()}`,
+		`{_id: ObjectId("65a1"}`,
+	} {
+		if _, err := ParseShellDocument(text); err == nil {
+			t.Errorf("ParseShellDocument(%s) succeeded", text)
+		}
+	}
+}
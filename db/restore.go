@@ -0,0 +1,359 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ConflictMode decides what RestoreTree does with a document whose _id
+// already exists in the target collection
+type ConflictMode int
+
+const (
+	ConflictSkip      ConflictMode = iota // keep the stored document
+	ConflictOverwrite                     // replace it (upsert by _id)
+	ConflictFail                          // write nothing if any document exists
+)
+
+func (c ConflictMode) String() string {
+	switch c {
+	case ConflictOverwrite:
+		return "overwrite"
+	case ConflictFail:
+		return "fail"
+	}
+	return "skip"
+}
+
+// ExportTree is a directory written by ExportDatabase: one subdirectory per
+// collection, holding one Extended JSON file per document
+type ExportTree struct {
+	Dir         string
+	Collections []string // the subdirectories with .json files, sorted
+}
+
+// ReadExportTree lists the collections of an export directory
+func ReadExportTree(dir string) (ExportTree, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return ExportTree{}, fmt.Errorf("failed to read export: %w", err)
+	}
+	tree := ExportTree{Dir: dir}
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		files, err := treeFiles(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return ExportTree{}, err
+		}
+		if len(files) > 0 {
+			tree.Collections = append(tree.Collections, e.Name())
+		}
+	}
+	if len(tree.Collections) == 0 {
+		return ExportTree{}, fmt.Errorf("no collection directories with .json files found in %s", dir)
+	}
+	sort.Strings(tree.Collections)
+	return tree, nil
+}
+
+// treeFiles returns the .json files of a collection directory, sorted
+func treeFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read export: %w", err)
+	}
+	var files []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), ".json") {
+			files = append(files, filepath.Join(dir, e.Name()))
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// eachTreeDocument parses the files of a collection directory in batches,
+// calling batch with the parsed documents and the number of files read so
+// far. Files that cannot be parsed are passed to invalid.
+func eachTreeDocument(dir string, batch func(docs []bson.D, files int) error, invalid func(file string, err error)) error {
+	files, err := treeFiles(dir)
+	if err != nil {
+		return err
+	}
+	docs := make([]bson.D, 0, uploadBatchSize)
+	for i, file := range files {
+		data, err := os.ReadFile(file)
+		if err == nil {
+			var parsed []bson.D
+			if parsed, err = parseDocuments(data); err == nil {
+				docs = append(docs, parsed...)
+			}
+		}
+		if err != nil {
+			invalid(filepath.Base(file), err)
+		}
+		if len(docs) >= uploadBatchSize || i == len(files)-1 {
+			if err := batch(docs, i+1); err != nil {
+				return err
+			}
+			docs = docs[:0]
+		}
+	}
+	return nil
+}
+
+// CollectionPlan is the dry-run summary of restoring one collection
+type CollectionPlan struct {
+	Name      string
+	Exists    bool     // the collection already exists in the target
+	Documents int64    // documents read from the files
+	Conflicts int64    // documents whose _id already exists in the target
+	Invalid   []string // files that could not be parsed, with the reason
+}
+
+// RestorePlan is the dry-run summary of a restore
+type RestorePlan struct {
+	Collections []CollectionPlan
+}
+
+// Conflicts returns the number of documents whose _id already exists
+func (p RestorePlan) Conflicts() int64 {
+	var n int64
+	for _, c := range p.Collections {
+		n += c.Conflicts
+	}
+	return n
+}
+
+// Summary describes what a restore with the given mode would do
+func (p RestorePlan) Summary(dbName string, mode ConflictMode) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Dry run: restore into %s, existing documents: %s\n\n", dbName, mode)
+	var documents, invalid int64
+	for _, c := range p.Collections {
+		state := "new collection"
+		if c.Exists {
+			state = "existing collection"
+		}
+		fmt.Fprintf(&b, "%s (%s)\n  %d documents, %d already exist\n", c.Name, state, c.Documents, c.Conflicts)
+		for _, file := range c.Invalid {
+			fmt.Fprintf(&b, "  skipped %s\n", file)
+		}
+		documents += c.Documents
+		invalid += int64(len(c.Invalid))
+	}
+
+	conflicts := p.Conflicts()
+	fmt.Fprintf(&b, "\nTotal: %d documents in %d collections", documents, len(p.Collections))
+	if invalid > 0 {
+		fmt.Fprintf(&b, ", %d unreadable files", invalid)
+	}
+	b.WriteString("\n")
+	switch {
+	case conflicts == 0:
+		fmt.Fprintf(&b, "All %d documents will be inserted.\n", documents)
+	case mode == ConflictSkip:
+		fmt.Fprintf(&b, "%d will be inserted, %d existing documents kept.\n", documents-conflicts, conflicts)
+	case mode == ConflictOverwrite:
+		fmt.Fprintf(&b, "%d will be inserted, %d existing documents replaced.\n", documents-conflicts, conflicts)
+	default:
+		fmt.Fprintf(&b, "The restore will fail: %d documents already exist.\n", conflicts)
+	}
+	return b.String()
+}
+
+// PlanRestore reads the selected collections of an export tree and checks
+// which documents already exist in the target database, without writing.
+// progress receives the files read out of all files.
+func PlanRestore(ctx context.Context, client *mongo.Client, tree ExportTree, collections []string, dbName string, progress func(done, total int64)) (RestorePlan, error) {
+	var plan RestorePlan
+	total, err := countTreeFiles(tree, collections)
+	if err != nil {
+		return plan, err
+	}
+
+	database := client.Database(dbName)
+	existing, err := database.ListCollectionNames(ctx, bson.D{})
+	if err != nil {
+		return plan, fmt.Errorf("failed to list collections: %w", err)
+	}
+
+	var done int64
+	for _, name := range collections {
+		c := CollectionPlan{Name: name}
+		for _, e := range existing {
+			c.Exists = c.Exists || e == name
+		}
+		coll := database.Collection(name)
+		var files int
+		err := eachTreeDocument(filepath.Join(tree.Dir, name), func(docs []bson.D, read int) error {
+			files = read
+			c.Documents += int64(len(docs))
+			if c.Exists {
+				n, err := countExisting(ctx, coll, docs)
+				if err != nil {
+					return err
+				}
+				c.Conflicts += n
+			}
+			progress(done+int64(read), total)
+			return nil
+		}, func(file string, err error) {
+			c.Invalid = append(c.Invalid, file+": "+err.Error())
+		})
+		if err != nil {
+			return plan, fmt.Errorf("%s: %w", name, err)
+		}
+		done += int64(files)
+		plan.Collections = append(plan.Collections, c)
+	}
+	return plan, nil
+}
+
+// countTreeFiles returns the number of .json files of the selected collections
+func countTreeFiles(tree ExportTree, collections []string) (int64, error) {
+	var total int64
+	for _, name := range collections {
+		files, err := treeFiles(filepath.Join(tree.Dir, name))
+		if err != nil {
+			return 0, err
+		}
+		total += int64(len(files))
+	}
+	return total, nil
+}
+
+// countExisting returns how many of the documents have an _id that is
+// already stored in the collection
+func countExisting(ctx context.Context, coll *mongo.Collection, docs []bson.D) (int64, error) {
+	ids := bson.A{}
+	for _, doc := range docs {
+		if id, ok := documentID(doc); ok {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	n, err := coll.CountDocuments(ctx, bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: ids}}}})
+	if err != nil {
+		return 0, fmt.Errorf("failed to check existing documents: %w", err)
+	}
+	return n, nil
+}
+
+// RestoreTree recreates the selected collections of an export tree in a
+// database. Missing collections are created; documents whose _id already
+// exists are kept, replaced or make the restore fail (before anything is
+// written) depending on mode. Unreadable files are skipped. progress
+// receives the files restored out of all files.
+func RestoreTree(ctx context.Context, client *mongo.Client, tree ExportTree, collections []string, dbName string, mode ConflictMode, progress func(done, total int64)) (RestoreResult, error) {
+	var result RestoreResult
+	if mode == ConflictFail {
+		plan, err := PlanRestore(ctx, client, tree, collections, dbName, func(done, total int64) {})
+		if err != nil {
+			return result, err
+		}
+		if n := plan.Conflicts(); n > 0 {
+			return result, fmt.Errorf("%d documents already exist; nothing was restored", n)
+		}
+	}
+
+	total, err := countTreeFiles(tree, collections)
+	if err != nil {
+		return result, err
+	}
+	database := client.Database(dbName)
+	existing, err := database.ListCollectionNames(ctx, bson.D{})
+	if err != nil {
+		return result, fmt.Errorf("failed to list collections: %w", err)
+	}
+
+	var done int64
+	for _, name := range collections {
+		exists := false
+		for _, e := range existing {
+			exists = exists || e == name
+		}
+		if !exists {
+			if err := database.CreateCollection(ctx, name); err != nil {
+				return result, fmt.Errorf("failed to create collection %s: %w", name, err)
+			}
+		}
+
+		coll := database.Collection(name)
+		var files int
+		err := eachTreeDocument(filepath.Join(tree.Dir, name), func(docs []bson.D, read int) error {
+			files = read
+			if len(docs) > 0 {
+				if err := restoreBatch(ctx, coll, docs, mode, &result); err != nil {
+					return err
+				}
+			}
+			progress(done+int64(read), total)
+			return nil
+		}, func(file string, err error) {
+			result.Invalid++
+		})
+		done += int64(files)
+		if err != nil {
+			return result, fmt.Errorf("%s: %w", name, err)
+		}
+		result.Collections++
+	}
+	return result, nil
+}
+
+// restoreBatch writes a batch of documents with the given conflict mode
+// and adds the outcome to result
+func restoreBatch(ctx context.Context, coll *mongo.Collection, docs []bson.D, mode ConflictMode, result *RestoreResult) error {
+	batch := make([]interface{}, 0, len(docs))
+	for _, doc := range docs {
+		batch = append(batch, doc)
+	}
+
+	switch mode {
+	case ConflictOverwrite:
+		models := make([]mongo.WriteModel, 0, len(docs))
+		for _, doc := range docs {
+			if id, ok := documentID(doc); ok {
+				models = append(models, mongo.NewReplaceOneModel().
+					SetFilter(bson.D{{Key: "_id", Value: id}}).
+					SetReplacement(doc).
+					SetUpsert(true))
+			} else {
+				models = append(models, mongo.NewInsertOneModel().SetDocument(doc))
+			}
+		}
+		res, err := coll.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+		if err != nil {
+			return fmt.Errorf("failed to write documents: %w", err)
+		}
+		result.Inserted += res.InsertedCount + res.UpsertedCount
+		result.Replaced += res.MatchedCount
+		return nil
+
+	case ConflictFail:
+		// Checked before writing; a document stored since then still fails
+		if _, err := coll.InsertMany(ctx, batch); err != nil {
+			return fmt.Errorf("failed to insert documents: %w", err)
+		}
+		result.Inserted += int64(len(batch))
+		return nil
+	}
+
+	inserted, duplicates, err := insertUnordered(ctx, coll, batch)
+	result.Inserted += inserted
+	result.Duplicates += duplicates
+	return err
+}
@@ -0,0 +1,61 @@
+package db
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// TestEachTreeDocumentBaselineExport reads a collection exported before the
+// exports used Extended JSON: encoding/json wrote ObjectIds as hex strings
+func TestEachTreeDocumentBaselineExport(t *testing.T) {
+	oid := primitive.NewObjectID()
+	dir := t.TempDir()
+	files := map[string]string{
+		`ObjectID("` + oid.Hex() + `").json`: `{
+  "_id": "` + oid.Hex() + `",
+  "name": "Ada",
+  "tags": [
+    "a",
+    "b"
+  ]
+}`,
+		"order-7.json": `{
+  "_id": "order-7",
+  "total": 12.5
+}`,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ids := make(map[string]interface{})
+	err := eachTreeDocument(dir, func(docs []bson.D, files int) error {
+		for _, doc := range docs {
+			id, _ := documentID(doc)
+			name, _ := field(doc, "name")
+			if name == nil {
+				name = "order"
+			}
+			ids[name.(string)] = id
+		}
+		return nil
+	}, func(file string, err error) {
+		t.Errorf("%s: %v", file, err)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ids["Ada"] != oid {
+		t.Errorf("_id = %#v, want ObjectId %s", ids["Ada"], oid.Hex())
+	}
+	if ids["order"] != "order-7" {
+		t.Errorf("_id = %#v, want the string order-7", ids["order"])
+	}
+}
@@ -0,0 +1,100 @@
+package db
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ksiezykm/FerretMate/model"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Session is an open connection to a server
+type Session struct {
+	Name   string // name of the connection
+	Client *mongo.Client
+	Opened time.Time
+
+	tunnel *sshTunnel
+}
+
+// close disconnects the client and closes its SSH tunnel
+func (s *Session) close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	err := s.Client.Disconnect(ctx)
+	if s.tunnel != nil {
+		s.tunnel.Close()
+	}
+	return err
+}
+
+// sessions is the registry of open sessions, keyed by connection name
+var (
+	sessionsMu sync.Mutex
+	sessions   = make(map[string]*Session)
+)
+
+// Open returns the session of a connection, connecting first if it is not
+// open yet. created reports whether this call opened the session.
+func Open(c model.Connection) (s *Session, created bool, err error) {
+	if s := Lookup(c.Name); s != nil {
+		return s, false, nil
+	}
+
+	client, t, err := connect(c)
+	if err != nil {
+		return nil, false, err
+	}
+	s = &Session{Name: c.Name, Client: client, Opened: time.Now(), tunnel: t}
+
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+	if existing, ok := sessions[c.Name]; ok {
+		// Opened concurrently, keep the first one
+		go s.close()
+		return existing, false, nil
+	}
+	sessions[c.Name] = s
+	return s, true, nil
+}
+
+// Lookup returns the open session of a connection, or nil
+func Lookup(name string) *Session {
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+	return sessions[name]
+}
+
+// Close closes the session of a connection, if it is open
+func Close(name string) error {
+	sessionsMu.Lock()
+	s, ok := sessions[name]
+	delete(sessions, name)
+	sessionsMu.Unlock()
+
+	if !ok {
+		return nil
+	}
+	return s.close()
+}
+
+// CloseAll closes every open session
+func CloseAll() {
+	for _, name := range SessionNames() {
+		Close(name)
+	}
+}
+
+// SessionNames returns the names of the open sessions, sorted
+func SessionNames() []string {
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+	names := make([]string, 0, len(sessions))
+	for name := range sessions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,179 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// IndexSize is the size of one index of a collection
+type IndexSize struct {
+	Name string
+	Size int64
+}
+
+// Stats is the dbStats or collStats output of a database or collection.
+// Collections and Indexes are only set for databases, Capped and
+// IndexSizes only for collections.
+type Stats struct {
+	Count          int64 // number of documents
+	DataSize       int64 // uncompressed size of the documents in bytes
+	StorageSize    int64 // size on disk in bytes
+	AvgObjSize     int64
+	TotalIndexSize int64
+	Collections    int64
+	Indexes        int64
+	Capped         bool
+	IndexSizes     []IndexSize
+}
+
+// DatabaseStats runs dbStats on a database
+func DatabaseStats(ctx context.Context, client *mongo.Client, dbName string) (*Stats, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	raw, err := client.Database(dbName).RunCommand(ctx, bson.D{{Key: "dbStats", Value: 1}}).Raw()
+	if err != nil {
+		return nil, err
+	}
+	s := newStats(raw)
+	s.Count = number(raw, "objects")
+	s.TotalIndexSize = number(raw, "indexSize")
+	s.Collections = number(raw, "collections")
+	s.Indexes = number(raw, "indexes")
+	return s, nil
+}
+
+// CollectionStats runs collStats on a collection, falling back to the
+// $collStats aggregation stage on servers that removed the command
+func CollectionStats(ctx context.Context, client *mongo.Client, dbName, collName string) (*Stats, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	database := client.Database(dbName)
+	raw, err := database.RunCommand(ctx, bson.D{{Key: "collStats", Value: collName}}).Raw()
+	if err != nil {
+		var aggErr error
+		raw, aggErr = aggregateCollStats(ctx, database.Collection(collName))
+		if aggErr != nil {
+			return nil, err
+		}
+	}
+
+	s := newStats(raw)
+	s.Count = number(raw, "count")
+	s.TotalIndexSize = number(raw, "totalIndexSize")
+	s.Capped, _ = raw.Lookup("capped").BooleanOK()
+	if sizes, ok := raw.Lookup("indexSizes").DocumentOK(); ok {
+		elems, _ := sizes.Elements()
+		for _, e := range elems {
+			size, _ := e.Value().AsInt64OK()
+			s.IndexSizes = append(s.IndexSizes, IndexSize{Name: e.Key(), Size: size})
+		}
+	}
+	return s, nil
+}
+
+// aggregateCollStats returns the storageStats of the $collStats stage
+func aggregateCollStats(ctx context.Context, coll *mongo.Collection) (bson.Raw, error) {
+	pipeline := bson.A{bson.D{{Key: "$collStats", Value: bson.D{{Key: "storageStats", Value: bson.D{}}}}}}
+	cursor, err := coll.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	if !cursor.Next(ctx) {
+		if err := cursor.Err(); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("$collStats returned no result")
+	}
+	stats, ok := cursor.Current.Lookup("storageStats").DocumentOK()
+	if !ok {
+		return nil, fmt.Errorf("$collStats returned no storageStats")
+	}
+	return stats, nil
+}
+
+// newStats reads the fields shared by dbStats and collStats
+func newStats(raw bson.Raw) *Stats {
+	return &Stats{
+		DataSize:    number(raw, "size", "dataSize"),
+		StorageSize: number(raw, "storageSize"),
+		AvgObjSize:  number(raw, "avgObjSize"),
+	}
+}
+
+// number returns the first of the given numeric fields that is present;
+// servers return int32, int64 or double depending on the size
+func number(raw bson.Raw, keys ...string) int64 {
+	for _, key := range keys {
+		if n, ok := raw.Lookup(key).AsInt64OK(); ok {
+			return n
+		}
+	}
+	return 0
+}
+
+// FormatSize renders a size in bytes for humans, e.g. 1.5 MB
+func FormatSize(bytes int64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	div, exp := int64(unit), 0
+	for n := bytes / unit; n >= unit && exp < 4; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(bytes)/float64(div), "KMGTP"[exp])
+}
+
+// Summary is a short form of the stats for list labels
+func (s *Stats) Summary(database bool) string {
+	parts := []string{}
+	if database {
+		parts = append(parts, fmt.Sprintf("%d colls", s.Collections))
+	} else {
+		parts = append(parts, fmt.Sprintf("%d docs", s.Count))
+	}
+	parts = append(parts, FormatSize(s.DataSize))
+	if s.Capped {
+		parts = append(parts, "capped")
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Report renders the stats for the notepad
+func (s *Stats) Report(title string, database bool) string {
+	var b strings.Builder
+	b.WriteString(title + "\n\n")
+	row := func(label, value string) {
+		fmt.Fprintf(&b, "  %-18s %s\n", label, value)
+	}
+	if database {
+		row("Collections", fmt.Sprint(s.Collections))
+	}
+	row("Documents", fmt.Sprint(s.Count))
+	row("Data size", FormatSize(s.DataSize))
+	row("Storage size", FormatSize(s.StorageSize))
+	row("Avg object size", FormatSize(s.AvgObjSize))
+	if database {
+		row("Indexes", fmt.Sprint(s.Indexes))
+	}
+	row("Total index size", FormatSize(s.TotalIndexSize))
+	if !database {
+		row("Capped", fmt.Sprint(s.Capped))
+		if len(s.IndexSizes) > 0 {
+			b.WriteString("\nIndex sizes\n\n")
+			for _, index := range s.IndexSizes {
+				row(index.Name, FormatSize(index.Size))
+			}
+		}
+	}
+	return b.String()
+}
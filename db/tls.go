@@ -0,0 +1,144 @@
+package db
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ksiezykm/FerretMate/model"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// tlsConfig builds the TLS configuration of a connection, or nil if it does not use TLS
+func tlsConfig(c model.Connection) (*tls.Config, error) {
+	if !c.UsesTLS() {
+		return nil, nil
+	}
+
+	cfg := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         c.TLSServerName,
+		InsecureSkipVerify: c.TLSInsecure,
+	}
+
+	if c.TLSCAFile != "" {
+		pem, err := os.ReadFile(c.TLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no PEM certificates found in CA file %s", c.TLSCAFile)
+		}
+		cfg.RootCAs = pool
+	}
+
+	if c.TLSCertFile != "" {
+		keyFile := c.TLSKeyFile
+		if keyFile == "" {
+			keyFile = c.TLSCertFile
+		}
+		cert, err := tls.LoadX509KeyPair(c.TLSCertFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	} else if c.AuthMechanism == model.AuthX509 {
+		return nil, fmt.Errorf("%s authentication needs a client certificate", model.AuthX509)
+	}
+
+	return cfg, nil
+}
+
+// applyTLS sets the TLS configuration and X.509 authentication of a connection on the options
+func applyTLS(opts *options.ClientOptions, c model.Connection) error {
+	cfg, err := tlsConfig(c)
+	if err != nil {
+		return err
+	}
+	if cfg != nil {
+		opts.SetTLSConfig(cfg)
+	}
+
+	if c.AuthMechanism == model.AuthX509 {
+		// The user name is taken from the certificate subject when empty
+		opts.SetAuth(options.Credential{
+			AuthMechanism: model.AuthX509,
+			AuthSource:    "$external",
+			Username:      c.Username,
+		})
+	}
+	return nil
+}
+
+// describeTLSError explains a certificate or TLS handshake error, or returns ""
+func describeTLSError(err error) string {
+	var unknownAuthority x509.UnknownAuthorityError
+	if errors.As(err, &unknownAuthority) {
+		name := ""
+		if unknownAuthority.Cert != nil {
+			name = " (issued by " + unknownAuthority.Cert.Issuer.String() + ")"
+		}
+		return "The server certificate is signed by an unknown authority" + name + ". Set the CA file or enable insecure mode."
+	}
+
+	var hostnameErr x509.HostnameError
+	if errors.As(err, &hostnameErr) {
+		names := hostnameErr.Certificate.DNSNames
+		if len(names) == 0 {
+			names = []string{hostnameErr.Certificate.Subject.CommonName}
+		}
+		return fmt.Sprintf("The server certificate is for %s, not %s. Set the server name (SNI) or connect by that name.",
+			strings.Join(names, ", "), hostnameErr.Host)
+	}
+
+	var invalidErr x509.CertificateInvalidError
+	if errors.As(err, &invalidErr) {
+		if invalidErr.Reason == x509.Expired && invalidErr.Cert != nil {
+			return fmt.Sprintf("The server certificate is expired or not yet valid (valid %s to %s).",
+				invalidErr.Cert.NotBefore.Format(time.DateOnly), invalidErr.Cert.NotAfter.Format(time.DateOnly))
+		}
+		return "The server certificate is invalid: " + invalidErr.Error()
+	}
+
+	var recordErr tls.RecordHeaderError
+	if errors.As(err, &recordErr) {
+		return "The server did not answer with TLS. Disable TLS for this connection or check the port."
+	}
+
+	// The driver often keeps only the text of the handshake error
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, "certificate signed by unknown authority"):
+		return "The server certificate is signed by an unknown authority. Set the CA file or enable insecure mode."
+	case strings.Contains(msg, "certificate is valid for"):
+		return "The server certificate is valid for " + detail(msg, "certificate is valid for ") + ". Set the server name (SNI) or connect by a name in the certificate."
+	case strings.Contains(msg, "certificate has expired or is not yet valid"):
+		return "The server certificate is expired or not yet valid."
+	case strings.Contains(msg, "certificate required"), strings.Contains(msg, "bad certificate"):
+		return "The server rejected the client certificate. Check the certificate and key files."
+	case strings.Contains(msg, "unknown certificate authority"):
+		return "The server does not trust the issuer of the client certificate."
+	case strings.Contains(msg, "x509:"):
+		return "Certificate error: " + detail(msg, "x509: ")
+	case strings.Contains(msg, "first record does not look like a TLS handshake"):
+		return "The server did not answer with TLS. Disable TLS for this connection or check the port."
+	case strings.Contains(msg, "tls:"):
+		return "TLS handshake failed: " + detail(msg, "tls: ")
+	}
+	return ""
+}
+
+// detail returns the part of msg after marker, up to the end of the embedded
+// error (server selection errors append the topology description)
+func detail(msg, marker string) string {
+	text := msg[strings.Index(msg, marker)+len(marker):]
+	if end := strings.IndexAny(text, "}\n"); end >= 0 {
+		text = text[:end]
+	}
+	return strings.TrimRight(text, ", ")
+}
@@ -0,0 +1,260 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ksiezykm/FerretMate/model"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// defaultSSHPort is used when no SSH port is set
+const defaultSSHPort = 22
+
+// sshTunnel forwards a local port to a remote address through an SSH server
+type sshTunnel struct {
+	client   *ssh.Client
+	listener net.Listener
+	remote   string
+
+	mu    sync.Mutex
+	conns map[net.Conn]struct{}
+	wg    sync.WaitGroup
+}
+
+// openTunnel connects to the SSH server of a connection and forwards a local
+// port on 127.0.0.1 to remote (host:port as seen from the SSH server)
+func openTunnel(c model.Connection, remote string) (*sshTunnel, error) {
+	config, agentConn, err := sshConfig(c)
+	if err != nil {
+		return nil, err
+	}
+	if agentConn != nil {
+		// The agent is only needed for the handshake
+		defer agentConn.Close()
+	}
+
+	port := c.SSHPort
+	if port == 0 {
+		port = defaultSSHPort
+	}
+	addr := net.JoinHostPort(c.SSHHost, strconv.Itoa(port))
+
+	client, err := ssh.Dial("tcp", addr, config)
+	if err != nil {
+		return nil, describeSSHError(addr, err)
+	}
+
+	// Check that the target is reachable before handing the tunnel to the driver
+	probe, err := client.Dial("tcp", remote)
+	if err != nil {
+		client.Close()
+		return nil, fmt.Errorf("SSH server %s cannot reach %s: %w", addr, remote, err)
+	}
+	probe.Close()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to open local tunnel port: %w", err)
+	}
+
+	t := &sshTunnel{
+		client:   client,
+		listener: listener,
+		remote:   remote,
+		conns:    make(map[net.Conn]struct{}),
+	}
+	t.wg.Add(1)
+	go t.serve()
+	return t, nil
+}
+
+// Addr returns the local address of the tunnel
+func (t *sshTunnel) Addr() string {
+	return t.listener.Addr().String()
+}
+
+// serve accepts local connections and forwards each of them over SSH
+func (t *sshTunnel) serve() {
+	defer t.wg.Done()
+	for {
+		local, err := t.listener.Accept()
+		if err != nil {
+			return
+		}
+		t.wg.Add(1)
+		go t.forward(local)
+	}
+}
+
+// forward copies data between a local connection and the remote address
+func (t *sshTunnel) forward(local net.Conn) {
+	defer t.wg.Done()
+
+	remote, err := t.client.Dial("tcp", t.remote)
+	if err != nil {
+		local.Close()
+		return
+	}
+	if !t.track(local, remote) {
+		local.Close()
+		remote.Close()
+		return
+	}
+	defer t.untrack(local, remote)
+
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(remote, local)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(local, remote)
+		done <- struct{}{}
+	}()
+
+	// Closing both ends after either direction ends stops the other copy
+	<-done
+	local.Close()
+	remote.Close()
+	<-done
+}
+
+// track registers open connections so Close can end them; it fails once the tunnel is closed
+func (t *sshTunnel) track(conns ...net.Conn) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.conns == nil {
+		return false
+	}
+	for _, c := range conns {
+		t.conns[c] = struct{}{}
+	}
+	return true
+}
+
+func (t *sshTunnel) untrack(conns ...net.Conn) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, c := range conns {
+		delete(t.conns, c)
+	}
+}
+
+// Close stops the tunnel, closing the forwarded connections and the SSH connection
+func (t *sshTunnel) Close() error {
+	err := t.listener.Close()
+
+	t.mu.Lock()
+	for c := range t.conns {
+		c.Close()
+	}
+	t.conns = nil
+	t.mu.Unlock()
+
+	if cerr := t.client.Close(); err == nil {
+		err = cerr
+	}
+	t.wg.Wait()
+	return err
+}
+
+// sshConfig builds the client configuration: user, key file or agent
+// authentication and the known_hosts check. The returned agent connection,
+// if any, must be closed after dialing.
+func sshConfig(c model.Connection) (*ssh.ClientConfig, io.Closer, error) {
+	username := c.SSHUser
+	if username == "" {
+		if u, err := user.Current(); err == nil {
+			username = u.Username
+		}
+	}
+
+	var auth []ssh.AuthMethod
+	var agentConn io.Closer
+	if c.SSHKeyFile != "" {
+		key, err := os.ReadFile(expandHome(c.SSHKeyFile))
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read SSH key: %w", err)
+		}
+		signer, err := ssh.ParsePrivateKey(key)
+		var passErr *ssh.PassphraseMissingError
+		if errors.As(err, &passErr) {
+			return nil, nil, fmt.Errorf("SSH key %s is protected by a passphrase; add it to ssh-agent and leave the key file empty", c.SSHKeyFile)
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to parse SSH key: %w", err)
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	} else {
+		sock := os.Getenv("SSH_AUTH_SOCK")
+		if sock == "" {
+			return nil, nil, fmt.Errorf("no SSH key file set and no ssh-agent running (SSH_AUTH_SOCK is empty)")
+		}
+		conn, err := net.Dial("unix", sock)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to connect to ssh-agent: %w", err)
+		}
+		agentConn = conn
+		auth = append(auth, ssh.PublicKeysCallback(agent.NewClient(conn).Signers))
+	}
+
+	var hostKeyCallback ssh.HostKeyCallback
+	if c.SSHInsecureHostKey {
+		hostKeyCallback = ssh.InsecureIgnoreHostKey()
+	} else {
+		file := c.SSHKnownHosts
+		if file == "" {
+			file = "~/.ssh/known_hosts"
+		}
+		callback, err := knownhosts.New(expandHome(file))
+		if err != nil {
+			if agentConn != nil {
+				agentConn.Close()
+			}
+			return nil, nil, fmt.Errorf("failed to read known_hosts: %w", err)
+		}
+		hostKeyCallback = callback
+	}
+
+	return &ssh.ClientConfig{
+		User:            username,
+		Auth:            auth,
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         10 * time.Second,
+	}, agentConn, nil
+}
+
+// describeSSHError explains host key problems of an SSH dial error
+func describeSSHError(addr string, err error) error {
+	var keyErr *knownhosts.KeyError
+	if errors.As(err, &keyErr) {
+		if len(keyErr.Want) == 0 {
+			return fmt.Errorf("SSH host %s is not in known_hosts; add it with ssh-keyscan or connect once with ssh", addr)
+		}
+		return fmt.Errorf("SSH host key of %s does not match known_hosts (line %d) - it may have been replaced or someone may be intercepting the connection",
+			addr, keyErr.Want[0].Line)
+	}
+	return fmt.Errorf("SSH connection to %s failed: %w", addr, err)
+}
+
+// expandHome replaces a leading ~ with the home directory
+func expandHome(path string) string {
+	if path == "~" || len(path) > 1 && path[:2] == "~/" {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, path[1:])
+		}
+	}
+	return path
+}
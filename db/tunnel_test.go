@@ -0,0 +1,321 @@
+package db
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ksiezykm/FerretMate/model"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// testSSHServer is an in-process SSH server that accepts one client key and
+// serves direct-tcpip channels, as sshd does for ssh -L
+type testSSHServer struct {
+	addr    string
+	hostKey ssh.Signer
+	keyFile string // the accepted client key, as a private key file
+}
+
+// newTestSigner returns a new ed25519 signer and its private key
+func newTestSigner(t *testing.T) (ssh.Signer, ed25519.PrivateKey) {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer, key
+}
+
+// startSSHServer starts the server; it stops with the test
+func startSSHServer(t *testing.T) *testSSHServer {
+	t.Helper()
+	hostKey, _ := newTestSigner(t)
+	clientSigner, clientKey := newTestSigner(t)
+
+	block, err := ssh.MarshalPrivateKey(clientKey, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile := filepath.Join(t.TempDir(), "id_ed25519")
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if string(key.Marshal()) != string(clientSigner.PublicKey().Marshal()) {
+				return nil, io.EOF
+			}
+			return nil, nil
+		},
+	}
+	config.AddHostKey(hostKey)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	t.Cleanup(func() {
+		listener.Close()
+		wg.Wait()
+	})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				serveSSHConn(conn, config)
+			}()
+		}
+	}()
+	return &testSSHServer{addr: listener.Addr().String(), hostKey: hostKey, keyFile: keyFile}
+}
+
+// serveSSHConn forwards the direct-tcpip channels of one SSH connection
+func serveSSHConn(conn net.Conn, config *ssh.ServerConfig) {
+	defer conn.Close()
+	_, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for newChan := range chans {
+		if newChan.ChannelType() != "direct-tcpip" {
+			newChan.Reject(ssh.UnknownChannelType, "only direct-tcpip")
+			continue
+		}
+		var target struct {
+			Host     string
+			Port     uint32
+			OrigHost string
+			OrigPort uint32
+		}
+		if err := ssh.Unmarshal(newChan.ExtraData(), &target); err != nil {
+			newChan.Reject(ssh.ConnectionFailed, err.Error())
+			continue
+		}
+		remote, err := net.Dial("tcp", net.JoinHostPort(target.Host, strconv.Itoa(int(target.Port))))
+		if err != nil {
+			newChan.Reject(ssh.ConnectionFailed, err.Error())
+			continue
+		}
+		ch, chReqs, err := newChan.Accept()
+		if err != nil {
+			remote.Close()
+			continue
+		}
+		go ssh.DiscardRequests(chReqs)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			done := make(chan struct{}, 2)
+			go func() { io.Copy(ch, remote); done <- struct{}{} }()
+			go func() { io.Copy(remote, ch); done <- struct{}{} }()
+			<-done
+			ch.Close()
+			remote.Close()
+			<-done
+		}()
+	}
+}
+
+// startEchoServer starts a TCP server writing back what it reads
+func startEchoServer(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+// knownHostsFile writes a known_hosts file listing addr with key
+func knownHostsFile(t *testing.T, addr string, key ssh.PublicKey) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "known_hosts")
+	line := ""
+	if key != nil {
+		line = knownhosts.Line([]string{addr}, key) + "\n"
+	}
+	if err := os.WriteFile(path, []byte(line), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// tunnelConnection returns the connection settings for the test server
+func tunnelConnection(t *testing.T, server *testSSHServer, knownHosts string) model.Connection {
+	t.Helper()
+	host, port, err := net.SplitHostPort(server.addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, _ := strconv.Atoi(port)
+	return model.Connection{
+		SSHHost:       host,
+		SSHPort:       p,
+		SSHUser:       "test",
+		SSHKeyFile:    server.keyFile,
+		SSHKnownHosts: knownHosts,
+	}
+}
+
+// echo writes text through conn and checks that it comes back
+func echo(t *testing.T, conn net.Conn, text string) {
+	t.Helper()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Write([]byte(text)); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, len(text))
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != text {
+		t.Fatalf("read %q, want %q", buf, text)
+	}
+}
+
+func TestTunnelRoundTrip(t *testing.T) {
+	server := startSSHServer(t)
+	remote := startEchoServer(t)
+	c := tunnelConnection(t, server, knownHostsFile(t, server.addr, server.hostKey.PublicKey()))
+
+	tunnel, err := openTunnel(c, remote)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tunnel.Close()
+
+	conn, err := net.Dial("tcp", tunnel.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	echo(t, conn, "ping")
+	echo(t, conn, strings.Repeat("x", 1<<16))
+}
+
+func TestTunnelHostKey(t *testing.T) {
+	server := startSSHServer(t)
+	remote := startEchoServer(t)
+	otherKey, _ := newTestSigner(t)
+
+	tests := []struct {
+		name string
+		key  ssh.PublicKey
+		want string
+	}{
+		{"mismatch", otherKey.PublicKey(), "does not match known_hosts"},
+		{"unknown", nil, "is not in known_hosts"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := tunnelConnection(t, server, knownHostsFile(t, server.addr, tt.key))
+			tunnel, err := openTunnel(c, remote)
+			if err == nil {
+				tunnel.Close()
+				t.Fatal("openTunnel succeeded")
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error %q does not contain %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestTunnelCloseWithLiveConnections(t *testing.T) {
+	server := startSSHServer(t)
+	remote := startEchoServer(t)
+	c := tunnelConnection(t, server, knownHostsFile(t, server.addr, server.hostKey.PublicKey()))
+
+	tunnel, err := openTunnel(c, remote)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Connections in use, each forwarded and tracked
+	var conns []net.Conn
+	for i := 0; i < 3; i++ {
+		conn, err := net.Dial("tcp", tunnel.Addr())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		echo(t, conn, "ping")
+		conns = append(conns, conn)
+	}
+
+	// Connections still being set up race with Close
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if conn, err := net.Dial("tcp", tunnel.Addr()); err == nil {
+				conn.Close()
+			}
+		}()
+	}
+
+	closed := make(chan struct{})
+	go func() {
+		tunnel.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close did not return with live connections")
+	}
+	wg.Wait()
+
+	for i, conn := range conns {
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		if _, err := conn.Read(make([]byte, 1)); err == nil {
+			t.Errorf("connection %d still open after Close", i)
+		}
+	}
+	if conn, err := net.Dial("tcp", tunnel.Addr()); err == nil {
+		conn.Close()
+		t.Error("tunnel still accepts connections after Close")
+	}
+}
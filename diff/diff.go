@@ -0,0 +1,129 @@
+package diff
+
+import (
+	"strings"
+)
+
+// Op is the kind of change of a diff line
+type Op int
+
+const (
+	Equal Op = iota
+	Removed
+	Added
+	Modified // a field present on both sides with different values
+)
+
+// Line is a single line of a line-based diff
+type Line struct {
+	Op   Op
+	Text string
+}
+
+// maxCells bounds the size of the LCS table; bigger inputs get a coarser diff
+const maxCells = 4_000_000
+
+// Lines computes a line-based diff turning a into b
+func Lines(a, b string) []Line {
+	aLines := strings.Split(a, "\n")
+	bLines := strings.Split(b, "\n")
+
+	// Common prefix and suffix never need the LCS table
+	prefix := 0
+	for prefix < len(aLines) && prefix < len(bLines) && aLines[prefix] == bLines[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(aLines)-prefix && suffix < len(bLines)-prefix &&
+		aLines[len(aLines)-1-suffix] == bLines[len(bLines)-1-suffix] {
+		suffix++
+	}
+
+	var out []Line
+	for _, l := range aLines[:prefix] {
+		out = append(out, Line{Op: Equal, Text: l})
+	}
+	out = append(out, lcs(aLines[prefix:len(aLines)-suffix], bLines[prefix:len(bLines)-suffix])...)
+	for _, l := range aLines[len(aLines)-suffix:] {
+		out = append(out, Line{Op: Equal, Text: l})
+	}
+	return out
+}
+
+// lcs diffs two line slices using a longest-common-subsequence table
+func lcs(a, b []string) []Line {
+	var out []Line
+	if len(a)*len(b) > maxCells {
+		for _, l := range a {
+			out = append(out, Line{Op: Removed, Text: l})
+		}
+		for _, l := range b {
+			out = append(out, Line{Op: Added, Text: l})
+		}
+		return out
+	}
+
+	// table[i][j] is the LCS length of a[i:] and b[j:]
+	width := len(b) + 1
+	table := make([]int, (len(a)+1)*width)
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				table[i*width+j] = table[(i+1)*width+j+1] + 1
+			} else if table[(i+1)*width+j] >= table[i*width+j+1] {
+				table[i*width+j] = table[(i+1)*width+j]
+			} else {
+				table[i*width+j] = table[i*width+j+1]
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			out = append(out, Line{Op: Equal, Text: a[i]})
+			i++
+			j++
+		case table[(i+1)*width+j] >= table[i*width+j+1]:
+			out = append(out, Line{Op: Removed, Text: a[i]})
+			i++
+		default:
+			out = append(out, Line{Op: Added, Text: b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		out = append(out, Line{Op: Removed, Text: a[i]})
+	}
+	for ; j < len(b); j++ {
+		out = append(out, Line{Op: Added, Text: b[j]})
+	}
+	return out
+}
+
+// Changed reports whether a diff contains any change
+func Changed(lines []Line) bool {
+	for _, l := range lines {
+		if l.Op != Equal {
+			return true
+		}
+	}
+	return false
+}
+
+// Format renders a diff as text with +/- markers, colored with ANSI escapes
+func Format(lines []Line) string {
+	var b strings.Builder
+	for _, l := range lines {
+		switch l.Op {
+		case Removed:
+			b.WriteString("\x1b[31m- " + l.Text + "\x1b[0m\n")
+		case Added:
+			b.WriteString("\x1b[32m+ " + l.Text + "\x1b[0m\n")
+		default:
+			b.WriteString("  " + l.Text + "\n")
+		}
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
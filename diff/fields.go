@@ -0,0 +1,157 @@
+package diff
+
+import (
+	"bytes"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Field is one dotted field path of two compared documents
+type Field struct {
+	Path     string
+	Left     interface{}
+	Right    interface{}
+	HasLeft  bool
+	HasRight bool
+}
+
+// Op tells how the field differs: Equal, Removed (left only), Added (right only)
+// or Modified (both sides, different values)
+func (f Field) Op() Op {
+	switch {
+	case !f.HasRight:
+		return Removed
+	case !f.HasLeft:
+		return Added
+	case sameValue(f.Left, f.Right):
+		return Equal
+	}
+	return Modified
+}
+
+// Fields compares two documents field by field. Embedded documents are
+// flattened into dotted paths; arrays are compared as whole values. Fields
+// follow the order of the left document, then right-only fields.
+func Fields(left, right bson.D) []Field {
+	var fields []Field
+	index := make(map[string]int)
+
+	flatten("", left, func(path string, value interface{}) {
+		index[path] = len(fields)
+		fields = append(fields, Field{Path: path, Left: value, HasLeft: true})
+	})
+	flatten("", right, func(path string, value interface{}) {
+		if i, ok := index[path]; ok {
+			fields[i].Right = value
+			fields[i].HasRight = true
+			return
+		}
+		fields = append(fields, Field{Path: path, Right: value, HasRight: true})
+	})
+	return fields
+}
+
+// flatten calls fn for every leaf field of a document with its dotted path
+func flatten(prefix string, doc bson.D, fn func(path string, value interface{})) {
+	for _, e := range doc {
+		path := e.Key
+		if prefix != "" {
+			path = prefix + "." + e.Key
+		}
+		if sub, ok := e.Value.(bson.D); ok && len(sub) > 0 {
+			flatten(path, sub, fn)
+			continue
+		}
+		fn(path, e.Value)
+	}
+}
+
+// CopyField sets the field at a dotted path of dst to the value it has in src,
+// or removes it from dst if src does not have it. Missing parent documents are created.
+func CopyField(dst, src bson.D, path string) bson.D {
+	parts := strings.Split(path, ".")
+	if value, ok := lookup(src, parts); ok {
+		return setPath(dst, parts, value)
+	}
+	return unsetPath(dst, parts)
+}
+
+// lookup returns the value at a path
+func lookup(doc bson.D, parts []string) (interface{}, bool) {
+	for _, e := range doc {
+		if e.Key != parts[0] {
+			continue
+		}
+		if len(parts) == 1 {
+			return e.Value, true
+		}
+		if sub, ok := e.Value.(bson.D); ok {
+			return lookup(sub, parts[1:])
+		}
+		return nil, false
+	}
+	return nil, false
+}
+
+// setPath returns doc with the value at a path set
+func setPath(doc bson.D, parts []string, value interface{}) bson.D {
+	for i, e := range doc {
+		if e.Key != parts[0] {
+			continue
+		}
+		if len(parts) == 1 {
+			doc[i].Value = value
+		} else {
+			sub, _ := e.Value.(bson.D)
+			doc[i].Value = setPath(sub, parts[1:], value)
+		}
+		return doc
+	}
+
+	if len(parts) == 1 {
+		return append(doc, bson.E{Key: parts[0], Value: value})
+	}
+	return append(doc, bson.E{Key: parts[0], Value: setPath(bson.D{}, parts[1:], value)})
+}
+
+// unsetPath returns doc without the field at a path
+func unsetPath(doc bson.D, parts []string) bson.D {
+	for i, e := range doc {
+		if e.Key != parts[0] {
+			continue
+		}
+		if len(parts) == 1 {
+			return append(doc[:i:i], doc[i+1:]...)
+		}
+		if sub, ok := e.Value.(bson.D); ok {
+			doc[i].Value = unsetPath(sub, parts[1:])
+		}
+		return doc
+	}
+	return doc
+}
+
+// FormatValue renders a value as single-line relaxed Extended JSON
+func FormatValue(value interface{}) string {
+	out, err := bson.MarshalExtJSON(bson.D{{Key: "v", Value: value}}, false, false)
+	if err != nil {
+		return "?"
+	}
+	// Strip the {"v": ...} wrapper
+	text := strings.TrimPrefix(string(out), `{"v":`)
+	return strings.TrimSuffix(text, "}")
+}
+
+// sameValue reports whether two values encode to the same BSON type and bytes
+func sameValue(a, b interface{}) bool {
+	ta, da, err := bson.MarshalValue(a)
+	if err != nil {
+		return false
+	}
+	tb, db, err := bson.MarshalValue(b)
+	if err != nil {
+		return false
+	}
+	return ta == tb && bytes.Equal(da, db)
+}
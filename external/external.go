@@ -0,0 +1,62 @@
+package external
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/awesome-gocui/gocui"
+)
+
+// Editor returns the command line of the user's editor ($VISUAL, then $EDITOR, then vi)
+func Editor() []string {
+	for _, env := range []string{"VISUAL", "EDITOR"} {
+		if fields := strings.Fields(os.Getenv(env)); len(fields) > 0 {
+			return fields
+		}
+	}
+	return []string{"vi"}
+}
+
+// Edit suspends the gocui screen, opens content in the user's editor
+// and returns the edited text once the editor exits.
+// pattern is the temp file name pattern (see os.CreateTemp), e.g. "ferretmate-*.json".
+func Edit(content, pattern string) (string, error) {
+	file, err := os.CreateTemp("", pattern)
+	if err != nil {
+		return "", fmt.Errorf("failed to create temp file: %w", err)
+	}
+	path := file.Name()
+	defer os.Remove(path)
+
+	if _, err := file.WriteString(content); err != nil {
+		file.Close()
+		return "", fmt.Errorf("failed to write temp file: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return "", fmt.Errorf("failed to write temp file: %w", err)
+	}
+
+	editor := Editor()
+	cmd := exec.Command(editor[0], append(editor[1:], path)...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	// Hand the terminal over to the editor while it runs
+	gocui.Suspend()
+	runErr := cmd.Run()
+	if err := gocui.Resume(); err != nil {
+		return "", fmt.Errorf("failed to restore screen: %w", err)
+	}
+	if runErr != nil {
+		return "", fmt.Errorf("editor %s failed: %w", editor[0], runErr)
+	}
+
+	edited, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read temp file: %w", err)
+	}
+	return strings.TrimRight(string(edited), "\n"), nil
+}
@@ -5,6 +5,7 @@ go 1.23.6
 require (
 	github.com/awesome-gocui/gocui v1.1.0
 	go.mongodb.org/mongo-driver v1.17.4
+	golang.org/x/crypto v0.26.0
 )
 
 require (
@@ -20,7 +21,6 @@ require (
 	github.com/xdg-go/scram v1.1.2 // indirect
 	github.com/xdg-go/stringprep v1.0.4 // indirect
 	github.com/youmark/pkcs8 v0.0.0-20240726163527-a2c0da244d78 // indirect
-	golang.org/x/crypto v0.26.0 // indirect
 	golang.org/x/sync v0.8.0 // indirect
 	golang.org/x/sys v0.23.0 // indirect
 	golang.org/x/term v0.23.0 // indirect
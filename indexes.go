@@ -0,0 +1,268 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/ksiezykm/FerretMate/db"
+	"github.com/ksiezykm/FerretMate/list"
+	"github.com/ksiezykm/FerretMate/model"
+	"github.com/ksiezykm/FerretMate/notepad"
+	"github.com/ksiezykm/FerretMate/popup"
+)
+
+// indexManager lists, creates and drops the indexes of a collection on the
+// "indexes" level of the list
+type indexManager struct {
+	level
+	note *notepad.Notepad // shows the selected index
+}
+
+// Open shows the indexes of the collection under the cursor
+func (im *indexManager) Open() {
+	if im.m.SelectedListView != "collections" || im.list.Selected >= len(im.m.Collections) {
+		return
+	}
+	client := im.sessionClient()
+	if client == nil {
+		return
+	}
+	im.m.SelectedCollection = im.m.Collections[im.list.Selected]
+	im.m.SelectedCollectionIndex = im.list.Selected
+
+	indexes, err := db.ListIndexes(client, im.m.SelectedDB, im.m.SelectedCollection)
+	if err != nil {
+		popup.ShowInfo(im.g, "Failed to list indexes: "+err.Error())
+		log.Printf("Failed to list indexes: %v", err)
+		return
+	}
+	im.m.Indexes = indexes
+	im.m.SelectedListView = "indexes"
+	im.refresh(0)
+}
+
+// refresh redraws the index list with the cursor at selected
+func (im *indexManager) refresh(selected int) {
+	maxX, _ := im.g.Size()
+	im.list.Title = buildBreadcrumbTitle(im.m, "Indexes", maxX/2)
+	im.list.Items = indexItems(im.m.Indexes)
+	if selected >= len(im.list.Items) {
+		selected = len(im.list.Items) - 1
+	}
+	if selected < 0 {
+		selected = 0
+	}
+	im.list.Selected = selected
+	im.list.Update(im.g)
+	im.Show(selected)
+}
+
+// reload lists the indexes again with the cursor on the index called name,
+// or near selected if there is no such index
+func (im *indexManager) reload(selected int, name string) {
+	client := im.sessionClient()
+	if client == nil {
+		return
+	}
+	indexes, err := db.ListIndexes(client, im.m.SelectedDB, im.m.SelectedCollection)
+	if err != nil {
+		popup.ShowInfo(im.g, "Failed to list indexes: "+err.Error())
+		log.Printf("Failed to list indexes: %v", err)
+		return
+	}
+	im.m.Indexes = indexes
+	for i, index := range indexes {
+		if index.Name == name {
+			selected = i
+		}
+	}
+	im.refresh(selected)
+}
+
+// Show displays the full description of the index at i in the notepad
+func (im *indexManager) Show(i int) {
+	if v, err := im.g.View(im.note.Name); err == nil {
+		v.Title = "Editor"
+		if i < len(im.m.Indexes) {
+			v.Title = "Index: " + im.m.Indexes[i].Name
+		}
+	}
+	im.note.Editable = false
+	if i >= len(im.m.Indexes) {
+		im.note.Update(im.g, "No indexes")
+		return
+	}
+	im.note.Update(im.g, im.m.Indexes[i].Spec)
+}
+
+// Back returns to the collections level
+func (im *indexManager) Back() {
+	im.m.SelectedListView = "collections"
+	im.m.SelectedCollection = ""
+	im.m.Indexes = nil
+
+	maxX, _ := im.g.Size()
+	im.list.Title = buildBreadcrumbTitle(im.m, "Collections", maxX/2)
+	im.list.Items = list.Items(im.m.Collections)
+	im.list.Selected = im.m.SelectedCollectionIndex
+	im.list.Update(im.g)
+
+	if v, err := im.g.View(im.note.Name); err == nil {
+		v.Title = "Editor"
+	}
+	im.note.Update(im.g, "Pick something from the list...")
+}
+
+// Create shows the form for a new index
+func (im *indexManager) Create() {
+	im.showForm("New Index", make([]string, 6))
+}
+
+// showForm shows the index form filled with values, in the order of its fields
+func (im *indexManager) showForm(title string, values []string) {
+	form := &popup.Form{
+		Name:  "indexForm",
+		Title: title,
+		Fields: []popup.FormField{
+			{Label: "Keys, e.g. {name: 1, created: -1} or {body: 'text'}", Value: values[0]},
+			{Label: "Name (optional)", Value: values[1]},
+			{Label: "Unique (yes/no)", Value: values[2]},
+			{Label: "Sparse (yes/no)", Value: values[3]},
+			{Label: "TTL in seconds (optional)", Value: values[4]},
+			{Label: "Partial filter, e.g. {status: 'active'} (optional)", Value: values[5]},
+		},
+		OnCancel: im.focusList,
+	}
+	form.OnSave = func(values []string) {
+		// Show the form again with the entered values and the problem in the title
+		retry := func(problem string) {
+			im.showForm(retryTitle(title, problem), values)
+		}
+
+		keys, err := db.ParseIndexKeys(values[0])
+		if err != nil {
+			retry("invalid keys: " + err.Error())
+			return
+		}
+		spec := db.IndexSpec{Keys: keys, Name: values[1]}
+
+		var ok bool
+		if spec.Unique, ok = parseBool(values[2]); !ok {
+			retry("unique must be yes or no")
+			return
+		}
+		if spec.Sparse, ok = parseBool(values[3]); !ok {
+			retry("sparse must be yes or no")
+			return
+		}
+		if values[4] != "" {
+			ttl, err := strconv.ParseInt(values[4], 10, 32)
+			if err != nil || ttl < 0 {
+				retry("TTL must be a number of seconds")
+				return
+			}
+			seconds := int32(ttl)
+			spec.TTL = &seconds
+		}
+		if values[5] != "" {
+			filter, err := db.ParseShellDocument(values[5])
+			if err != nil {
+				retry("invalid partial filter: " + err.Error())
+				return
+			}
+			spec.PartialFilter = filter
+		}
+
+		im.create(spec)
+	}
+
+	if err := form.Show(im.g); err != nil {
+		log.Panicln(err)
+	}
+	form.BindKeys(im.g)
+}
+
+// create builds the index in the background; ESC stops waiting for it
+func (im *indexManager) create(spec db.IndexSpec) {
+	client, dbName, collName := im.sessionClient(), im.m.SelectedDB, im.m.SelectedCollection
+	if client == nil {
+		return
+	}
+	var name string
+	popup.ShowWait(im.g, "Creating index", "Building index...", func(ctx context.Context) error {
+		var err error
+		name, err = db.CreateIndex(ctx, client, dbName, collName, spec)
+		return err
+	}, func(err error) {
+		switch {
+		case errors.Is(err, context.Canceled):
+			popup.ShowInfo(im.g, "Stopped waiting; the server may still create the index")
+		case err != nil:
+			popup.ShowInfo(im.g, "Failed to create index: "+err.Error())
+			log.Printf("Failed to create index: %v", err)
+		}
+		// The level may have changed while the index was being built
+		if im.m.SelectedListView != "indexes" || im.m.SelectedDB != dbName || im.m.SelectedCollection != collName {
+			return
+		}
+		im.reload(im.list.Selected, name)
+	})
+}
+
+// Drop asks for confirmation and drops the index under the cursor
+func (im *indexManager) Drop() {
+	if im.m.SelectedListView != "indexes" || im.list.Selected >= len(im.m.Indexes) {
+		return
+	}
+	index := im.m.Indexes[im.list.Selected]
+	if index.Name == "_id_" {
+		popup.ShowInfo(im.g, "The _id index cannot be dropped")
+		return
+	}
+
+	client := im.sessionClient()
+	if client == nil {
+		return
+	}
+	selected := im.list.Selected
+	popup.ShowConfirmation(im.g, "Drop index '"+index.Name+"'?", func() {
+		if err := db.DropIndex(client, im.m.SelectedDB, im.m.SelectedCollection, index.Name); err != nil {
+			popup.ShowInfo(im.g, "Failed to drop index: "+err.Error())
+			log.Printf("Failed to drop index: %v", err)
+			return
+		}
+		im.reload(selected, "")
+	}, func() {
+		// Cancelled - do nothing
+	})
+}
+
+// indexItems lists the indexes with their keys and options
+func indexItems(indexes []model.Index) []list.Item {
+	items := make([]list.Item, 0, len(indexes))
+	for _, index := range indexes {
+		label := index.Name + "  " + index.Keys
+		var opts []string
+		if index.Unique {
+			opts = append(opts, "unique")
+		}
+		if index.Sparse {
+			opts = append(opts, "sparse")
+		}
+		if index.TTL != nil {
+			opts = append(opts, fmt.Sprintf("ttl=%ds", *index.TTL))
+		}
+		if index.PartialFilter != "" {
+			opts = append(opts, "partial="+index.PartialFilter)
+		}
+		if len(opts) > 0 {
+			label += "  [" + strings.Join(opts, ", ") + "]"
+		}
+		items = append(items, list.Item{Label: label, Value: index.Name})
+	}
+	return items
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/awesome-gocui/gocui"
+	"github.com/ksiezykm/FerretMate/jobs"
+	"github.com/ksiezykm/FerretMate/list"
+	"github.com/ksiezykm/FerretMate/notepad"
+	"github.com/ksiezykm/FerretMate/popup"
+)
+
+// jobsPanel runs exports, uploads and other long operations in the
+// background and lists them in a panel over the screen
+type jobsPanel struct {
+	g       *gocui.Gui
+	list    *list.List
+	note    *notepad.Notepad
+	manager *jobs.Manager
+
+	active   bool
+	selected int
+	shown    []jobs.Snapshot // jobs listed in the panel, newest first
+}
+
+// newJobsPanel creates the panel; finished jobs are announced with a toast
+func newJobsPanel(g *gocui.Gui, l *list.List, n *notepad.Notepad) *jobsPanel {
+	jp := &jobsPanel{g: g, list: l, note: n, manager: &jobs.Manager{}}
+	jp.manager.OnChange = func() {
+		// Redraw the panel with the new progress
+		g.Update(func(g *gocui.Gui) error { return nil })
+	}
+	jp.manager.OnFinish = func(s jobs.Snapshot) {
+		switch s.State {
+		case jobs.Done:
+			popup.ShowToast(g, s.Title+" finished")
+		case jobs.Cancelled:
+			popup.ShowToast(g, s.Title+" cancelled")
+		default:
+			log.Printf("Job failed: %s: %v", s.Title, s.Err)
+			popup.ShowToast(g, s.Title+" failed (j: Jobs)")
+		}
+	}
+	return jp
+}
+
+// Start runs an operation as a background job. onDone, if set, is called
+// on the UI goroutine with the result.
+func (jp *jobsPanel) Start(title string, run jobs.Run, onDone func(err error)) {
+	jp.manager.Start(title, func(ctx context.Context, progress func(done, total int64)) error {
+		err := run(ctx, progress)
+		if onDone != nil {
+			jp.g.Update(func(g *gocui.Gui) error {
+				onDone(err)
+				return nil
+			})
+		}
+		return err
+	})
+	popup.ShowToast(jp.g, title+" started (j: Jobs)")
+}
+
+// Open shows the jobs panel
+func (jp *jobsPanel) Open() {
+	jp.active = true
+	jp.selected = 0
+	jp.g.Update(func(g *gocui.Gui) error {
+		if err := jp.Layout(g); err != nil {
+			return err
+		}
+		g.SetCurrentView("jobs")
+		return nil
+	})
+}
+
+// Close hides the jobs panel and returns to the list
+func (jp *jobsPanel) Close() {
+	jp.active = false
+	jp.g.DeleteView("jobs")
+	jp.g.SetCurrentView(jp.list.Name)
+}
+
+// Layout draws the panel while it is open, with the latest state of the jobs
+func (jp *jobsPanel) Layout(g *gocui.Gui) error {
+	if !jp.active {
+		return nil
+	}
+	jp.shown = jp.manager.Jobs()
+	if jp.selected >= len(jp.shown) {
+		jp.selected = len(jp.shown) - 1
+	}
+	if jp.selected < 0 {
+		jp.selected = 0
+	}
+
+	maxX, maxY := g.Size()
+	width := maxX * 2 / 3
+	height := maxY / 2
+	x0 := (maxX - width) / 2
+	y0 := (maxY - height) / 2
+	v, err := g.SetView("jobs", x0, y0, x0+width, y0+height, 0)
+	if err != nil {
+		if err != gocui.ErrUnknownView {
+			return err
+		}
+		v.Title = " Jobs "
+		v.Subtitle = " ↑↓: Navigate | c: Cancel | x: Clear finished | ESC: Close "
+		v.FrameColor = gocui.ColorCyan
+		v.SelBgColor = gocui.ColorCyan
+		v.SelFgColor = gocui.ColorBlack
+	}
+	g.SetViewOnTop("jobs")
+
+	v.Clear()
+	v.Highlight = len(jp.shown) > 0
+	if len(jp.shown) == 0 {
+		v.Write([]byte(" No jobs yet. Exports and uploads run here."))
+		return nil
+	}
+	for _, s := range jp.shown {
+		fmt.Fprintf(v, " #%-3d %-9s %-14s %8s  %s\n", s.ID, s.State, s.Progress(), s.Elapsed().Round(time.Second), s.Title)
+	}
+	if s := jp.shown[jp.selected]; s.Err != nil {
+		fmt.Fprintf(v, "\n Error of #%d:\n", s.ID)
+		for _, line := range strings.Split(s.Err.Error(), "\n") {
+			fmt.Fprintf(v, "   %s\n", line)
+		}
+	}
+	v.SetOrigin(0, 0)
+	return v.SetCursor(0, jp.selected)
+}
+
+// move moves the selection by delta jobs
+func (jp *jobsPanel) move(delta int) {
+	if n := jp.selected + delta; n >= 0 && n < len(jp.shown) {
+		jp.selected = n
+	}
+}
+
+// cancel cancels the selected job
+func (jp *jobsPanel) cancel() {
+	if jp.selected < len(jp.shown) && jp.shown[jp.selected].State == jobs.Running {
+		jp.manager.Cancel(jp.shown[jp.selected].ID)
+	}
+}
+
+// BindKeys registers the key opening the panel and the keys of the panel
+func (jp *jobsPanel) BindKeys() {
+	if err := jp.g.SetKeybinding("", 'j', gocui.ModNone, func(g *gocui.Gui, v *gocui.View) error {
+		// Only from the list or the notepad (not while editing)
+		if jp.active || v == nil || (v.Name() != jp.list.Name && v.Name() != jp.note.Name) || jp.note.Editing {
+			return nil
+		}
+		jp.Open()
+		return nil
+	}); err != nil {
+		log.Panicln(err)
+	}
+
+	bindings := []struct {
+		key     interface{}
+		handler func()
+	}{
+		{gocui.KeyArrowUp, func() { jp.move(-1) }},
+		{gocui.KeyArrowDown, func() { jp.move(1) }},
+		{'c', jp.cancel},
+		{'x', jp.manager.Clear},
+		{'j', jp.Close},
+		{gocui.KeyEsc, jp.Close},
+	}
+	for _, b := range bindings {
+		handler := b.handler
+		if err := jp.g.SetKeybinding("jobs", b.key, gocui.ModNone, func(g *gocui.Gui, v *gocui.View) error {
+			handler()
+			return nil
+		}); err != nil {
+			log.Panicln(err)
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// State is the stage of a job's life
+type State int
+
+const (
+	Running State = iota
+	Done
+	Failed
+	Cancelled
+)
+
+func (s State) String() string {
+	switch s {
+	case Running:
+		return "running"
+	case Done:
+		return "done"
+	case Failed:
+		return "failed"
+	case Cancelled:
+		return "cancelled"
+	}
+	return "unknown"
+}
+
+// Run is the work of a job. It reports progress as items done out of total
+// (total is 0 while unknown) and must stop when ctx is cancelled.
+type Run func(ctx context.Context, progress func(done, total int64)) error
+
+// notifyInterval limits how often progress triggers OnChange
+const notifyInterval = 250 * time.Millisecond
+
+// Job is one background operation
+type Job struct {
+	ID      int
+	Title   string
+	Started time.Time
+
+	mu       sync.Mutex
+	state    State
+	done     int64
+	total    int64
+	err      error
+	finished time.Time
+	notified time.Time
+	cancel   context.CancelFunc
+}
+
+// Snapshot is a consistent copy of a job's state
+type Snapshot struct {
+	ID       int
+	Title    string
+	State    State
+	Done     int64
+	Total    int64
+	Err      error
+	Started  time.Time
+	Finished time.Time
+}
+
+// Snapshot returns the current state of the job
+func (j *Job) Snapshot() Snapshot {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return Snapshot{
+		ID:       j.ID,
+		Title:    j.Title,
+		State:    j.state,
+		Done:     j.done,
+		Total:    j.total,
+		Err:      j.err,
+		Started:  j.Started,
+		Finished: j.finished,
+	}
+}
+
+// Cancel asks a running job to stop
+func (j *Job) Cancel() {
+	j.cancel()
+}
+
+// Elapsed returns how long the job ran, or has been running
+func (s Snapshot) Elapsed() time.Duration {
+	if s.Finished.IsZero() {
+		return time.Since(s.Started)
+	}
+	return s.Finished.Sub(s.Started)
+}
+
+// Progress returns the progress as text, e.g. "120/500 (24%)"
+func (s Snapshot) Progress() string {
+	if s.Total <= 0 {
+		return fmt.Sprintf("%d", s.Done)
+	}
+	return fmt.Sprintf("%d/%d (%d%%)", s.Done, s.Total, s.Done*100/s.Total)
+}
+
+// Manager starts jobs and keeps them until they are cleared
+type Manager struct {
+	OnChange func()         // called from the job goroutines when a job made progress
+	OnFinish func(Snapshot) // called from the job goroutine when a job ended
+
+	mu     sync.Mutex
+	jobs   []*Job
+	nextID int
+}
+
+// Start runs a job on its own goroutine
+func (m *Manager) Start(title string, run Run) *Job {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	m.mu.Lock()
+	m.nextID++
+	j := &Job{ID: m.nextID, Title: title, Started: time.Now(), cancel: cancel}
+	m.jobs = append(m.jobs, j)
+	m.mu.Unlock()
+	m.changed()
+
+	go func() {
+		err := run(ctx, func(done, total int64) {
+			j.mu.Lock()
+			j.done, j.total = done, total
+			notify := time.Since(j.notified) >= notifyInterval
+			if notify {
+				j.notified = time.Now()
+			}
+			j.mu.Unlock()
+			if notify {
+				m.changed()
+			}
+		})
+		cancelled := ctx.Err() != nil
+		cancel()
+
+		j.mu.Lock()
+		switch {
+		case err == nil:
+			j.state = Done
+		case cancelled || errors.Is(err, context.Canceled):
+			j.state = Cancelled
+			j.err = err
+		default:
+			j.state = Failed
+			j.err = err
+		}
+		j.finished = time.Now()
+		j.mu.Unlock()
+
+		m.changed()
+		if m.OnFinish != nil {
+			m.OnFinish(j.Snapshot())
+		}
+	}()
+	return j
+}
+
+func (m *Manager) changed() {
+	if m.OnChange != nil {
+		m.OnChange()
+	}
+}
+
+// Jobs returns the state of all jobs, newest first
+func (m *Manager) Jobs() []Snapshot {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	snapshots := make([]Snapshot, 0, len(m.jobs))
+	for i := len(m.jobs) - 1; i >= 0; i-- {
+		snapshots = append(snapshots, m.jobs[i].Snapshot())
+	}
+	return snapshots
+}
+
+// Cancel cancels the job with the given ID
+func (m *Manager) Cancel(id int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, j := range m.jobs {
+		if j.ID == id {
+			j.Cancel()
+		}
+	}
+}
+
+// CancelAll cancels all running jobs
+func (m *Manager) CancelAll() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, j := range m.jobs {
+		j.Cancel()
+	}
+}
+
+// Clear removes the finished jobs
+func (m *Manager) Clear() {
+	m.mu.Lock()
+	running := m.jobs[:0]
+	for _, j := range m.jobs {
+		if j.Snapshot().State == Running {
+			running = append(running, j)
+		}
+	}
+	m.jobs = running
+	m.mu.Unlock()
+	m.changed()
+}
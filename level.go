@@ -0,0 +1,50 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/awesome-gocui/gocui"
+	"github.com/ksiezykm/FerretMate/db"
+	"github.com/ksiezykm/FerretMate/list"
+	"github.com/ksiezykm/FerretMate/model"
+	"github.com/ksiezykm/FerretMate/popup"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// level is what the controllers of the list levels share: the UI, the model
+// of the current tab (switchTab reassigns m) and the list
+type level struct {
+	g    *gocui.Gui
+	m    *model.Model
+	list *list.List
+}
+
+// client returns the client of the selected connection's session, or nil
+func (l *level) client() *mongo.Client {
+	if s := db.Lookup(l.m.SelectedConnection); s != nil {
+		return s.Client
+	}
+	return nil
+}
+
+// sessionClient returns the client of the selected connection's session,
+// or says that the session is closed (e.g. from another tab) and returns nil
+func (l *level) sessionClient() *mongo.Client {
+	client := l.client()
+	if client == nil {
+		popup.ShowInfo(l.g, "Session '"+l.m.SelectedConnection+"' is closed")
+	}
+	return client
+}
+
+// focusList returns the focus to the list
+func (l *level) focusList() {
+	l.g.SetCurrentView(l.list.Name)
+	l.g.Cursor = false
+}
+
+// retryTitle is the title of a form shown again after its values were
+// rejected: the form's own title and the problem
+func retryTitle(title, problem string) string {
+	return strings.SplitN(title, " - ", 2)[0] + " - " + problem
+}
@@ -6,14 +6,35 @@ import (
 	"github.com/awesome-gocui/gocui"
 )
 
+// nearEndRows is how close to the last item the cursor must get to trigger OnNearEnd
+const nearEndRows = 20
+
+// Item is a single row of a list: the label shown and the value it stands for
+type Item struct {
+	Label string
+	Value interface{}
+}
+
+// Items wraps plain strings as items whose value is the string itself
+func Items(labels []string) []Item {
+	items := make([]Item, 0, len(labels))
+	for _, label := range labels {
+		items = append(items, Item{Label: label, Value: label})
+	}
+	return items
+}
+
 // List is a custom widget that displays selectable items
 type List struct {
-	Name     string
-	Title    string
-	Items    []string
-	Selected int
-	OnSelect func(item string) // callback when Enter is pressed
-	OnBack   func()            // callback when Esc is pressed
+	Name      string
+	Title     string
+	Subtitle  string
+	Items     []Item
+	Selected  int
+	OnSelect  func(item Item) // callback when Enter is pressed
+	OnBack    func()          // callback when Esc is pressed
+	OnMove    func(index int) // callback when the cursor moves to another item
+	OnNearEnd func()          // callback when the cursor gets close to the last item
 }
 
 // Update replaces list items and redraws the view.
@@ -23,9 +44,10 @@ func (l *List) Update(g *gocui.Gui) error {
 		return err
 	}
 	v.Title = l.Title
+	v.Subtitle = l.Subtitle
 	v.Clear()
 	for _, item := range l.Items {
-		v.Write([]byte(item + "\n"))
+		v.Write([]byte(item.Label + "\n"))
 	}
 
 	if l.Selected >= len(l.Items) {
@@ -35,12 +57,50 @@ func (l *List) Update(g *gocui.Gui) error {
 		l.Selected = 0
 	}
 
-	v.SetCursor(0, l.Selected)
-	v.SetOrigin(0, 0)
+	// Scroll so that the selected item is visible
+	_, h := v.Size()
+	oy := 0
+	if h > 0 && l.Selected >= h {
+		oy = l.Selected - h + 1
+	}
+	v.SetOrigin(0, oy)
+	v.SetCursor(0, l.Selected-oy)
 
 	return nil
 }
 
+// Append adds items to the end of the list without moving the cursor
+func (l *List) Append(g *gocui.Gui, items []Item) error {
+	l.Items = append(l.Items, items...)
+
+	v, err := g.View(l.Name)
+	if err != nil {
+		return err
+	}
+	for _, item := range items {
+		v.Write([]byte(item.Label + "\n"))
+	}
+	return nil
+}
+
+// SetSubtitle updates the subtitle shown in the bottom frame of the list
+func (l *List) SetSubtitle(g *gocui.Gui, subtitle string) {
+	l.Subtitle = subtitle
+	if v, err := g.View(l.Name); err == nil {
+		v.Subtitle = subtitle
+	}
+}
+
+// moved runs the cursor movement callbacks
+func (l *List) moved() {
+	if l.OnMove != nil {
+		l.OnMove(l.Selected)
+	}
+	if l.OnNearEnd != nil && l.Selected >= len(l.Items)-nearEndRows {
+		l.OnNearEnd()
+	}
+}
+
 // Layout draws the list widget
 func (l *List) Layout(g *gocui.Gui) error {
 	maxX, maxY := g.Size()
@@ -59,7 +119,7 @@ func (l *List) Layout(g *gocui.Gui) error {
 				// highlight selection manually
 				v.SetCursor(0, i)
 			}
-			v.Write([]byte(item + "\n"))
+			v.Write([]byte(item.Label + "\n"))
 		}
 		if _, err := g.SetCurrentView(l.Name); err != nil {
 			return err
@@ -92,7 +152,10 @@ func (l *List) CursorUp(g *gocui.Gui, v *gocui.View) error {
 	} else if oy > 0 {
 		l.Selected--
 		v.SetOrigin(ox, oy-1)
+	} else {
+		return nil
 	}
+	l.moved()
 	return nil
 }
 
@@ -112,6 +175,7 @@ func (l *List) CursorDown(g *gocui.Gui, v *gocui.View) error {
 			l.Selected++
 			v.SetOrigin(ox, oy+1)
 		}
+		l.moved()
 	}
 	return nil
 }
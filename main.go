@@ -1,18 +1,24 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/ksiezykm/FerretMate/db"
+	"github.com/ksiezykm/FerretMate/diff"
+	"github.com/ksiezykm/FerretMate/external"
 	"github.com/ksiezykm/FerretMate/list"
 	"github.com/ksiezykm/FerretMate/model"
 	"github.com/ksiezykm/FerretMate/notepad"
 	"github.com/ksiezykm/FerretMate/popup"
 
 	"github.com/awesome-gocui/gocui"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 // buildBreadcrumbTitle builds a title with breadcrumb navigation
@@ -25,11 +31,11 @@ func buildBreadcrumbTitle(m *model.Model, baseTitle string, maxWidth int) string
 		parts = append(parts, m.SelectedConnection)
 	}
 
-	if m.SelectedDB != "" && (m.SelectedListView == "dbs" || m.SelectedListView == "collections" || m.SelectedListView == "documents") {
+	if m.SelectedDB != "" && (m.SelectedListView == "dbs" || m.SelectedListView == "collections" || m.SelectedListView == "documents" || m.SelectedListView == "indexes" || m.SelectedListView == "pipeline") {
 		parts = append(parts, m.SelectedDB)
 	}
 
-	if m.SelectedCollection != "" && (m.SelectedListView == "collections" || m.SelectedListView == "documents") {
+	if m.SelectedCollection != "" && (m.SelectedListView == "collections" || m.SelectedListView == "documents" || m.SelectedListView == "indexes" || m.SelectedListView == "pipeline") {
 		parts = append(parts, m.SelectedCollection)
 	}
 
@@ -47,6 +53,24 @@ func buildBreadcrumbTitle(m *model.Model, baseTitle string, maxWidth int) string
 		return baseTitle // Not enough space
 	}
 
+	// Reserve room for the active query on the documents level
+	query := ""
+	if m.SelectedListView == "documents" && !m.Query.IsEmpty() {
+		query = m.Query.String()
+		maxQuery := availableWidth / 3
+		if maxQuery > availableWidth-20-3 {
+			maxQuery = availableWidth - 20 - 3
+		}
+		if maxQuery < 8 {
+			query = "" // Not enough space
+		} else if len(query) > maxQuery {
+			query = query[:maxQuery-3] + "..."
+		}
+		if query != "" {
+			availableWidth -= len(query) + 3
+		}
+	}
+
 	// Truncate parts with priority for the last (most specific) element
 	var truncatedParts []string
 	if len(parts) == 1 {
@@ -101,16 +125,103 @@ func buildBreadcrumbTitle(m *model.Model, baseTitle string, maxWidth int) string
 		}
 	}
 
+	if query != "" {
+		breadcrumb += " | " + query
+	}
+
 	return prefix + breadcrumb
 }
 
+// documentItems binds each document row of the list to its real _id value
+func documentItems(docs []model.Document) []list.Item {
+	items := make([]list.Item, 0, len(docs))
+	for _, doc := range docs {
+		items = append(items, list.Item{Label: doc.Summary, Value: doc.ID})
+	}
+	return items
+}
+
+// headerText returns the tab bar followed by the live sessions, the current
+// one marked with *, as far as they fit in width
+func headerText(width int, tabs []*tab, currentTab int, currentConn string) string {
+	bar, barLen := tabBar(tabs, currentTab)
+
+	var sessions []string
+	for _, name := range db.SessionNames() {
+		if name == currentConn {
+			name += "*"
+		}
+		sessions = append(sessions, name)
+	}
+	if len(sessions) == 0 {
+		return bar
+	}
+
+	right := "Sessions: " + strings.Join(sessions, ", ") + " "
+	if gap := width - barLen - len([]rune(right)); gap >= 2 {
+		return bar + strings.Repeat(" ", gap) + right
+	}
+	return bar
+}
+
+// footerText returns the key help for the current list level
+func footerText(m *model.Model) string {
+	switch m.SelectedListView {
+	case "connections":
+		return " ↑↓: Navigate | Enter: Connect | N: New | E: Edit | C: Clone | T: TLS | S: SSH | I: Diagnose | X: Close session | J/K: Reorder | Del: Delete | Ctrl+T/W/N/P: Tabs | Ctrl+C: Quit"
+	case "dbs":
+		return " ↑↓: Navigate | Enter: Collections | N: New | D: Export | U: Restore dump | R: Restore export | j: Jobs | Del: Delete | ':': Command | ESC: Back | Ctrl+T/W/N/P: Tabs | Ctrl+C: Quit"
+	case "collections":
+		return " ↑↓: Navigate | Enter: Documents | I: Indexes | A: Aggregate | N: New | D: Export | U: Upload | R: Restore | j: Jobs | Del: Delete | ':': Command | ESC: Back | Ctrl+T/W/N/P: Tabs | Ctrl+C: Quit"
+	case "indexes":
+		return " ↑↓: Navigate | N: New index | Del: Drop index | ESC: Back | Ctrl+T/W/N/P: Tabs | Ctrl+C: Quit"
+	case "pipeline":
+		return " ↑↓: Navigate | Enter: Edit stage | N: New stage | T: Toggle | J/K: Reorder | S: Save | L: Load | D: Export | Del: Delete | ESC: Back | Ctrl+C: Quit"
+	}
+	return " ↑↓: Navigate | Enter: Select | N: New | F: Query | A: Aggregate | E: Edit | Ctrl+E: $EDITOR | D: Export | U: Upload | j: Jobs | [/]: Mark left/right | =: Compare | Del: Delete | ':': Command | ESC: Back | Ctrl+T/W/N/P: Tabs | Ctrl+C: Quit"
+}
+
+// exportFormats are the single-file layouts offered when exporting a
+// collection or the results of a query
+var exportFormats = []struct {
+	label  string
+	format db.ExportFormat
+	gzip   bool
+}{
+	{"JSON Lines (.jsonl)", db.FormatJSONLines, false},
+	{"JSON Lines, gzip (.jsonl.gz)", db.FormatJSONLines, true},
+	{"JSON array (.json)", db.FormatJSONArray, false},
+	{"JSON array, gzip (.json.gz)", db.FormatJSONArray, true},
+}
+
+// exportName returns the file name (without extension) of an export of a
+// collection; query results get a timestamp so they do not replace each other
+func exportName(collName string, query model.Query) string {
+	if query.IsEmpty() {
+		return collName
+	}
+	return collName + "-query-" + time.Now().Format("20060102-150405")
+}
+
+// conflictState is a save that was rejected because the document changed
+// since it was opened
+type conflictState struct {
+	title   string   // notepad title of the document
+	base    string   // snapshot taken when the document was opened
+	mine    string   // the rejected edit
+	theirs  string   // the currently stored version
+	merged  string   // three-way merge of the top-level fields
+	fields  []string // fields changed on both sides
+	deleted bool     // true if the document was deleted in the meantime
+}
+
 func main() {
 	g, err := gocui.NewGui(gocui.OutputNormal, true)
 	if err != nil {
 		log.Panicln(err)
 	}
 	defer g.Close()
-	defer db.Disconnect() // Close MongoDB connection on exit
+	defer db.CloseAll() // Close all sessions on exit
 
 	g.Cursor = false
 
@@ -119,15 +230,10 @@ func main() {
 		log.Panicln(err)
 	}
 
-	var connNames []string
-	for _, c := range connections {
-		connNames = append(connNames, c.Name)
-	}
-
 	m := &model.Model{
 		SelectedListView:   "connections",
 		LoadedConnections:  connections,
-		Connections:        connNames,
+		Connections:        model.ConnectionNames(connections),
 		SelectedConnection: "",
 
 		DBs:        []string{},
@@ -136,11 +242,30 @@ func main() {
 		Collections:        []string{},
 		SelectedCollection: "",
 
-		Documents:        []string{},
-		DocumentObjects:  make(map[string]interface{}),
-		SelectedDocument: "",
+		Documents:        []model.Document{},
+		SelectedDocument: nil,
+	}
+
+	// Tabs, each with its own model; m is the model of the current tab
+	tabs := []*tab{{m: m}}
+	currentTab := 0
+
+	// currentClient returns the client of the selected connection's session
+	currentClient := func() *mongo.Client {
+		if s := db.Lookup(m.SelectedConnection); s != nil {
+			return s.Client
+		}
+		return nil
+	}
 
-		DocumentContent: make(map[string]string),
+	// sessionClient returns the client of the selected connection's session,
+	// or says that the session is closed (e.g. from another tab) and returns nil
+	sessionClient := func() *mongo.Client {
+		client := currentClient()
+		if client == nil {
+			popup.ShowInfo(g, "Session '"+m.SelectedConnection+"' is closed")
+		}
+		return client
 	}
 
 	// Create notepad
@@ -151,12 +276,122 @@ func main() {
 		Content:  "Pick something from the list...",
 	}
 
+	// conflict is the pending save conflict shown in the notepad, if any
+	var conflict *conflictState
+
+	// Indexes and aggregation pipelines of a collection, created with the list
+	var idxManager *indexManager
+	var pipeBuilder *pipelineBuilder
+
+	// showDocument displays an editable document in the notepad
+	showDocument := func(title, content string) {
+		if v, err := g.View(note.Name); err == nil {
+			v.Title = title
+		}
+		conflict = nil
+		note.Editable = true
+		note.Update(g, content)
+	}
+
+	// showDiff renders a diff in the notepad and returns a func restoring the previous content
+	showDiff := func(title string, changes []diff.Line) func() {
+		prevContent, prevEditable, prevTitle := note.Content, note.Editable, note.Title
+		if v, err := g.View(note.Name); err == nil {
+			prevTitle = v.Title
+			v.Title = title
+		}
+		note.Editable = false
+		note.Update(g, diff.Format(changes))
+
+		return func() {
+			if v, err := g.View(note.Name); err == nil {
+				v.Title = prevTitle
+			}
+			note.Editable = prevEditable
+			note.Update(g, prevContent)
+		}
+	}
+
+	// documentTitle returns the notepad title of the opened document
+	documentTitle := func() string {
+		if m.SelectedDocumentIndex < len(m.Documents) {
+			return "Document: " + m.Documents[m.SelectedDocumentIndex].Summary
+		}
+		return "Document"
+	}
+
+	// saveDocument writes the edited document unless it changed since it was opened,
+	// and returns the stored version, which becomes the new snapshot
+	saveDocument := func(docID interface{}, content string) (string, error) {
+		client := currentClient()
+		if client == nil {
+			return "", fmt.Errorf("session '%s' is closed", m.SelectedConnection)
+		}
+		if err := db.UpdateDocument(client, m.SelectedDB, m.SelectedCollection, docID, m.DocumentSnapshot, content); err != nil {
+			return "", err
+		}
+
+		// Re-fetch document from database
+		freshDoc, err := db.GetDocument(client, m.SelectedDB, m.SelectedCollection, docID)
+		if err != nil {
+			freshDoc = content
+		}
+		m.DocumentSnapshot = freshDoc
+		return freshDoc, nil
+	}
+
+	// showConflict renders the three-way conflict view for a rejected save
+	showConflict := func(mine string, conflictErr *db.ConflictError) {
+		c := &conflictState{title: documentTitle(), base: m.DocumentSnapshot, mine: mine, theirs: conflictErr.Theirs, deleted: conflictErr.Deleted}
+
+		var b strings.Builder
+		b.WriteString(conflictErr.Error() + "\n")
+		if c.deleted {
+			c.merged = mine
+			b.WriteString("t: Discard mine | m: Re-create with mine | ESC: Back\n\n")
+		} else {
+			merged, fields, err := db.MergeDocuments(c.base, c.mine, c.theirs)
+			if err != nil {
+				merged = mine
+				fields = []string{err.Error()}
+			}
+			c.merged, c.fields = merged, fields
+			b.WriteString("t: Take theirs | m: Keep mine | g: Edit merged | ESC: Back\n\n")
+			b.WriteString("=== Theirs (changes since opened) ===\n")
+			b.WriteString(diff.Format(diff.Lines(c.base, c.theirs)) + "\n\n")
+		}
+		b.WriteString("=== Mine (your changes) ===\n")
+		b.WriteString(diff.Format(diff.Lines(c.base, c.mine)) + "\n\n")
+		if !c.deleted {
+			title := "=== Merged ==="
+			if len(c.fields) > 0 {
+				title = "=== Merged (conflicting fields keep mine: " + strings.Join(c.fields, ", ") + ") ==="
+			}
+			b.WriteString(title + "\n")
+			b.WriteString(c.merged)
+		}
+
+		if v, err := g.View(note.Name); err == nil {
+			v.Title = "Conflict: " + strings.TrimPrefix(c.title, "Document: ")
+		}
+		note.Editable = false
+		note.Update(g, b.String())
+		note.SetActive(g, true)
+		g.SetCurrentView(note.Name)
+		conflict = c
+	}
+
 	// Create popup for line editing
 	var editPopup *popup.Popup
 	var currentEditLine int
 
 	// Set up notepad's edit line callback
 	note.OnEditLine = func(lineNum int, oldLine string) {
+		// Stages are edited in place
+		if m.SelectedListView == "pipeline" {
+			note.StartEditing(g)
+			return
+		}
 		currentEditLine = lineNum
 
 		editPopup = &popup.Popup{
@@ -171,9 +406,8 @@ func main() {
 				// Rebuild the full content
 				newFullContent := strings.Join(note.Lines, "\n")
 
-				// Validate JSON before saving
-				var jsonTest interface{}
-				if err := json.Unmarshal([]byte(newFullContent), &jsonTest); err != nil {
+				// Validate Extended JSON before saving
+				if _, err := db.ParseDocument(newFullContent); err != nil {
 					// Invalid JSON - restore old line and show error
 					note.Lines[currentEditLine] = oldLine
 					log.Printf("Invalid JSON: %v", err)
@@ -188,11 +422,17 @@ func main() {
 				}
 
 				// Update the document in model
-				if m.SelectedDocument != "" {
-					m.DocumentContent[m.SelectedDocument] = newFullContent
-
+				if m.SelectedDocument != nil {
 					// Save to database
-					if err := db.UpdateDocument(db.Client, m.SelectedDB, m.SelectedCollection, newFullContent); err != nil {
+					freshDoc, err := saveDocument(m.SelectedDocument, newFullContent)
+					var conflictErr *db.ConflictError
+					if errors.As(err, &conflictErr) {
+						g.DeleteView(editPopup.Name)
+						g.DeleteKeybindings(editPopup.Name)
+						showConflict(newFullContent, conflictErr)
+						return
+					}
+					if err != nil {
 						log.Printf("Failed to save document: %v", err)
 
 						// Close edit popup first
@@ -202,19 +442,8 @@ func main() {
 						// Show error message
 						popup.ShowInfoWithFocus(g, fmt.Sprintf("Failed to save: %v", err), note.Name)
 						return
-					} else {
-						// Re-fetch document from database
-						if docID, ok := m.DocumentObjects[m.SelectedDocument]; ok {
-							if freshDoc, err := db.GetDocument(db.Client, m.SelectedDB, m.SelectedCollection, docID); err == nil {
-								m.DocumentContent[m.SelectedDocument] = freshDoc
-								note.Update(g, freshDoc)
-							} else {
-								note.Update(g, newFullContent)
-							}
-						} else {
-							note.Update(g, newFullContent)
-						}
 					}
+					note.Update(g, freshDoc)
 				} else {
 					note.Update(g, newFullContent)
 				}
@@ -247,14 +476,104 @@ func main() {
 		editPopup.BindKeys(g)
 	}
 
+	// Set up notepad's save callback for the multi-line editing mode
+	note.OnSave = func(content string) {
+		if m.SelectedListView == "pipeline" {
+			pipeBuilder.SaveStage(content)
+			return
+		}
+		if m.SelectedDocument == nil {
+			return
+		}
+
+		// Validate Extended JSON and point the cursor at syntax errors
+		if _, err := db.ParseDocument(content); err != nil {
+			var parseErr *db.ParseError
+			if errors.As(err, &parseErr) {
+				note.SetCursorPosition(g, parseErr.Line, parseErr.Column)
+			}
+			popup.ShowInfoWithFocus(g, fmt.Sprintf("Invalid JSON: %v", err), note.Name)
+			return
+		}
+
+		freshDoc, err := saveDocument(m.SelectedDocument, content)
+		var conflictErr *db.ConflictError
+		if errors.As(err, &conflictErr) {
+			note.StopEditing(g, m.DocumentSnapshot)
+			showConflict(content, conflictErr)
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to save document: %v", err)
+			popup.ShowInfoWithFocus(g, fmt.Sprintf("Failed to save: %v", err), note.Name)
+			return
+		}
+		note.StopEditing(g, freshDoc)
+	}
+
 	var listView *list.List
+	var pager *db.DocumentPager
+
+	// pageIndicator describes the page of the selected document, e.g. "page 2 / ~15"
+	pageIndicator := func() string {
+		if pager == nil {
+			return ""
+		}
+		page := listView.Selected/db.DocumentPageSize + 1
+		if pages := pager.Pages(); pages >= 0 {
+			return fmt.Sprintf(" page %d / ~%d ", page, pages)
+		}
+		return fmt.Sprintf(" page %d / ? ", page)
+	}
+
+	// loadNextPage appends the next page of documents to the model
+	loadNextPage := func() error {
+		docs, err := pager.Next()
+		m.Documents = append(m.Documents, docs...)
+		return err
+	}
+
+	// loadDocuments opens a new pager for a collection and loads its first page
+	loadDocuments := func(dbName, collName string, query model.Query) error {
+		client := currentClient()
+		if client == nil {
+			return fmt.Errorf("session '%s' is closed", m.SelectedConnection)
+		}
+		newPager, err := db.OpenDocuments(client, dbName, collName, query)
+		if err != nil {
+			return err
+		}
+		if pager != nil {
+			pager.Close()
+		}
+		pager = newPager
+
+		m.Documents = []model.Document{}
+		return loadNextPage()
+	}
+
+	// closeDocuments releases the pager when leaving the documents level
+	closeDocuments := func() {
+		if pager != nil {
+			pager.Close()
+			pager = nil
+		}
+		listView.Subtitle = ""
+	}
+	defer closeDocuments()
 
 	// Set up notepad's back callback
 	note.OnBack = func() {
+		if m.SelectedListView == "pipeline" {
+			pipeBuilder.FocusList()
+			return
+		}
+
 		// Go back to document list
 		maxX, _ := g.Size()
 		listView.Title = buildBreadcrumbTitle(m, "Documents", maxX/2)
-		listView.Items = m.Documents
+		listView.Subtitle = pageIndicator()
+		listView.Items = documentItems(m.Documents)
 		listView.Update(g)
 
 		// Update border colors
@@ -267,49 +586,93 @@ func main() {
 		}
 	}
 
+	// Preview the stage being edited on the pipeline level
+	note.OnChange = func(content string) {
+		if m.SelectedListView == "pipeline" {
+			pipeBuilder.Changed(content)
+		}
+	}
+
 	// Create list with callback
 	listView = &list.List{
 		Name:     "listView",
 		Title:    "Connections",
-		Items:    m.Connections,
+		Items:    connectionItems(m.Connections),
 		Selected: 0,
-		OnSelect: func(item string) {
+		OnSelect: func(item list.Item) {
+			// Connections, databases and collections are identified by name
+			name, _ := item.Value.(string)
+
+			// Below the connections the session must still be open
+			if m.SelectedListView != "connections" && sessionClient() == nil {
+				return
+			}
 
 			if m.SelectedListView == "connections" {
-				m.SelectedConnection = item
+				m.SelectedConnection = name
 				m.SelectedConnectionIndex = listView.Selected
 
 				var selectedConn model.Connection
 				for _, c := range m.LoadedConnections {
-					if c.Name == item {
+					if c.Name == name {
 						selectedConn = c
 						break
 					}
 				}
 
-				popup.ShowConnect(g, selectedConn, func() error {
-					dbs, err := db.ListDatabases(db.Client)
-					if err != nil {
-						return err
+				// showDBs lists the databases of the open session in a task
+				// and shows them, unless another tab was opened meanwhile
+				tabModel := m
+				showDBs := func() {
+					s := db.Lookup(name)
+					if s == nil {
+						popup.ShowInfo(g, "Session '"+name+"' is closed")
+						return
 					}
-					m.DBs = dbs
-					m.SelectedListView = "dbs"
+					var dbs []string
+					popup.ShowTask(g, "Databases", "Listing databases...", func(ctx context.Context) error {
+						var err error
+						dbs, err = db.ListDatabasesContext(ctx, s.Client)
+						return err
+					}, func(err error) {
+						switch {
+						case m != tabModel || errors.Is(err, context.Canceled):
+							return
+						case err != nil:
+							popup.ShowInfo(g, "Failed to list databases: "+err.Error())
+							return
+						}
+						m.DBs = dbs
+						m.SelectedListView = "dbs"
 
-					g.Update(func(g *gocui.Gui) error {
 						maxX, _ := g.Size()
 						listView.Title = buildBreadcrumbTitle(m, "DBs", maxX/2)
-						listView.Items = m.DBs
+						listView.Items = list.Items(m.DBs)
 						listView.Selected = m.SelectedDBIndex
-						return listView.Update(g)
+						listView.Update(g)
 					})
-					return nil
+				}
+
+				// Jump straight in when the session is already open
+				if db.Lookup(name) != nil {
+					showDBs()
+					return
+				}
+
+				popup.ShowConnect(g, selectedConn, func() error {
+					if m != tabModel {
+						return nil
+					}
+					listView.Items = connectionItems(m.Connections)
+					showDBs()
+					return listView.Update(g)
 				})
 				return
 			} else if m.SelectedListView == "dbs" {
-				m.SelectedDB = item
+				m.SelectedDB = name
 				m.SelectedDBIndex = listView.Selected
 
-				colls, err := db.ListCollections(db.Client, item)
+				colls, err := db.ListCollections(currentClient(), name)
 				if err != nil {
 					log.Printf("Failed to list collections: %v", err)
 					return
@@ -320,58 +683,51 @@ func main() {
 
 				maxX, _ := g.Size()
 				listView.Title = buildBreadcrumbTitle(m, "Collections", maxX/2)
-				listView.Items = m.Collections
+				listView.Items = list.Items(m.Collections)
 				listView.Selected = m.SelectedCollectionIndex
 
 				listView.Update(g)
 			} else if m.SelectedListView == "collections" {
-				m.SelectedCollection = item
+				m.SelectedCollection = name
 				m.SelectedCollectionIndex = listView.Selected
+				m.Query = model.Query{}
 
-				docs, err := db.ListDocuments(db.Client, m.SelectedDB, item)
-				if err != nil {
+				if err := loadDocuments(m.SelectedDB, name, m.Query); err != nil {
 					log.Printf("Failed to list documents: %v", err)
 					return
 				}
 
-				m.DocumentContent = make(map[string]string)
-				m.DocumentObjects = make(map[string]interface{})
-				m.Documents = []string{}
-				for i, doc := range docs {
-					name := doc.Summary
-					if name == "" {
-						name = item + "_" + string(rune('0'+i))
-					}
-					m.Documents = append(m.Documents, name)
-					m.DocumentContent[name] = doc.JSON
-					m.DocumentObjects[name] = doc.ID
-				}
-
 				m.SelectedListView = "documents"
 
 				maxX, _ := g.Size()
 				listView.Title = buildBreadcrumbTitle(m, "Documents", maxX/2)
-				listView.Items = m.Documents
+				listView.Items = documentItems(m.Documents)
+				listView.Selected = 0
+				listView.Subtitle = pageIndicator()
 
 				listView.Update(g)
+			} else if m.SelectedListView == "indexes" {
+				idxManager.Show(listView.Selected)
+			} else if m.SelectedListView == "pipeline" {
+				pipeBuilder.Edit()
 			} else if m.SelectedListView == "documents" {
 				// Display the selected document in the notepad
-				m.SelectedDocument = item
+				m.SelectedDocument = item.Value
+				m.SelectedDocumentIndex = listView.Selected
 
-				// Get the document content from mockup data
-				var content string
-				if docContent, exists := m.DocumentContent[item]; exists {
-					content = docContent
-				} else {
-					content = "{\n  \"_id\": \"" + item + "\",\n  \"error\": \"Document not found in mockup data\"\n}"
+				// Fetch the full document body only now that it is opened
+				content, err := db.GetDocument(currentClient(), m.SelectedDB, m.SelectedCollection, m.SelectedDocument)
+				if err != nil {
+					log.Printf("Failed to get document: %v", err)
+					popup.ShowInfo(g, "Failed to load document: "+err.Error())
+					return
 				}
 
+				// Keep a snapshot to detect concurrent changes on save
+				m.DocumentSnapshot = content
+
 				// Update notepad title and content
-				v, err := g.View(note.Name)
-				if err == nil {
-					v.Title = "Document: " + item
-				}
-				note.Update(g, content)
+				showDocument("Document: "+item.Label, content)
 
 				// Update border colors
 				listView.SetActive(g, false)
@@ -404,19 +760,49 @@ func main() {
 
 				// Otherwise, go back to collections
 				m.SelectedListView = "collections"
-				m.SelectedDocument = ""
+				m.SelectedDocument = nil
+				m.DocumentSnapshot = ""
+				conflict = nil
+				m.Query = model.Query{}
+				closeDocuments()
 
 				maxX, _ := g.Size()
 				listView.Title = buildBreadcrumbTitle(m, "Collections", maxX/2)
-				listView.Items = m.Collections
+				listView.Items = list.Items(m.Collections)
 				listView.Selected = m.SelectedCollectionIndex
 				listView.Update(g)
 
+				note.Editable = false
 				note.Update(g, "Pick something from the list...")
 				v, err := g.View(note.Name)
 				if err == nil {
 					v.Title = "Editor"
 				}
+			} else if m.SelectedListView == "indexes" {
+				idxManager.Back()
+			} else if m.SelectedListView == "pipeline" {
+				// Go back to where the pipeline was opened
+				pipeBuilder.Close()
+				m.SelectedListView = m.PipelineFrom
+				maxX, _ := g.Size()
+				listView.Subtitle = ""
+				if m.SelectedListView == "documents" {
+					listView.Title = buildBreadcrumbTitle(m, "Documents", maxX/2)
+					listView.Subtitle = pageIndicator()
+					listView.Items = documentItems(m.Documents)
+					listView.Selected = m.SelectedDocumentIndex
+				} else {
+					listView.Title = buildBreadcrumbTitle(m, "Collections", maxX/2)
+					listView.Items = list.Items(m.Collections)
+					listView.Selected = m.SelectedCollectionIndex
+				}
+				listView.Update(g)
+
+				note.Editable = false
+				note.Update(g, "Pick something from the list...")
+				if v, err := g.View(note.Name); err == nil {
+					v.Title = "Editor"
+				}
 			} else if m.SelectedListView == "collections" {
 				// Go back to DBs
 				m.SelectedListView = "dbs"
@@ -424,7 +810,7 @@ func main() {
 
 				maxX, _ := g.Size()
 				listView.Title = buildBreadcrumbTitle(m, "DBs", maxX/2)
-				listView.Items = m.DBs
+				listView.Items = list.Items(m.DBs)
 				listView.Selected = m.SelectedDBIndex
 				listView.Update(g)
 			} else if m.SelectedListView == "dbs" {
@@ -434,14 +820,74 @@ func main() {
 
 				maxX, _ := g.Size()
 				listView.Title = buildBreadcrumbTitle(m, "Connections", maxX/2)
-				listView.Items = m.Connections
+				listView.Items = connectionItems(m.Connections)
 				listView.Selected = m.SelectedConnectionIndex
 				listView.Update(g)
 			}
 			// If already at connections, do nothing (or could quit)
 		},
+		OnMove: func(index int) {
+			if m.SelectedListView == "documents" {
+				listView.SetSubtitle(g, pageIndicator())
+			} else if m.SelectedListView == "indexes" {
+				idxManager.Show(index)
+			} else if m.SelectedListView == "pipeline" {
+				pipeBuilder.Show(index)
+			}
+		},
+		OnNearEnd: func() {
+			if m.SelectedListView != "documents" || pager == nil || pager.Done {
+				return
+			}
+			loaded := len(m.Documents)
+			if err := loadNextPage(); err != nil {
+				log.Printf("Failed to load next page: %v", err)
+			}
+			listView.Append(g, documentItems(m.Documents[loaded:]))
+			listView.SetSubtitle(g, pageIndicator())
+		},
+	}
+
+	// Side-by-side comparison of two marked documents, shown over the notepad
+	comparer := newComparison(g, m, listView, note)
+
+	// Statistics of the databases and collections, fetched in the background
+	stats := newStatsPanel(g, m, listView, note)
+
+	// Console for raw database commands, below the notepad
+	commands := newCommandConsole(g, m, listView, note)
+
+	// Exports and uploads run as background jobs, listed in a panel
+	jobPanel := newJobsPanel(g, listView, note)
+	defer jobPanel.manager.CancelAll()
+
+	// Restore of an export directory tree, from the databases and collections levels
+	// base is what the level controllers share
+	base := level{g: g, m: m, list: listView}
+
+	restorer := &treeRestore{level: base, note: note, jobs: jobPanel, stats: stats}
+
+	// CSV/TSV export with column selection
+	csvExport := &csvExporter{level: base, jobs: jobPanel}
+
+	// reloadUploaded refreshes the document list if it still shows the
+	// collection documents were uploaded to
+	reloadUploaded := func(dbName, collName string) {
+		if m.SelectedListView != "documents" || m.SelectedDB != dbName || m.SelectedCollection != collName {
+			return
+		}
+		if err := loadDocuments(dbName, collName, m.Query); err != nil {
+			return
+		}
+		listView.Items = documentItems(m.Documents)
+		listView.Selected = len(m.Documents) - 1 // Select the newly uploaded document
+		listView.Subtitle = pageIndicator()
+		listView.Update(g)
 	}
 
+	// CSV/TSV import with type inference and column mapping
+	csvImport := &csvImporter{level: base, note: note, jobs: jobPanel, stats: stats, onDone: reloadUploaded}
+
 	// Layout manager
 	g.SetManagerFunc(func(g *gocui.Gui) error {
 		maxX, maxY := g.Size()
@@ -451,14 +897,13 @@ func main() {
 				return err
 			}
 			v.Frame = true
-			v.Title = ""
+			v.Title = " FerretMate - MongoDB/FerretDB TUI Client "
+		}
+
+		// Update header content dynamically, with the tabs and live sessions
+		if v, err := g.View("header"); err == nil {
 			v.Clear()
-			title := "FerretMate - MongoDB/FerretDB TUI Client"
-			padding := (maxX - len(title) - 2) / 2
-			if padding < 0 {
-				padding = 0
-			}
-			v.Write([]byte(strings.Repeat(" ", padding) + title))
+			v.Write([]byte(headerText(maxX-2, tabs, currentTab, m.SelectedConnection)))
 		}
 
 		// Footer view with key information
@@ -473,29 +918,404 @@ func main() {
 		// Update footer content dynamically
 		if v, err := g.View("footer"); err == nil {
 			v.Clear()
-			v.Write([]byte(" ↑↓: Navigate | Enter: Select | N: New | D: Export | U: Upload | Del: Delete | ESC: Back | Ctrl+C: Quit"))
+			v.Write([]byte(footerText(m)))
 		}
 
 		if err := listView.Layout(g); err != nil {
 			return err
 		}
+		if err := pipeBuilder.Layout(g); err != nil {
+			return err
+		}
 		if err := note.Layout(g); err != nil {
 			return err
 		}
-		return nil
+		if err := stats.Layout(g); err != nil {
+			return err
+		}
+		if err := commands.Layout(g); err != nil {
+			return err
+		}
+		if err := comparer.Layout(g); err != nil {
+			return err
+		}
+		return jobPanel.Layout(g)
 	})
 
 	// Bind keys
 	listView.BindKeys(g)
+
+	// Connection manager on the connections level
+	connManager := &connectionManager{level: base, note: note}
+	// Tabs still browsing a closed session go back to the connections
+	connManager.onClose = func(name string) {
+		for i, t := range tabs {
+			if i != currentTab && t.m.SelectedConnection == name {
+				t.leaveSession(listView.Name)
+			}
+		}
+	}
+	idxManager = &indexManager{level: base, note: note}
+	pipeBuilder = &pipelineBuilder{level: base, note: note}
+
+	// levelKeys are the list keys whose action depends on the level of the
+	// list. A view gets a key from one binding only, so each key is bound
+	// once and dispatched to the feature of the current level.
+	levelKeys := map[string]map[rune]func(){
+		"connections": connManager.Keys(),
+		"collections": {'i': idxManager.Open},
+		"pipeline": {
+			't': pipeBuilder.Toggle,
+			's': pipeBuilder.Save,
+			'K': func() { pipeBuilder.Move(-1) },
+			'J': func() { pipeBuilder.Move(1) },
+		},
+	}
+	bound := map[rune]bool{}
+	for _, keys := range levelKeys {
+		for key := range keys {
+			if bound[key] {
+				continue
+			}
+			bound[key] = true
+			if err := g.SetKeybinding(listView.Name, key, gocui.ModNone, func(g *gocui.Gui, v *gocui.View) error {
+				if action, ok := levelKeys[m.SelectedListView][key]; ok {
+					action()
+				}
+				return nil
+			}); err != nil {
+				log.Panicln(err)
+			}
+		}
+	}
+	comparer.BindKeys()
+	commands.BindKeys()
+	jobPanel.BindKeys()
+	if err := g.SetKeybinding("", 'r', gocui.ModNone, func(g *gocui.Gui, v *gocui.View) error {
+		if v == nil || v.Name() != listView.Name {
+			return nil
+		}
+		restorer.Open()
+		return nil
+	}); err != nil {
+		log.Panicln(err)
+	}
+
+	// switchTab saves the current tab and shows tab i
+	switchTab := func(i int) {
+		if i == currentTab || i < 0 || i >= len(tabs) {
+			return
+		}
+		if m.SelectedListView == "pipeline" {
+			pipeBuilder.Close()
+		}
+		t := tabs[currentTab]
+		t.m, t.pager, t.conflict = m, pager, conflict
+		t.saveWidgets(g, listView, note)
+
+		next := tabs[i]
+		// Connections are shared by all tabs
+		next.m.LoadedConnections, next.m.Connections = m.LoadedConnections, m.Connections
+		if next.m.SelectedListView == "connections" {
+			next.listItems = connectionItems(next.m.Connections)
+		}
+
+		currentTab = i
+		m, pager, conflict = next.m, next.pager, next.conflict
+		connManager.m, comparer.m, idxManager.m, stats.m, pipeBuilder.m, commands.m, restorer.m, csvExport.m, csvImport.m = m, m, m, m, m, m, m, m, m
+		next.restoreWidgets(g, listView, note)
+		if m.SelectedListView == "pipeline" {
+			pipeBuilder.Show(listView.Selected)
+		}
+	}
+
+	// Tab keys work from the list and the notepad, not from popups or while editing
+	tabKey := func(action func()) func(g *gocui.Gui, v *gocui.View) error {
+		return func(g *gocui.Gui, v *gocui.View) error {
+			if v == nil || (v.Name() != listView.Name && v.Name() != note.Name) || note.Editing {
+				return nil
+			}
+			action()
+			return nil
+		}
+	}
+	tabBindings := []struct {
+		key    gocui.Key
+		action func()
+	}{
+		// Ctrl+T: open a new tab at the connections level
+		{gocui.KeyCtrlT, func() {
+			newModel := &model.Model{
+				SelectedListView:  "connections",
+				LoadedConnections: m.LoadedConnections,
+				Connections:       m.Connections,
+				Documents:         []model.Document{},
+			}
+			tabs = append(tabs, &tab{
+				m:           newModel,
+				listItems:   connectionItems(newModel.Connections),
+				listTitle:   "Connections",
+				noteTitle:   "Editor",
+				noteContent: "Pick something from the list...",
+				focus:       listView.Name,
+			})
+			switchTab(len(tabs) - 1)
+		}},
+		// Ctrl+W: close the current tab
+		{gocui.KeyCtrlW, func() {
+			if len(tabs) == 1 {
+				return
+			}
+			closing := currentTab
+			if closing == len(tabs)-1 {
+				switchTab(closing - 1)
+			} else {
+				switchTab(closing + 1)
+			}
+			if tabs[closing].pager != nil {
+				tabs[closing].pager.Close()
+			}
+			tabs = append(tabs[:closing], tabs[closing+1:]...)
+			if currentTab > closing {
+				currentTab--
+			}
+		}},
+		// Ctrl+N / Ctrl+P: next and previous tab
+		{gocui.KeyCtrlN, func() { switchTab((currentTab + 1) % len(tabs)) }},
+		{gocui.KeyCtrlP, func() { switchTab((currentTab - 1 + len(tabs)) % len(tabs)) }},
+	}
+	for _, b := range tabBindings {
+		if err := g.SetKeybinding("", b.key, gocui.ModNone, tabKey(b.action)); err != nil {
+			log.Panicln(err)
+		}
+	}
+
+	// Release the document cursors of the other tabs on exit
+	defer func() {
+		for i, t := range tabs {
+			if i != currentTab && t.pager != nil {
+				t.pager.Close()
+			}
+		}
+	}()
 	note.BindKeys(g)
 
 	// Set initial border colors (list is active by default)
 	listView.SetActive(g, true)
 	note.SetActive(g, false)
 
+	// createDocument inserts a new document and selects it in the refreshed list
+	createDocument := func(dbName, collName, docJSON string) {
+		client := sessionClient()
+		if client == nil {
+			return
+		}
+		if err := db.CreateDocument(client, dbName, collName, docJSON); err != nil {
+			popup.ShowInfo(g, "Failed to create document")
+			log.Printf("Failed to create document: %v", err)
+			return
+		}
+		stats.Forget(m.SelectedConnection, dbName)
+
+		popup.ShowInfo(g, "Document created successfully")
+
+		// Refresh document list
+		if err := loadDocuments(dbName, collName, m.Query); err == nil {
+			listView.Items = documentItems(m.Documents)
+			listView.Selected = len(m.Documents) - 1 // Select the newly created document
+			listView.Subtitle = pageIndicator()
+			listView.Update(g)
+
+			// Set focus back to list view
+			g.SetCurrentView(listView.Name)
+			g.Cursor = false
+		}
+	}
+
+	// createDocumentExternally edits a new document in $EDITOR, shows the diff
+	// against the template and creates the document on confirmation
+	var createDocumentExternally func(dbName, collName, template, content string)
+	createDocumentExternally = func(dbName, collName, template, content string) {
+		edited, err := external.Edit(content, "ferretmate-new-*.json")
+		if err != nil {
+			popup.ShowInfo(g, "External editor failed: "+err.Error())
+			log.Printf("External editor failed: %v", err)
+			return
+		}
+
+		if _, err := db.ParseDocument(edited); err != nil {
+			popup.ShowConfirmation(g, fmt.Sprintf("Invalid JSON: %v. Edit again?", err), func() {
+				createDocumentExternally(dbName, collName, template, edited)
+			}, nil)
+			return
+		}
+
+		restore := showDiff("New document (diff against template)", diff.Lines(template, edited))
+		popup.ShowConfirmation(g, "Create this document?", func() {
+			restore()
+			createDocument(dbName, collName, edited)
+		}, restore)
+	}
+
+	// editDocumentExternally edits a stored document in $EDITOR, shows the diff
+	// against the original and saves it on confirmation
+	var editDocumentExternally func(docID interface{}, title, original, content string)
+	editDocumentExternally = func(docID interface{}, title, original, content string) {
+		edited, err := external.Edit(content, "ferretmate-*.json")
+		if err != nil {
+			popup.ShowInfo(g, "External editor failed: "+err.Error())
+			log.Printf("External editor failed: %v", err)
+			return
+		}
+
+		if _, err := db.ParseDocument(edited); err != nil {
+			popup.ShowConfirmation(g, fmt.Sprintf("Invalid JSON: %v. Edit again?", err), func() {
+				editDocumentExternally(docID, title, original, edited)
+			}, nil)
+			return
+		}
+
+		changes := diff.Lines(original, edited)
+		if !diff.Changed(changes) {
+			popup.ShowInfo(g, "No changes")
+			return
+		}
+
+		showDiff("Diff: "+title, changes)
+		popup.ShowConfirmation(g, "Save changes to the document?", func() {
+			freshDoc, err := saveDocument(docID, edited)
+			var conflictErr *db.ConflictError
+			if errors.As(err, &conflictErr) {
+				showConflict(edited, conflictErr)
+				return
+			}
+			if err != nil {
+				log.Printf("Failed to save document: %v", err)
+				popup.ShowInfo(g, fmt.Sprintf("Failed to save: %v", err))
+				showDocument("Document: "+title, original)
+				return
+			}
+			showDocument("Document: "+title, freshDoc)
+		}, func() {
+			showDocument("Document: "+title, original)
+		})
+	}
+
+	// Key binding for editing the selected document in $EDITOR
+	editExternallyHandler := func(g *gocui.Gui, v *gocui.View) error {
+		if m.SelectedListView != "documents" || note.Editing {
+			return nil
+		}
+		if v.Name() == listView.Name {
+			if len(m.Documents) == 0 || listView.Selected >= len(m.Documents) {
+				return nil
+			}
+			m.SelectedDocument = m.Documents[listView.Selected].ID
+			m.SelectedDocumentIndex = listView.Selected
+		}
+		if m.SelectedDocument == nil || m.SelectedDocumentIndex >= len(m.Documents) {
+			return nil
+		}
+
+		client := sessionClient()
+		if client == nil {
+			return nil
+		}
+		original, err := db.GetDocument(client, m.SelectedDB, m.SelectedCollection, m.SelectedDocument)
+		if err != nil {
+			popup.ShowInfo(g, "Failed to load document: "+err.Error())
+			log.Printf("Failed to get document: %v", err)
+			return nil
+		}
+		m.DocumentSnapshot = original
+		editDocumentExternally(m.SelectedDocument, m.Documents[m.SelectedDocumentIndex].Summary, original, original)
+		return nil
+	}
+	for _, viewName := range []string{listView.Name, note.Name} {
+		if err := g.SetKeybinding(viewName, gocui.KeyCtrlE, gocui.ModNone, editExternallyHandler); err != nil {
+			log.Panicln(err)
+		}
+	}
+
+	// Key bindings resolving a save conflict shown in the notepad
+	conflictKeys := map[rune]func(c *conflictState){
+		// t: take theirs, dropping my changes
+		't': func(c *conflictState) {
+			if c.deleted {
+				m.DocumentSnapshot = ""
+				conflict = nil
+				note.Update(g, "Document was deleted.")
+				return
+			}
+			m.DocumentSnapshot = c.theirs
+			showDocument(c.title, c.theirs)
+		},
+		// m: keep mine, overwriting their version
+		'm': func(c *conflictState) {
+			if c.deleted {
+				client := sessionClient()
+				if client == nil {
+					return
+				}
+				if err := db.CreateDocument(client, m.SelectedDB, m.SelectedCollection, c.mine); err != nil {
+					popup.ShowInfoWithFocus(g, fmt.Sprintf("Failed to re-create: %v", err), note.Name)
+					return
+				}
+				m.DocumentSnapshot = c.mine
+				if freshDoc, err := db.GetDocument(client, m.SelectedDB, m.SelectedCollection, m.SelectedDocument); err == nil {
+					m.DocumentSnapshot = freshDoc
+				}
+				showDocument(c.title, m.DocumentSnapshot)
+				return
+			}
+			m.DocumentSnapshot = c.theirs
+			freshDoc, err := saveDocument(m.SelectedDocument, c.mine)
+			var conflictErr *db.ConflictError
+			if errors.As(err, &conflictErr) {
+				showConflict(c.mine, conflictErr)
+				return
+			}
+			if err != nil {
+				popup.ShowInfoWithFocus(g, fmt.Sprintf("Failed to save: %v", err), note.Name)
+				return
+			}
+			showDocument(c.title, freshDoc)
+		},
+		// g: review the merged version in the editor, saved with Ctrl+S
+		'g': func(c *conflictState) {
+			if c.deleted {
+				return
+			}
+			m.DocumentSnapshot = c.theirs
+			showDocument(c.title, c.merged)
+			note.StartEditing(g)
+		},
+	}
+	for key, resolve := range conflictKeys {
+		resolve := resolve
+		if err := g.SetKeybinding(note.Name, key, gocui.ModNone, func(g *gocui.Gui, v *gocui.View) error {
+			if conflict == nil || note.Editing || m.SelectedListView != "documents" {
+				return nil
+			}
+			resolve(conflict)
+			return nil
+		}); err != nil {
+			log.Panicln(err)
+		}
+	}
+
 	// Key binding for creating new items
 	if err := g.SetKeybinding("", 'n', gocui.ModNone, func(g *gocui.Gui, v *gocui.View) error {
 		switch m.SelectedListView {
+		case "connections":
+			connManager.Add()
+
+		case "indexes":
+			idxManager.Create()
+
+		case "pipeline":
+			pipeBuilder.Add()
+
 		case "dbs":
 			// Show popup for new database name
 			editPopup := &popup.Popup{
@@ -508,7 +1328,7 @@ func main() {
 						return
 					}
 
-					if db.Client == nil {
+					if currentClient() == nil {
 						popup.ShowInfo(g, "Not connected to any server")
 						return
 					}
@@ -527,8 +1347,13 @@ func main() {
 								return
 							}
 
+							client := sessionClient()
+							if client == nil {
+								return
+							}
+
 							// Create the database with the first collection
-							if err := db.CreateDatabase(db.Client, tempDBName, collName); err != nil {
+							if err := db.CreateDatabase(client, tempDBName, collName); err != nil {
 								popup.ShowInfo(g, "Failed to create database")
 								log.Printf("Failed to create database: %v", err)
 								return
@@ -537,7 +1362,7 @@ func main() {
 							popup.ShowInfo(g, "Database created successfully")
 
 							// Refresh database list
-							dbs, err := db.ListDatabases(db.Client)
+							dbs, err := db.ListDatabases(client)
 							if err == nil {
 								m.DBs = dbs
 								m.SelectedDB = tempDBName
@@ -549,7 +1374,7 @@ func main() {
 										break
 									}
 								}
-								listView.Items = m.DBs
+								listView.Items = list.Items(m.DBs)
 								listView.Update(g)
 
 								// Set focus back to list view
@@ -587,27 +1412,28 @@ func main() {
 						return
 					}
 
-					if db.Client == nil {
+					if currentClient() == nil {
 						popup.ShowInfo(g, "Not connected to any server")
 						return
 					}
 
 					dbName := m.DBs[m.SelectedDBIndex]
-					if err := db.CreateCollection(db.Client, dbName, collName); err != nil {
+					if err := db.CreateCollection(currentClient(), dbName, collName); err != nil {
 						popup.ShowInfo(g, "Failed to create collection")
 						log.Printf("Failed to create collection: %v", err)
 						return
 					}
+					stats.Forget(m.SelectedConnection, dbName)
 
 					popup.ShowInfo(g, "Collection created successfully")
 
 					// Refresh collection list
-					colls, err := db.ListCollections(db.Client, dbName)
+					colls, err := db.ListCollections(currentClient(), dbName)
 					if err == nil {
 						m.Collections = colls
 						m.SelectedCollection = collName
 						m.SelectedCollectionIndex = len(m.Collections) - 1
-						listView.Items = m.Collections
+						listView.Items = list.Items(m.Collections)
 						listView.Selected = len(m.Collections) - 1 // Select the newly created collection
 						listView.Update(g)
 
@@ -636,14 +1462,14 @@ func main() {
 }`
 			editPopup := &popup.Popup{
 				Name:    "newDocumentPopup",
-				Title:   "Create Document (Ctrl+S to create, ESC to cancel)",
+				Title:   "Create Document (Ctrl+S to create, Ctrl+E for $EDITOR, ESC to cancel)",
 				Content: templateDoc,
 				OnSave: func(docJSON string) {
 					if docJSON == "" {
 						return
 					}
 
-					if db.Client == nil {
+					if currentClient() == nil {
 						popup.ShowInfo(g, "Not connected to any server")
 						return
 					}
@@ -653,41 +1479,24 @@ func main() {
 						return
 					}
 
-					dbName := m.DBs[m.SelectedDBIndex]
-					collName := m.Collections[m.SelectedCollectionIndex]
-
-					if err := db.CreateDocument(db.Client, dbName, collName, docJSON); err != nil {
-						popup.ShowInfo(g, "Failed to create document")
-						log.Printf("Failed to create document: %v", err)
-						return
-					}
-
-					popup.ShowInfo(g, "Document created successfully")
-
-					// Refresh document list
-					docs, err := db.ListDocuments(db.Client, dbName, collName)
-					if err == nil {
-						m.Documents = []string{}
-						for _, doc := range docs {
-							name := doc.Summary
-							m.DocumentObjects[name] = doc.ID
-							m.DocumentContent[name] = doc.JSON
-							m.Documents = append(m.Documents, name)
-						}
-						listView.Items = m.Documents
-						listView.Selected = len(m.Documents) - 1 // Select the newly created document
-						listView.Update(g)
-
-						// Set focus back to list view
-						g.SetCurrentView(listView.Name)
-						g.Cursor = false
-					}
+					createDocument(m.DBs[m.SelectedDBIndex], m.Collections[m.SelectedCollectionIndex], docJSON)
 				},
 				OnCancel: func() {
 					// Set focus back to list view on cancel
 					g.SetCurrentView(listView.Name)
 					g.Cursor = false
 				},
+				OnExternalEdit: func(content string) {
+					if currentClient() == nil {
+						popup.ShowInfo(g, "Not connected to any server")
+						return
+					}
+					if m.SelectedDBIndex >= len(m.DBs) || m.SelectedCollectionIndex >= len(m.Collections) {
+						popup.ShowInfo(g, "No database or collection selected")
+						return
+					}
+					createDocumentExternally(m.DBs[m.SelectedDBIndex], m.Collections[m.SelectedCollectionIndex], templateDoc, content)
+				},
 			}
 			editPopup.Show(g)
 			editPopup.BindKeys(g)
@@ -698,27 +1507,42 @@ func main() {
 		log.Panicln(err)
 	}
 
-	// Key binding for deleting items
-	if err := g.SetKeybinding("", gocui.KeyDelete, gocui.ModNone, func(g *gocui.Gui, v *gocui.View) error {
+	// Key binding for deleting items, on the list only: a global binding
+	// would also fire in the editing notepad, the console and form fields
+	if err := g.SetKeybinding(listView.Name, gocui.KeyDelete, gocui.ModNone, func(g *gocui.Gui, v *gocui.View) error {
 		switch m.SelectedListView {
+		case "connections":
+			connManager.Delete()
+
+		case "indexes":
+			idxManager.Drop()
+
+		case "pipeline":
+			pipeBuilder.Delete()
+
 		case "dbs":
 			// Delete database - use current cursor position
 			if len(m.DBs) == 0 || listView.Selected >= len(m.DBs) {
 				return nil
 			}
 			dbName := m.DBs[listView.Selected]
+			conn, client := m.SelectedConnection, sessionClient()
+			if client == nil {
+				return nil
+			}
 
 			popup.ShowConfirmation(g, "Delete database '"+dbName+"'?", func() {
-				if err := db.DeleteDatabase(db.Client, dbName); err != nil {
+				if err := db.DeleteDatabase(client, dbName); err != nil {
 					popup.ShowInfo(g, "Failed to delete database")
 					log.Printf("Failed to delete database: %v", err)
 					return
 				}
+				stats.Forget(conn, dbName)
 
 				popup.ShowInfo(g, "Database deleted successfully")
 
 				// Refresh database list
-				dbs, err := db.ListDatabases(db.Client)
+				dbs, err := db.ListDatabases(client)
 				if err == nil {
 					m.DBs = dbs
 					// Adjust cursor position after deletion
@@ -729,7 +1553,7 @@ func main() {
 						listView.Selected = 0
 					}
 					m.SelectedDBIndex = listView.Selected
-					listView.Items = m.DBs
+					listView.Items = list.Items(m.DBs)
 					listView.Update(g)
 				}
 			}, func() {
@@ -746,18 +1570,23 @@ func main() {
 			}
 			collName := m.Collections[listView.Selected]
 			dbName := m.DBs[m.SelectedDBIndex]
+			conn, client := m.SelectedConnection, sessionClient()
+			if client == nil {
+				return nil
+			}
 
 			popup.ShowConfirmation(g, "Delete collection '"+collName+"'?", func() {
-				if err := db.DeleteCollection(db.Client, dbName, collName); err != nil {
+				if err := db.DeleteCollection(client, dbName, collName); err != nil {
 					popup.ShowInfo(g, "Failed to delete collection")
 					log.Printf("Failed to delete collection: %v", err)
 					return
 				}
+				stats.Forget(conn, dbName)
 
 				popup.ShowInfo(g, "Collection deleted successfully")
 
 				// Refresh collection list
-				colls, err := db.ListCollections(db.Client, dbName)
+				colls, err := db.ListCollections(client, dbName)
 				if err == nil {
 					m.Collections = colls
 					// Adjust cursor position after deletion
@@ -768,7 +1597,7 @@ func main() {
 						listView.Selected = 0
 					}
 					m.SelectedCollectionIndex = listView.Selected
-					listView.Items = m.Collections
+					listView.Items = list.Items(m.Collections)
 					listView.Update(g)
 				}
 			}, func() {
@@ -783,31 +1612,32 @@ func main() {
 			if m.SelectedDBIndex >= len(m.DBs) || m.SelectedCollectionIndex >= len(m.Collections) {
 				return nil
 			}
-			docName := m.Documents[listView.Selected]
-			docID := m.DocumentObjects[docName]
+			doc := m.Documents[listView.Selected]
+			docID := doc.ID
 			dbName := m.DBs[m.SelectedDBIndex]
 			collName := m.Collections[m.SelectedCollectionIndex]
+			conn, client := m.SelectedConnection, sessionClient()
+			if client == nil {
+				return nil
+			}
 
-			popup.ShowConfirmation(g, "Delete document '"+docName+"'?", func() {
-				if err := db.DeleteDocument(db.Client, dbName, collName, docID); err != nil {
+			popup.ShowConfirmation(g, "Delete document '"+doc.Summary+"'?", func() {
+				if err := db.DeleteDocument(client, dbName, collName, docID); err != nil {
 					popup.ShowInfo(g, "Failed to delete document")
 					log.Printf("Failed to delete document: %v", err)
 					return
 				}
+				stats.Forget(conn, dbName)
 
 				popup.ShowInfo(g, "Document deleted successfully")
 
 				// Refresh document list
-				docs, err := db.ListDocuments(db.Client, dbName, collName)
-				if err == nil {
-					m.Documents = []string{}
-					m.DocumentObjects = make(map[string]interface{})
-					m.DocumentContent = make(map[string]string)
-					for _, doc := range docs {
-						name := doc.Summary
-						m.DocumentObjects[name] = doc.ID
-						m.DocumentContent[name] = doc.JSON
-						m.Documents = append(m.Documents, name)
+				if err := loadDocuments(dbName, collName, m.Query); err == nil {
+					// Load pages until the previous cursor position is reachable again
+					for listView.Selected >= len(m.Documents) && !pager.Done {
+						if err := loadNextPage(); err != nil {
+							break
+						}
 					}
 					// Adjust cursor position after deletion
 					if listView.Selected >= len(m.Documents) {
@@ -817,10 +1647,13 @@ func main() {
 						listView.Selected = 0
 					}
 					m.SelectedDocumentIndex = listView.Selected
-					listView.Items = m.Documents
+					listView.Items = documentItems(m.Documents)
+					listView.Subtitle = pageIndicator()
 					listView.Update(g)
 
 					// Clear the notepad if the deleted document was being viewed
+					m.SelectedDocument = nil
+					note.Editable = false
 					note.Update(g, "Pick something from the list...")
 				}
 			}, func() {
@@ -833,6 +1666,48 @@ func main() {
 		log.Panicln(err)
 	}
 
+	// streamExport exports the documents of a collection matching a query to
+	// a single file in the chosen format, as a background job
+	streamExport := func(dbName, collName string, query model.Query, choice int) {
+		opts := db.ExportOptions{Format: exportFormats[choice].format, Gzip: exportFormats[choice].gzip, Query: query}
+		exportPath := "./exports/" + dbName + "/" + exportName(collName, query) + opts.Extension()
+		client := sessionClient()
+		if client == nil {
+			return
+		}
+		jobPanel.Start("Export "+dbName+"."+collName+" to "+exportPath, func(ctx context.Context, progress func(done, total int64)) error {
+			_, err := db.StreamExport(ctx, client, dbName, collName, exportPath, opts, progress)
+			return err
+		}, nil)
+	}
+
+	// dumpChoices are the dump options offered by the export menus, in order
+	dumpChoices := func(dbName string) []string {
+		return []string{
+			"Dump, mongodump layout (./dumps/" + dbName + "-<time>/)",
+			"Dump, gzipped files as mongodump --gzip (./dumps/" + dbName + "-<time>/)",
+			"Dump, single gzipped archive as mongodump --archive --gzip (./dumps/" + dbName + "-<time>.archive.gz)",
+		}
+	}
+
+	// dump writes a database, or some of its collections, in the mongodump
+	// layout below ./dumps, as a background job. choice is the index of the
+	// picked dumpChoices entry.
+	dump := func(dbName string, collections []string, choice int) {
+		outPath := "./dumps/" + dbName + "-" + time.Now().Format("20060102-150405")
+		opts := db.DumpOptions{Collections: collections, Gzip: choice > 0, Archive: choice == 2}
+		if opts.Archive {
+			outPath += ".archive"
+		}
+		client := sessionClient()
+		if client == nil {
+			return
+		}
+		jobPanel.Start("Dump "+dbName+" to "+outPath, func(ctx context.Context, progress func(done, total int64)) error {
+			return db.DumpDatabase(ctx, client, dbName, outPath, opts, progress)
+		}, nil)
+	}
+
 	// Key binding for exporting/downloading items
 	if err := g.SetKeybinding("", 'd', gocui.ModNone, func(g *gocui.Gui, v *gocui.View) error {
 		switch m.SelectedListView {
@@ -844,14 +1719,19 @@ func main() {
 			dbName := m.DBs[listView.Selected]
 			exportPath := "./exports/" + dbName
 
-			popup.ShowConfirmation(g, "Export database '"+dbName+"' to '"+exportPath+"'?", func() {
-				if err := db.ExportDatabase(db.Client, dbName, exportPath); err != nil {
-					popup.ShowInfo(g, "Failed to export database: "+err.Error())
-					log.Printf("Failed to export database: %v", err)
+			options := append([]string{"One file per document (" + exportPath + "/)"}, dumpChoices(dbName)...)
+			popup.ShowChoice(g, "Export database '"+dbName+"'", options, func(choice int) {
+				if choice > 0 {
+					dump(dbName, nil, choice-1)
 					return
 				}
-
-				popup.ShowInfo(g, "Database exported to: "+exportPath)
+				client := sessionClient()
+				if client == nil {
+					return
+				}
+				jobPanel.Start("Export database "+dbName, func(ctx context.Context, progress func(done, total int64)) error {
+					return db.ExportDatabase(ctx, client, dbName, exportPath, progress)
+				}, nil)
 			}, func() {
 				// Cancelled - do nothing
 			})
@@ -868,34 +1748,79 @@ func main() {
 			dbName := m.DBs[m.SelectedDBIndex]
 			exportPath := "./exports/" + dbName + "/" + collName
 
-			popup.ShowConfirmation(g, "Export collection '"+collName+"' to '"+exportPath+"'?", func() {
-				if err := db.ExportCollection(db.Client, dbName, collName, exportPath); err != nil {
-					popup.ShowInfo(g, "Failed to export collection: "+err.Error())
-					log.Printf("Failed to export collection: %v", err)
-					return
+			options := make([]string, 0, len(exportFormats)+1)
+			for _, f := range exportFormats {
+				options = append(options, f.label)
+			}
+			for _, f := range tableFormats {
+				options = append(options, f.label)
+			}
+			options = append(options, "One file per document ("+exportPath+"/)")
+			options = append(options, dumpChoices(dbName)...)
+			popup.ShowChoice(g, "Export collection '"+collName+"'", options, func(choice int) {
+				// The single-file formats come first, then the spreadsheets, the
+				// per-document export and the dumps
+				switch extra := choice - len(exportFormats) - len(tableFormats); {
+				case choice < len(exportFormats):
+					streamExport(dbName, collName, model.Query{}, choice)
+				case extra < 0:
+					csvExport.Open(dbName, collName, model.Query{}, choice-len(exportFormats))
+				case extra == 0:
+					client := sessionClient()
+					if client == nil {
+						return
+					}
+					jobPanel.Start("Export collection "+dbName+"."+collName, func(ctx context.Context, progress func(done, total int64)) error {
+						return db.ExportCollection(ctx, client, dbName, collName, exportPath, progress)
+					}, nil)
+				default:
+					dump(dbName, []string{collName}, extra-1)
 				}
-
-				popup.ShowInfo(g, "Collection exported to: "+exportPath)
 			}, func() {
 				// Cancelled - do nothing
 			})
 
 		case "documents":
-			// Export single document
+			// Export single document or the query results
 			if len(m.Documents) == 0 || listView.Selected >= len(m.Documents) {
 				return nil
 			}
 			if m.SelectedDBIndex >= len(m.DBs) || m.SelectedCollectionIndex >= len(m.Collections) {
 				return nil
 			}
-			docName := m.Documents[listView.Selected]
-			docID := m.DocumentObjects[docName]
+			doc := m.Documents[listView.Selected]
+			docID := doc.ID
 			dbName := m.DBs[m.SelectedDBIndex]
 			collName := m.Collections[m.SelectedCollectionIndex]
-			exportPath := "./exports/" + dbName + "/" + collName + "/" + docName + ".json"
+			exportPath := "./exports/" + dbName + "/" + collName + "/" + db.IDFileName(docID) + ".json"
 
-			popup.ShowConfirmation(g, "Export document '"+docName+"' to '"+exportPath+"'?", func() {
-				if err := db.ExportDocument(db.Client, dbName, collName, docID, exportPath); err != nil {
+			// The document under the cursor, or everything the query matches
+			matching := "All documents"
+			if !m.Query.IsEmpty() {
+				matching = "Query results"
+			}
+			options := []string{"This document (" + exportPath + ")"}
+			for _, f := range exportFormats {
+				options = append(options, matching+" as "+f.label)
+			}
+			for _, f := range tableFormats {
+				options = append(options, matching+" as "+f.label)
+			}
+			query := m.Query
+			popup.ShowChoice(g, "Export", options, func(choice int) {
+				switch {
+				case choice > len(exportFormats):
+					csvExport.Open(dbName, collName, query, choice-1-len(exportFormats))
+					return
+				case choice > 0:
+					streamExport(dbName, collName, query, choice-1)
+					return
+				}
+				client := sessionClient()
+				if client == nil {
+					return
+				}
+				if err := db.ExportDocument(client, dbName, collName, docID, exportPath); err != nil {
 					popup.ShowInfo(g, "Failed to export document: "+err.Error())
 					log.Printf("Failed to export document: %v", err)
 					return
@@ -905,6 +1830,9 @@ func main() {
 			}, func() {
 				// Cancelled - do nothing
 			})
+
+		case "pipeline":
+			pipeBuilder.Export()
 		}
 
 		return nil
@@ -914,7 +1842,72 @@ func main() {
 
 	// Key binding for uploading document from file
 	if err := g.SetKeybinding("", 'u', gocui.ModNone, func(g *gocui.Gui, v *gocui.View) error {
-		// Only allow upload when viewing documents list
+		// On the databases level, restore a dump instead
+		if m.SelectedListView == "dbs" {
+			target := ""
+			if listView.Selected < len(m.DBs) {
+				target = m.DBs[listView.Selected]
+			}
+			restoreForm := &popup.Form{
+				Name:  "restoreForm",
+				Title: "Restore a mongodump-style dump",
+				Fields: []popup.FormField{
+					{Label: "Dump directory or archive file, plain or gzipped, e.g. ./dumps/" + target + "-20060102-150405"},
+					{Label: "Target database", Value: target},
+				},
+				OnCancel: func() {
+					g.SetCurrentView(listView.Name)
+					g.Cursor = false
+				},
+			}
+			restoreForm.OnSave = func(values []string) {
+				g.SetCurrentView(listView.Name)
+				g.Cursor = false
+				source, dbName := strings.TrimSpace(values[0]), strings.TrimSpace(values[1])
+				if source == "" || dbName == "" {
+					return
+				}
+				conn, client := m.SelectedConnection, sessionClient()
+				if client == nil {
+					return
+				}
+				tabModel := m
+				var result db.RestoreResult
+				var dbs []string
+				jobPanel.Start("Restore "+filepath.Base(source)+" into "+dbName, func(ctx context.Context, progress func(done, total int64)) error {
+					var err error
+					result, err = db.RestoreDump(ctx, client, source, dbName, progress)
+					if err != nil {
+						return err
+					}
+					// The databases for the refresh; a failed listing only skips it
+					dbs, _ = db.ListDatabasesContext(ctx, client)
+					return nil
+				}, func(err error) {
+					stats.Forget(conn, dbName)
+					if err != nil {
+						return
+					}
+					popup.ShowToast(g, fmt.Sprintf("Restored %d collections into %s: %d documents, %d duplicates skipped",
+						result.Collections, dbName, result.Inserted, result.Duplicates))
+
+					// Show a new database in the list
+					if m != tabModel || m.SelectedConnection != conn || m.SelectedListView != "dbs" || dbs == nil {
+						return
+					}
+					m.DBs = dbs
+					listView.Items = list.Items(m.DBs)
+					listView.Update(g)
+				})
+			}
+			if err := restoreForm.Show(g); err != nil {
+				log.Panicln(err)
+			}
+			restoreForm.BindKeys(g)
+			return nil
+		}
+
+		// Otherwise only allow upload when viewing documents list
 		if m.SelectedListView != "documents" {
 			return nil
 		}
@@ -922,7 +1915,7 @@ func main() {
 		// Show popup for file path
 		uploadPopup := &popup.Popup{
 			Name:       "uploadPopup",
-			Title:      "Upload Document(s) from JSON File - object or array (Enter or Ctrl+S to upload, ESC to cancel)",
+			Title:      "Upload Document(s) from JSON File (object or array) or CSV/TSV File (Enter or Ctrl+S to upload, ESC to cancel)",
 			Content:    "",
 			SingleLine: true,
 			OnSave: func(filePath string) {
@@ -930,7 +1923,7 @@ func main() {
 					return
 				}
 
-				if db.Client == nil {
+				if currentClient() == nil {
 					popup.ShowInfo(g, "Not connected to any server")
 					return
 				}
@@ -943,35 +1936,28 @@ func main() {
 				dbName := m.DBs[m.SelectedDBIndex]
 				collName := m.Collections[m.SelectedCollectionIndex]
 
-				// Upload the document
-				if err := db.UploadDocument(db.Client, dbName, collName, filePath); err != nil {
-					popup.ShowInfo(g, "Failed to upload document: "+err.Error())
-					log.Printf("Failed to upload document: %v", err)
+				// CSV and TSV files are previewed and mapped first, once
+				// the popup is closed
+				if isTableFile(filePath) {
+					g.Update(func(g *gocui.Gui) error {
+						csvImport.Open(dbName, collName, filePath)
+						return nil
+					})
 					return
 				}
 
-				popup.ShowInfo(g, "Document uploaded successfully")
-
-				// Refresh document list
-				docs, err := db.ListDocuments(db.Client, dbName, collName)
-				if err == nil {
-					m.Documents = []string{}
-					m.DocumentObjects = make(map[string]interface{})
-					m.DocumentContent = make(map[string]string)
-					for _, doc := range docs {
-						name := doc.Summary
-						m.DocumentObjects[name] = doc.ID
-						m.DocumentContent[name] = doc.JSON
-						m.Documents = append(m.Documents, name)
+				// Upload the documents in the background
+				conn, client := m.SelectedConnection, currentClient()
+				g.SetCurrentView(listView.Name)
+				g.Cursor = false
+				jobPanel.Start("Upload "+filepath.Base(filePath)+" to "+dbName+"."+collName, func(ctx context.Context, progress func(done, total int64)) error {
+					return db.UploadDocument(ctx, client, dbName, collName, filePath, progress)
+				}, func(err error) {
+					stats.Forget(conn, dbName)
+					if err == nil {
+						reloadUploaded(dbName, collName)
 					}
-					listView.Items = m.Documents
-					listView.Selected = len(m.Documents) - 1 // Select the newly uploaded document
-					listView.Update(g)
-
-					// Set focus back to list view
-					g.SetCurrentView(listView.Name)
-					g.Cursor = false
-				}
+				})
 			},
 			OnCancel: func() {
 				// Set focus back to list view on cancel
@@ -987,6 +1973,70 @@ func main() {
 		log.Panicln(err)
 	}
 
+	// Key binding for the query bar (filter, projection, sort)
+	if err := g.SetKeybinding("", 'f', gocui.ModNone, func(g *gocui.Gui, v *gocui.View) error {
+		// Only allow queries when viewing documents list
+		if m.SelectedListView != "documents" {
+			return nil
+		}
+
+		queryForm := &popup.Form{
+			Name:  "queryForm",
+			Title: "Query (mongo-shell syntax, e.g. {status: \"pending\", age: {$gt: 30}})",
+			Fields: []popup.FormField{
+				{Label: "Filter", Value: m.Query.Filter},
+				{Label: "Projection", Value: m.Query.Projection},
+				{Label: "Sort", Value: m.Query.Sort},
+			},
+			OnSave: func(values []string) {
+				query := model.Query{Filter: values[0], Projection: values[1], Sort: values[2]}
+
+				if err := loadDocuments(m.SelectedDB, m.SelectedCollection, query); err != nil {
+					popup.ShowInfo(g, "Query failed: "+err.Error())
+					log.Printf("Query failed: %v", err)
+					return
+				}
+
+				m.Query = query
+
+				maxX, _ := g.Size()
+				listView.Title = buildBreadcrumbTitle(m, "Documents", maxX/2)
+				listView.Items = documentItems(m.Documents)
+				listView.Selected = 0
+				listView.Subtitle = pageIndicator()
+				listView.Update(g)
+
+				g.SetCurrentView(listView.Name)
+			},
+			OnCancel: func() {
+				// Set focus back to list view on cancel
+				g.SetCurrentView(listView.Name)
+			},
+		}
+		queryForm.Show(g)
+		queryForm.BindKeys(g)
+
+		return nil
+	}); err != nil {
+		log.Panicln(err)
+	}
+
+	// Key bindings for the aggregation pipeline builder
+	if err := g.SetKeybinding("", 'a', gocui.ModNone, func(g *gocui.Gui, v *gocui.View) error {
+		pipeBuilder.Open()
+		return nil
+	}); err != nil {
+		log.Panicln(err)
+	}
+	if err := g.SetKeybinding("", 'l', gocui.ModNone, func(g *gocui.Gui, v *gocui.View) error {
+		if m.SelectedListView == "pipeline" {
+			pipeBuilder.Load()
+		}
+		return nil
+	}); err != nil {
+		log.Panicln(err)
+	}
+
 	// global quit
 	if err := g.SetKeybinding("", gocui.KeyCtrlC, gocui.ModNone, func(_ *gocui.Gui, _ *gocui.View) error {
 		return gocui.ErrQuit
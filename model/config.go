@@ -3,19 +3,55 @@ package model
 import (
 	"encoding/json"
 	"os"
+	"path/filepath"
 )
 
+// ConfigFile is the file the connections are read from and saved to
+const ConfigFile = "config.json"
+
 type Connection struct {
 	Name     string `json:"name"`
+	URI      string `json:"uri,omitempty"` // full connection string; the fields below override it when set
 	Host     string `json:"host"`
 	Port     int    `json:"port"`
 	Username string `json:"username"`
 	Password string `json:"password"`
 	Database string `json:"database"`
+
+	// TLS options
+	TLS           bool   `json:"tls,omitempty"`
+	TLSCAFile     string `json:"tlsCAFile,omitempty"`     // PEM file with the CA certificates to trust
+	TLSCertFile   string `json:"tlsCertFile,omitempty"`   // PEM client certificate (may also hold the key)
+	TLSKeyFile    string `json:"tlsKeyFile,omitempty"`    // PEM client key, if not in TLSCertFile
+	TLSInsecure   bool   `json:"tlsInsecure,omitempty"`   // skip server certificate verification
+	TLSServerName string `json:"tlsServerName,omitempty"` // SNI name, if different from the host
+
+	AuthMechanism string `json:"authMechanism,omitempty"` // "" for the default, or AuthX509
+
+	// SSH tunnel options, used when SSHHost is set
+	SSHHost            string `json:"sshHost,omitempty"`
+	SSHPort            int    `json:"sshPort,omitempty"`
+	SSHUser            string `json:"sshUser,omitempty"`
+	SSHKeyFile         string `json:"sshKeyFile,omitempty"`         // private key; empty uses the SSH agent
+	SSHKnownHosts      string `json:"sshKnownHosts,omitempty"`      // known_hosts file; empty uses ~/.ssh/known_hosts
+	SSHInsecureHostKey bool   `json:"sshInsecureHostKey,omitempty"` // skip the host key check
+}
+
+// AuthX509 authenticates with the TLS client certificate
+const AuthX509 = "MONGODB-X509"
+
+// UsesSSH reports whether the connection goes through an SSH tunnel
+func (c Connection) UsesSSH() bool {
+	return c.SSHHost != ""
+}
+
+// UsesTLS reports whether any TLS option is set
+func (c Connection) UsesTLS() bool {
+	return c.TLS || c.TLSCAFile != "" || c.TLSCertFile != "" || c.TLSInsecure || c.TLSServerName != "" || c.AuthMechanism == AuthX509
 }
 
 func LoadConnections() ([]Connection, error) {
-	data, err := os.ReadFile("config.json")
+	data, err := os.ReadFile(ConfigFile)
 	if err != nil {
 		if os.IsNotExist(err) {
 			// Return empty list if config doesn't exist
@@ -31,3 +67,57 @@ func LoadConnections() ([]Connection, error) {
 
 	return connections, nil
 }
+
+// SaveConnections writes the connections to the config file. The data is written
+// to a temporary file first and renamed over the config, so a failed write never
+// leaves a truncated config behind.
+func SaveConnections(connections []Connection) error {
+	data, err := json.MarshalIndent(connections, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	// The config holds passwords, keep it private unless it already has other permissions
+	return writeFileAtomic(ConfigFile, data, 0600)
+}
+
+// writeFileAtomic replaces path with data through a temporary file in the same
+// directory. An existing file keeps its permissions, a new one gets perm.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	if info, err := os.Stat(path); err == nil {
+		perm = info.Mode().Perm()
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // no-op after a successful rename
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// ConnectionNames returns the names of the connections, in order
+func ConnectionNames(connections []Connection) []string {
+	names := make([]string, 0, len(connections))
+	for _, c := range connections {
+		names = append(names, c.Name)
+	}
+	return names
+}
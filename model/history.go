@@ -0,0 +1,62 @@
+package model
+
+import (
+	"encoding/json"
+	"os"
+	"regexp"
+)
+
+// HistoryFile stores the commands run in the command console
+const HistoryFile = "history.json"
+
+// maxHistory limits the number of commands kept on disk
+const maxHistory = 200
+
+// secretCommand matches commands that carry credentials; they are kept in
+// memory only and never written to the history file
+var secretCommand = regexp.MustCompile(`(?i)pwd|password|secret|token`)
+
+// LoadHistory returns the saved console commands, oldest first
+func LoadHistory() ([]string, error) {
+	data, err := os.ReadFile(HistoryFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []string{}, nil
+		}
+		return nil, err
+	}
+
+	var history []string
+	if err := json.Unmarshal(data, &history); err != nil {
+		return nil, err
+	}
+	return history, nil
+}
+
+// AppendHistory adds a command to the history and returns the new history.
+// Repeating the previous command does not add an entry.
+func AppendHistory(history []string, command string) ([]string, error) {
+	if len(history) > 0 && history[len(history)-1] == command {
+		return history, nil
+	}
+	history = append(history, command)
+	if secretCommand.MatchString(command) {
+		return history, nil
+	}
+
+	// Only the persistable commands go to disk
+	saved, err := LoadHistory()
+	if err != nil {
+		return history, err
+	}
+	saved = append(saved, command)
+	if len(saved) > maxHistory {
+		saved = saved[len(saved)-maxHistory:]
+	}
+	data, err := json.MarshalIndent(saved, "", "  ")
+	if err != nil {
+		return history, err
+	}
+	data = append(data, '\n')
+	return history, writeFileAtomic(HistoryFile, data, 0600)
+}
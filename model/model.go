@@ -1,5 +1,22 @@
 package model
 
+// Document is a row of the document list, identified by its real _id value
+type Document struct {
+	ID      interface{}
+	Summary string
+}
+
+// Index is a row of the index list of a collection
+type Index struct {
+	Name          string
+	Keys          string // key document as single-line Extended JSON
+	Unique        bool
+	Sparse        bool
+	TTL           *int64 // expireAfterSeconds, nil without TTL
+	PartialFilter string // partialFilterExpression as Extended JSON, empty if none
+	Spec          string // the whole index description as indented Extended JSON
+}
+
 type Model struct {
 	SelectedListView string
 
@@ -16,10 +33,15 @@ type Model struct {
 	SelectedCollection      string
 	SelectedCollectionIndex int
 
-	Documents             []string
-	DocumentObjects       map[string]interface{}
-	SelectedDocument      string
+	Documents             []Document
+	SelectedDocument      interface{} // _id of the opened document
 	SelectedDocumentIndex int
+	DocumentSnapshot      string // the opened document as loaded, to detect concurrent changes
+	Query                 Query
+
+	Indexes []Index
 
-	DocumentContent map[string]string
+	Pipeline          Pipeline // the pipeline edited on the "pipeline" level
+	PipelineNamespace string   // db.collection of the pipeline
+	PipelineFrom      string   // the level the pipeline was opened from
 }
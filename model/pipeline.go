@@ -0,0 +1,95 @@
+package model
+
+import (
+	"encoding/json"
+	"os"
+	"sort"
+)
+
+// PipelinesFile stores the saved aggregation pipelines
+const PipelinesFile = "pipelines.json"
+
+// Stage is one stage of an aggregation pipeline, in mongo-shell syntax
+type Stage struct {
+	Text     string `json:"text"`
+	Disabled bool   `json:"disabled,omitempty"` // disabled stages are skipped when running
+}
+
+// Pipeline is a named aggregation pipeline of a collection
+type Pipeline struct {
+	Name   string  `json:"name"`
+	Stages []Stage `json:"stages"`
+}
+
+// loadAllPipelines reads the saved pipelines of all collections, by namespace (db.collection)
+func loadAllPipelines() (map[string][]Pipeline, error) {
+	data, err := os.ReadFile(PipelinesFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return map[string][]Pipeline{}, nil
+		}
+		return nil, err
+	}
+
+	pipelines := map[string][]Pipeline{}
+	if err := json.Unmarshal(data, &pipelines); err != nil {
+		return nil, err
+	}
+	return pipelines, nil
+}
+
+// LoadPipelines returns the saved pipelines of a collection sorted by name
+func LoadPipelines(namespace string) ([]Pipeline, error) {
+	all, err := loadAllPipelines()
+	if err != nil {
+		return nil, err
+	}
+	pipelines := all[namespace]
+	sort.Slice(pipelines, func(i, j int) bool { return pipelines[i].Name < pipelines[j].Name })
+	return pipelines, nil
+}
+
+// SavePipeline stores a pipeline of a collection, replacing the one with the same name
+func SavePipeline(namespace string, p Pipeline) error {
+	return updatePipelines(namespace, func(pipelines []Pipeline) []Pipeline {
+		for i := range pipelines {
+			if pipelines[i].Name == p.Name {
+				pipelines[i] = p
+				return pipelines
+			}
+		}
+		return append(pipelines, p)
+	})
+}
+
+// DeletePipeline removes a saved pipeline of a collection
+func DeletePipeline(namespace, name string) error {
+	return updatePipelines(namespace, func(pipelines []Pipeline) []Pipeline {
+		kept := pipelines[:0]
+		for _, p := range pipelines {
+			if p.Name != name {
+				kept = append(kept, p)
+			}
+		}
+		return kept
+	})
+}
+
+// updatePipelines rewrites the pipelines of a collection
+func updatePipelines(namespace string, update func([]Pipeline) []Pipeline) error {
+	all, err := loadAllPipelines()
+	if err != nil {
+		return err
+	}
+	all[namespace] = update(all[namespace])
+	if len(all[namespace]) == 0 {
+		delete(all, namespace)
+	}
+
+	data, err := json.MarshalIndent(all, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	return writeFileAtomic(PipelinesFile, data, 0644)
+}
@@ -0,0 +1,33 @@
+package model
+
+import "strings"
+
+// Query holds the filter, projection and sort typed into the query bar.
+// Each part is kept as the text the user entered (relaxed mongo-shell syntax).
+type Query struct {
+	Filter     string
+	Projection string
+	Sort       string
+}
+
+// IsEmpty reports whether no part of the query is set
+func (q Query) IsEmpty() bool {
+	return strings.TrimSpace(q.Filter) == "" &&
+		strings.TrimSpace(q.Projection) == "" &&
+		strings.TrimSpace(q.Sort) == ""
+}
+
+// String returns a short one-line description of the active query
+func (q Query) String() string {
+	var parts []string
+	if f := strings.TrimSpace(q.Filter); f != "" {
+		parts = append(parts, f)
+	}
+	if p := strings.TrimSpace(q.Projection); p != "" {
+		parts = append(parts, "proj "+p)
+	}
+	if s := strings.TrimSpace(q.Sort); s != "" {
+		parts = append(parts, "sort "+s)
+	}
+	return strings.Join(parts, " ")
+}
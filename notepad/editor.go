@@ -0,0 +1,354 @@
+package notepad
+
+import (
+	"strings"
+
+	"github.com/awesome-gocui/gocui"
+)
+
+// maxUndo limits the number of snapshots kept for undo
+const maxUndo = 500
+
+// snapshot is a saved editor state for undo/redo
+type snapshot struct {
+	lines    []string
+	row, col int
+}
+
+// editState holds the state of the in-place editing mode
+type editState struct {
+	original string // content before editing started
+	row, col int    // cursor position in the buffer (line, rune)
+	ox, oy   int    // view origin
+	undo     []snapshot
+	redo     []snapshot
+	typing   bool // true while consecutive characters are typed (one undo step)
+}
+
+// StartEditing switches the notepad into in-place editing mode
+func (n *Notepad) StartEditing(g *gocui.Gui) error {
+	if !n.Editable || n.Editing {
+		return nil
+	}
+	v, err := g.View(n.Name)
+	if err != nil {
+		return err
+	}
+
+	// Start editing at the line under the cursor
+	_, cy := v.Cursor()
+	_, oy := v.Origin()
+	row := cy + oy
+	if row >= len(n.Lines) {
+		row = len(n.Lines) - 1
+	}
+	if row < 0 {
+		row = 0
+	}
+
+	n.Editing = true
+	n.edit = editState{original: n.Content, row: row, oy: oy}
+	if len(n.Lines) == 0 {
+		n.Lines = []string{""}
+	}
+
+	v.Editable = true
+	v.Editor = n
+	v.Highlight = false
+	v.Subtitle = " EDIT | Ctrl+S: Save | Ctrl+Z/Ctrl+Y: Undo/Redo | ESC: Cancel "
+	g.Cursor = true
+
+	n.render(v)
+	return nil
+}
+
+// StopEditing leaves editing mode and shows the given content
+func (n *Notepad) StopEditing(g *gocui.Gui, content string) error {
+	n.Editing = false
+	n.edit = editState{}
+	g.Cursor = false
+
+	v, err := g.View(n.Name)
+	if err != nil {
+		return err
+	}
+	v.Editable = false
+	v.Editor = nil
+	v.Highlight = true
+	v.Subtitle = ""
+	if err := n.Update(g, content); err != nil {
+		return err
+	}
+	n.changed()
+	return nil
+}
+
+// CancelEditing leaves editing mode discarding all changes
+func (n *Notepad) CancelEditing(g *gocui.Gui, v *gocui.View) error {
+	return n.StopEditing(g, n.edit.original)
+}
+
+// Text returns the text currently in the editor
+func (n *Notepad) Text() string {
+	return strings.Join(n.Lines, "\n")
+}
+
+// SetCursorPosition moves the editing cursor to a 1-based line and column
+func (n *Notepad) SetCursorPosition(g *gocui.Gui, line, column int) {
+	if !n.Editing || line < 1 {
+		return
+	}
+	n.edit.row = line - 1
+	n.edit.col = column - 1
+	n.clampCursor()
+	if v, err := g.View(n.Name); err == nil {
+		n.render(v)
+	}
+}
+
+// Save passes the edited text to OnSave
+func (n *Notepad) Save(g *gocui.Gui, v *gocui.View) error {
+	if n.Editing && n.OnSave != nil {
+		n.OnSave(n.Text())
+	}
+	return nil
+}
+
+// Undo restores the state before the last change
+func (n *Notepad) Undo(g *gocui.Gui, v *gocui.View) error {
+	if !n.Editing || len(n.edit.undo) == 0 {
+		return nil
+	}
+	last := n.edit.undo[len(n.edit.undo)-1]
+	n.edit.undo = n.edit.undo[:len(n.edit.undo)-1]
+	n.edit.redo = append(n.edit.redo, n.snapshot())
+	n.restore(last)
+	n.render(v)
+	n.changed()
+	return nil
+}
+
+// Redo re-applies the last undone change
+func (n *Notepad) Redo(g *gocui.Gui, v *gocui.View) error {
+	if !n.Editing || len(n.edit.redo) == 0 {
+		return nil
+	}
+	last := n.edit.redo[len(n.edit.redo)-1]
+	n.edit.redo = n.edit.redo[:len(n.edit.redo)-1]
+	n.edit.undo = append(n.edit.undo, n.snapshot())
+	n.restore(last)
+	n.render(v)
+	n.changed()
+	return nil
+}
+
+// Edit implements gocui.Editor for the editing mode
+func (n *Notepad) Edit(v *gocui.View, key gocui.Key, ch rune, mod gocui.Modifier) {
+	if !n.Editing {
+		return
+	}
+
+	if ch != 0 && mod == gocui.ModNone {
+		// Consecutive characters are undone as one step
+		if !n.edit.typing {
+			n.pushUndo()
+			n.edit.typing = true
+		}
+		n.insert(string(ch))
+		n.render(v)
+		n.changed()
+		return
+	}
+
+	n.edit.typing = false
+	before := n.Content
+	switch key {
+	case gocui.KeySpace:
+		n.pushUndo()
+		n.insert(" ")
+	case gocui.KeyTab:
+		n.pushUndo()
+		n.insert("  ")
+	case gocui.KeyEnter:
+		n.pushUndo()
+		n.newLine()
+	case gocui.KeyBackspace, gocui.KeyBackspace2:
+		n.pushUndo()
+		n.backspace()
+	case gocui.KeyDelete:
+		n.pushUndo()
+		n.deleteForward()
+	case gocui.KeyArrowLeft:
+		n.moveLeft()
+	case gocui.KeyArrowRight:
+		n.moveRight()
+	case gocui.KeyArrowUp:
+		n.edit.row--
+	case gocui.KeyArrowDown:
+		n.edit.row++
+	case gocui.KeyHome:
+		n.edit.col = 0
+	case gocui.KeyEnd:
+		n.edit.col = len([]rune(n.Lines[n.edit.row]))
+	case gocui.KeyPgup:
+		_, h := v.Size()
+		n.edit.row -= h
+	case gocui.KeyPgdn:
+		_, h := v.Size()
+		n.edit.row += h
+	default:
+		return
+	}
+	n.clampCursor()
+	n.render(v)
+	if n.Content != before {
+		n.changed()
+	}
+}
+
+// changed passes the current text to OnChange
+func (n *Notepad) changed() {
+	if n.OnChange != nil {
+		n.OnChange(n.Content)
+	}
+}
+
+// snapshot captures the current buffer and cursor
+func (n *Notepad) snapshot() snapshot {
+	lines := make([]string, len(n.Lines))
+	copy(lines, n.Lines)
+	return snapshot{lines: lines, row: n.edit.row, col: n.edit.col}
+}
+
+// restore replaces the buffer and cursor with a snapshot
+func (n *Notepad) restore(s snapshot) {
+	n.Lines = s.lines
+	n.edit.row = s.row
+	n.edit.col = s.col
+	n.clampCursor()
+}
+
+// pushUndo records the current state before a change
+func (n *Notepad) pushUndo() {
+	n.edit.undo = append(n.edit.undo, n.snapshot())
+	if len(n.edit.undo) > maxUndo {
+		n.edit.undo = n.edit.undo[1:]
+	}
+	n.edit.redo = nil
+}
+
+// insert inserts text at the cursor
+func (n *Notepad) insert(text string) {
+	line := []rune(n.Lines[n.edit.row])
+	col := n.edit.col
+	n.Lines[n.edit.row] = string(line[:col]) + text + string(line[col:])
+	n.edit.col += len([]rune(text))
+}
+
+// newLine splits the line at the cursor, keeping the indentation of the current line
+func (n *Notepad) newLine() {
+	line := []rune(n.Lines[n.edit.row])
+	col := n.edit.col
+	before, after := string(line[:col]), string(line[col:])
+	indent := before[:len(before)-len(strings.TrimLeft(before, " \t"))]
+
+	lines := make([]string, 0, len(n.Lines)+1)
+	lines = append(lines, n.Lines[:n.edit.row]...)
+	lines = append(lines, before, indent+after)
+	lines = append(lines, n.Lines[n.edit.row+1:]...)
+	n.Lines = lines
+
+	n.edit.row++
+	n.edit.col = len([]rune(indent))
+}
+
+// backspace deletes the character before the cursor, joining lines at line start
+func (n *Notepad) backspace() {
+	if n.edit.col > 0 {
+		line := []rune(n.Lines[n.edit.row])
+		n.Lines[n.edit.row] = string(line[:n.edit.col-1]) + string(line[n.edit.col:])
+		n.edit.col--
+		return
+	}
+	if n.edit.row == 0 {
+		return
+	}
+	prev := n.Lines[n.edit.row-1]
+	n.edit.col = len([]rune(prev))
+	n.Lines[n.edit.row-1] = prev + n.Lines[n.edit.row]
+	n.Lines = append(n.Lines[:n.edit.row], n.Lines[n.edit.row+1:]...)
+	n.edit.row--
+}
+
+// deleteForward deletes the character under the cursor, joining lines at line end
+func (n *Notepad) deleteForward() {
+	line := []rune(n.Lines[n.edit.row])
+	if n.edit.col < len(line) {
+		n.Lines[n.edit.row] = string(line[:n.edit.col]) + string(line[n.edit.col+1:])
+		return
+	}
+	if n.edit.row >= len(n.Lines)-1 {
+		return
+	}
+	n.Lines[n.edit.row] += n.Lines[n.edit.row+1]
+	n.Lines = append(n.Lines[:n.edit.row+1], n.Lines[n.edit.row+2:]...)
+}
+
+// moveLeft moves the cursor one character left, wrapping to the previous line
+func (n *Notepad) moveLeft() {
+	if n.edit.col > 0 {
+		n.edit.col--
+	} else if n.edit.row > 0 {
+		n.edit.row--
+		n.edit.col = len([]rune(n.Lines[n.edit.row]))
+	}
+}
+
+// moveRight moves the cursor one character right, wrapping to the next line
+func (n *Notepad) moveRight() {
+	if n.edit.col < len([]rune(n.Lines[n.edit.row])) {
+		n.edit.col++
+	} else if n.edit.row < len(n.Lines)-1 {
+		n.edit.row++
+		n.edit.col = 0
+	}
+}
+
+// clampCursor keeps the cursor inside the buffer
+func (n *Notepad) clampCursor() {
+	if n.edit.row >= len(n.Lines) {
+		n.edit.row = len(n.Lines) - 1
+	}
+	if n.edit.row < 0 {
+		n.edit.row = 0
+	}
+	if lineLen := len([]rune(n.Lines[n.edit.row])); n.edit.col > lineLen {
+		n.edit.col = lineLen
+	}
+	if n.edit.col < 0 {
+		n.edit.col = 0
+	}
+}
+
+// render redraws the buffer and scrolls so the cursor stays visible
+func (n *Notepad) render(v *gocui.View) {
+	w, h := v.Size()
+	if n.edit.row < n.edit.oy {
+		n.edit.oy = n.edit.row
+	} else if h > 0 && n.edit.row >= n.edit.oy+h {
+		n.edit.oy = n.edit.row - h + 1
+	}
+	if n.edit.col < n.edit.ox {
+		n.edit.ox = n.edit.col
+	} else if w > 0 && n.edit.col >= n.edit.ox+w {
+		n.edit.ox = n.edit.col - w + 1
+	}
+
+	n.Content = n.Text()
+	v.Clear()
+	v.Write([]byte(n.Content))
+
+	// In editing mode the view cursor is kept in buffer coordinates
+	v.SetOrigin(n.edit.ox, n.edit.oy)
+	v.SetCursorUnrestricted(n.edit.col, n.edit.row)
+}
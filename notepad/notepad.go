@@ -11,17 +11,28 @@ import (
 type Notepad struct {
 	Name       string
 	Title      string
-	Editable   bool
+	Editable   bool // if true, the content can be edited (E enters editing mode)
+	Editing    bool // true while in multi-line editing mode
 	Content    string
 	Lines      []string
 	OnEditLine func(lineNum int, oldLine string) // callback when Enter is pressed on a line
 	OnBack     func()                            // callback when Esc is pressed
+	OnSave     func(content string)              // callback when Ctrl+S is pressed in editing mode
+	OnChange   func(content string)              // callback when the text changes in editing mode or editing stops
+	Split      bool                              // if true, the notepad only takes the upper half of its pane
+	Reserved   int                               // rows left free below the notepad for other views
+
+	edit editState
 }
 
 // Layout draws the notepad
 func (n *Notepad) Layout(g *gocui.Gui) error {
 	maxX, maxY := g.Size()
-	if v, err := g.SetView(n.Name, maxX/2, 3, maxX-1, maxY-3, 0); err != nil {
+	y1 := maxY - 3 - n.Reserved
+	if n.Split {
+		y1 = 3 + (maxY-6)/2
+	}
+	if v, err := g.SetView(n.Name, maxX/2, 3, maxX-1, y1, 0); err != nil {
 		if err != gocui.ErrUnknownView {
 			return err
 		}
@@ -69,6 +80,11 @@ func (n *Notepad) SetActive(g *gocui.Gui, active bool) {
 
 // CursorDown moves cursor down in the notepad
 func (n *Notepad) CursorDown(g *gocui.Gui, v *gocui.View) error {
+	if n.Editing {
+		n.Edit(v, gocui.KeyArrowDown, 0, gocui.ModNone)
+		return nil
+	}
+
 	cx, cy := v.Cursor()
 	ox, oy := v.Origin()
 	_, h := v.Size()
@@ -85,6 +101,11 @@ func (n *Notepad) CursorDown(g *gocui.Gui, v *gocui.View) error {
 
 // CursorUp moves cursor up in the notepad
 func (n *Notepad) CursorUp(g *gocui.Gui, v *gocui.View) error {
+	if n.Editing {
+		n.Edit(v, gocui.KeyArrowUp, 0, gocui.ModNone)
+		return nil
+	}
+
 	cx, cy := v.Cursor()
 	ox, oy := v.Origin()
 
@@ -98,6 +119,11 @@ func (n *Notepad) CursorUp(g *gocui.Gui, v *gocui.View) error {
 
 // EditLine triggers the edit line callback
 func (n *Notepad) EditLine(g *gocui.Gui, v *gocui.View) error {
+	if n.Editing {
+		n.Edit(v, gocui.KeyEnter, 0, gocui.ModNone)
+		return nil
+	}
+
 	_, cy := v.Cursor()
 	_, oy := v.Origin()
 	lineNum := cy + oy
@@ -110,6 +136,10 @@ func (n *Notepad) EditLine(g *gocui.Gui, v *gocui.View) error {
 
 // GoBack navigates back (e.g., to document list)
 func (n *Notepad) GoBack(g *gocui.Gui, v *gocui.View) error {
+	if n.Editing {
+		return n.CancelEditing(g, v)
+	}
+
 	if n.OnBack != nil {
 		n.OnBack()
 	}
@@ -130,4 +160,18 @@ func (n *Notepad) BindKeys(g *gocui.Gui) {
 	if err := g.SetKeybinding(n.Name, gocui.KeyEsc, gocui.ModNone, n.GoBack); err != nil {
 		log.Panicln(err)
 	}
+	if err := g.SetKeybinding(n.Name, 'e', gocui.ModNone, func(g *gocui.Gui, v *gocui.View) error {
+		return n.StartEditing(g)
+	}); err != nil {
+		log.Panicln(err)
+	}
+	if err := g.SetKeybinding(n.Name, gocui.KeyCtrlS, gocui.ModNone, n.Save); err != nil {
+		log.Panicln(err)
+	}
+	if err := g.SetKeybinding(n.Name, gocui.KeyCtrlZ, gocui.ModNone, n.Undo); err != nil {
+		log.Panicln(err)
+	}
+	if err := g.SetKeybinding(n.Name, gocui.KeyCtrlY, gocui.ModNone, n.Redo); err != nil {
+		log.Panicln(err)
+	}
 }
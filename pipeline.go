@@ -0,0 +1,422 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/awesome-gocui/gocui"
+	"github.com/ksiezykm/FerretMate/db"
+	"github.com/ksiezykm/FerretMate/list"
+	"github.com/ksiezykm/FerretMate/model"
+	"github.com/ksiezykm/FerretMate/notepad"
+	"github.com/ksiezykm/FerretMate/popup"
+)
+
+const (
+	previewView    = "preview"
+	previewLimit   = 10                     // documents shown in the preview
+	previewDelay   = 300 * time.Millisecond // typing pause before the preview runs
+	previewTimeout = 30 * time.Second
+	newStage       = "{$match: {}}"
+)
+
+// pipelineBuilder edits an aggregation pipeline on the "pipeline" level:
+// the stages are listed on the left, the selected stage is edited in the
+// notepad and the output after that stage is previewed below it
+type pipelineBuilder struct {
+	level
+	note *notepad.Notepad
+
+	mu      sync.Mutex
+	cancel  context.CancelFunc // cancels the running or scheduled preview
+	seq     int                // number of the latest preview
+	preview string             // preview text
+	shown   string             // preview text in the view, only used by Layout
+}
+
+// Open shows the pipeline of the collection under the cursor (collections
+// level) or of the listed documents (documents level)
+func (pb *pipelineBuilder) Open() {
+	switch pb.m.SelectedListView {
+	case "collections":
+		if pb.list.Selected >= len(pb.m.Collections) {
+			return
+		}
+		pb.m.SelectedCollection = pb.m.Collections[pb.list.Selected]
+		pb.m.SelectedCollectionIndex = pb.list.Selected
+	case "documents":
+		if pb.note.Editing {
+			return
+		}
+	default:
+		return
+	}
+
+	// Keep the unsaved pipeline of the same collection
+	namespace := pb.m.SelectedDB + "." + pb.m.SelectedCollection
+	if pb.m.PipelineNamespace != namespace || len(pb.m.Pipeline.Stages) == 0 {
+		pb.m.Pipeline = model.Pipeline{Stages: []model.Stage{{Text: newStage}}}
+		pb.m.PipelineNamespace = namespace
+	}
+	pb.m.PipelineFrom = pb.m.SelectedListView
+	pb.m.SelectedListView = "pipeline"
+	pb.note.Split = true
+
+	pb.refresh(0)
+	pb.FocusList()
+}
+
+// Close cancels the preview before leaving the pipeline level
+func (pb *pipelineBuilder) Close() {
+	pb.mu.Lock()
+	if pb.cancel != nil {
+		pb.cancel()
+		pb.cancel = nil
+	}
+	pb.seq++
+	pb.preview = ""
+	pb.shown = ""
+	pb.mu.Unlock()
+
+	pb.note.Split = false
+	pb.g.DeleteView(previewView)
+}
+
+// refresh redraws the stage list and shows the stage at selected
+func (pb *pipelineBuilder) refresh(selected int) {
+	stages := pb.m.Pipeline.Stages
+	if selected >= len(stages) {
+		selected = len(stages) - 1
+	}
+	if selected < 0 {
+		selected = 0
+	}
+
+	maxX, _ := pb.g.Size()
+	title := "Pipeline"
+	if pb.m.Pipeline.Name != "" {
+		title += " '" + pb.m.Pipeline.Name + "'"
+	}
+	pb.list.Title = buildBreadcrumbTitle(pb.m, title, maxX/2)
+	pb.list.Subtitle = fmt.Sprintf(" %d stages ", len(stages))
+	pb.list.Items = stageItems(stages)
+	pb.list.Selected = selected
+	pb.list.Update(pb.g)
+	pb.Show(selected)
+}
+
+// Show puts the stage at i into the notepad and previews its output
+func (pb *pipelineBuilder) Show(i int) {
+	stages := pb.m.Pipeline.Stages
+	if i >= len(stages) {
+		pb.note.Editable = false
+		pb.note.Update(pb.g, "No stages, press N to add one")
+		pb.schedulePreview(-1, "")
+		return
+	}
+	if v, err := pb.g.View(pb.note.Name); err == nil {
+		v.Title = fmt.Sprintf("Stage %d", i+1)
+		if stages[i].Disabled {
+			v.Title += " (disabled)"
+		}
+	}
+	pb.note.Editable = true
+	pb.note.Update(pb.g, stages[i].Text)
+	pb.schedulePreview(i, stages[i].Text)
+}
+
+// Edit focuses the notepad and starts editing the selected stage
+func (pb *pipelineBuilder) Edit() {
+	if pb.list.Selected >= len(pb.m.Pipeline.Stages) {
+		return
+	}
+	pb.list.SetActive(pb.g, false)
+	pb.note.SetActive(pb.g, true)
+	pb.g.SetCurrentView(pb.note.Name)
+	pb.note.StartEditing(pb.g)
+}
+
+// Changed previews the stage text being edited
+func (pb *pipelineBuilder) Changed(content string) {
+	pb.schedulePreview(pb.list.Selected, content)
+}
+
+// SaveStage stores the edited stage text if it is a valid stage
+func (pb *pipelineBuilder) SaveStage(content string) {
+	i := pb.list.Selected
+	if i >= len(pb.m.Pipeline.Stages) {
+		return
+	}
+	if _, err := db.ParseStage(content); err != nil {
+		popup.ShowInfoWithFocus(pb.g, "Invalid stage: "+err.Error(), pb.note.Name)
+		return
+	}
+	pb.m.Pipeline.Stages[i].Text = content
+	pb.note.StopEditing(pb.g, content)
+	pb.list.Items = stageItems(pb.m.Pipeline.Stages)
+	pb.list.Update(pb.g)
+}
+
+// Add inserts a new stage after the selected one and starts editing it
+func (pb *pipelineBuilder) Add() {
+	stages := pb.m.Pipeline.Stages
+	i := pb.list.Selected + 1
+	if i > len(stages) {
+		i = len(stages)
+	}
+	stages = append(stages[:i], append([]model.Stage{{Text: newStage}}, stages[i:]...)...)
+	pb.m.Pipeline.Stages = stages
+	pb.refresh(i)
+	pb.Edit()
+}
+
+// Delete asks for confirmation and removes the selected stage
+func (pb *pipelineBuilder) Delete() {
+	i := pb.list.Selected
+	if i >= len(pb.m.Pipeline.Stages) {
+		return
+	}
+	popup.ShowConfirmation(pb.g, fmt.Sprintf("Delete stage %d?", i+1), func() {
+		stages := pb.m.Pipeline.Stages
+		pb.m.Pipeline.Stages = append(stages[:i], stages[i+1:]...)
+		pb.refresh(i)
+	}, func() {
+		// Cancelled - do nothing
+	})
+}
+
+// Toggle enables or disables the selected stage
+func (pb *pipelineBuilder) Toggle() {
+	i := pb.list.Selected
+	if i >= len(pb.m.Pipeline.Stages) {
+		return
+	}
+	pb.m.Pipeline.Stages[i].Disabled = !pb.m.Pipeline.Stages[i].Disabled
+	pb.refresh(i)
+}
+
+// Move moves the selected stage up (-1) or down (+1)
+func (pb *pipelineBuilder) Move(delta int) {
+	stages := pb.m.Pipeline.Stages
+	i := pb.list.Selected
+	j := i + delta
+	if i >= len(stages) || j < 0 || j >= len(stages) {
+		return
+	}
+	stages[i], stages[j] = stages[j], stages[i]
+	pb.refresh(j)
+}
+
+// Save asks for a name and stores the pipeline for the collection
+func (pb *pipelineBuilder) Save() {
+	form := &popup.Form{
+		Name:     "pipelineForm",
+		Title:    "Save Pipeline",
+		Fields:   []popup.FormField{{Label: "Name", Value: pb.m.Pipeline.Name}},
+		OnCancel: pb.FocusList,
+	}
+	form.OnSave = func(values []string) {
+		if values[0] == "" {
+			popup.ShowInfo(pb.g, "A name is required")
+			return
+		}
+		pb.m.Pipeline.Name = values[0]
+		if err := model.SavePipeline(pb.m.PipelineNamespace, pb.m.Pipeline); err != nil {
+			popup.ShowInfo(pb.g, "Failed to save pipeline: "+err.Error())
+			log.Printf("Failed to save pipeline: %v", err)
+			return
+		}
+		pb.refresh(pb.list.Selected)
+		popup.ShowInfo(pb.g, "Pipeline '"+values[0]+"' saved")
+	}
+
+	if err := form.Show(pb.g); err != nil {
+		log.Panicln(err)
+	}
+	form.BindKeys(pb.g)
+}
+
+// Load lets the user pick one of the saved pipelines of the collection, or
+// delete one
+func (pb *pipelineBuilder) Load() {
+	pipelines, err := model.LoadPipelines(pb.m.PipelineNamespace)
+	if err != nil {
+		popup.ShowInfo(pb.g, "Failed to load pipelines: "+err.Error())
+		log.Printf("Failed to load pipelines: %v", err)
+		return
+	}
+	if len(pipelines) == 0 {
+		popup.ShowInfo(pb.g, "No saved pipelines for "+pb.m.PipelineNamespace)
+		return
+	}
+
+	names := make([]string, 0, len(pipelines))
+	for _, p := range pipelines {
+		names = append(names, fmt.Sprintf("%s (%d stages)", p.Name, len(p.Stages)))
+	}
+	popup.ShowChoice(pb.g, "Saved pipelines", append(names, "Delete a saved pipeline..."), func(i int) {
+		if i == len(pipelines) {
+			pb.deleteSaved(pipelines, names)
+			return
+		}
+		pb.m.Pipeline = pipelines[i]
+		pb.refresh(0)
+	}, nil)
+}
+
+// deleteSaved lets the user pick a saved pipeline and deletes it after a confirmation
+func (pb *pipelineBuilder) deleteSaved(pipelines []model.Pipeline, names []string) {
+	namespace := pb.m.PipelineNamespace
+	popup.ShowChoice(pb.g, "Delete saved pipeline", names, func(i int) {
+		name := pipelines[i].Name
+		popup.ShowConfirmation(pb.g, "Delete saved pipeline '"+name+"'?", func() {
+			if err := model.DeletePipeline(namespace, name); err != nil {
+				popup.ShowInfo(pb.g, "Failed to delete pipeline: "+err.Error())
+				log.Printf("Failed to delete pipeline: %v", err)
+				return
+			}
+			popup.ShowToast(pb.g, "Deleted saved pipeline '"+name+"'")
+		}, nil)
+	}, nil)
+}
+
+// Export writes the enabled stages as a JSON pipeline file
+func (pb *pipelineBuilder) Export() {
+	name := pb.m.Pipeline.Name
+	if name == "" {
+		name = "pipeline"
+	}
+	exportPath := "./exports/" + pb.m.SelectedDB + "/" + pb.m.SelectedCollection + "/pipeline-" + db.IDFileName(name) + ".json"
+
+	popup.ShowConfirmation(pb.g, "Export pipeline to '"+exportPath+"'?", func() {
+		if err := db.ExportPipeline(pb.m.Pipeline.Stages, exportPath); err != nil {
+			popup.ShowInfo(pb.g, "Failed to export pipeline: "+err.Error())
+			log.Printf("Failed to export pipeline: %v", err)
+			return
+		}
+		popup.ShowInfo(pb.g, "Pipeline exported to: "+exportPath)
+	}, func() {
+		// Cancelled - do nothing
+	})
+}
+
+// schedulePreview runs the pipeline up to stage i, with text in place of
+// the stored stage, after a short pause. A newer preview cancels this one.
+func (pb *pipelineBuilder) schedulePreview(i int, text string) {
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+	if pb.cancel != nil {
+		pb.cancel()
+	}
+	pb.seq++
+	seq := pb.seq
+
+	if i < 0 {
+		pb.preview = ""
+		return
+	}
+
+	// Snapshot everything the preview needs, the model may change meanwhile
+	stages := append([]model.Stage{}, pb.m.Pipeline.Stages...)
+	stages[i].Text = text
+	client, conn, dbName, collName := pb.client(), pb.m.SelectedConnection, pb.m.SelectedDB, pb.m.SelectedCollection
+	ctx, cancel := context.WithTimeout(context.Background(), previewTimeout)
+	pb.cancel = cancel
+	pb.preview = fmt.Sprintf("Output of stages 1-%d\n\nRunning...", i+1)
+
+	go func() {
+		select {
+		case <-time.After(previewDelay):
+		case <-ctx.Done():
+			return
+		}
+
+		var b strings.Builder
+		fmt.Fprintf(&b, "Output of stages 1-%d (first %d documents)\n\n", i+1, previewLimit)
+		pipeline, err := db.BuildPipeline(stages, i)
+		if err == nil && client == nil {
+			err = fmt.Errorf("session '%s' is closed", conn)
+		}
+		var docs []string
+		start := time.Now()
+		if err == nil {
+			docs, err = db.PreviewPipeline(ctx, client, dbName, collName, pipeline, previewLimit)
+		}
+		switch {
+		case ctx.Err() == context.Canceled:
+			return
+		case err != nil:
+			b.WriteString("Error: " + err.Error())
+		case len(docs) == 0:
+			fmt.Fprintf(&b, "No documents (%s)", time.Since(start).Round(time.Millisecond))
+		default:
+			fmt.Fprintf(&b, "%d documents in %s\n\n", len(docs), time.Since(start).Round(time.Millisecond))
+			b.WriteString(strings.Join(docs, "\n"))
+		}
+
+		pb.mu.Lock()
+		if seq == pb.seq {
+			pb.preview = b.String()
+		}
+		pb.mu.Unlock()
+		pb.g.Update(func(g *gocui.Gui) error { return nil })
+	}()
+}
+
+// Layout draws the preview below the notepad on the pipeline level
+func (pb *pipelineBuilder) Layout(g *gocui.Gui) error {
+	pb.note.Split = pb.m.SelectedListView == "pipeline"
+	if !pb.note.Split {
+		g.DeleteView(previewView)
+		return nil
+	}
+
+	maxX, maxY := g.Size()
+	v, err := g.SetView(previewView, maxX/2, 3+(maxY-6)/2+1, maxX-1, maxY-3, 0)
+	if err != nil {
+		if err != gocui.ErrUnknownView {
+			return err
+		}
+		v.Title = "Preview"
+		v.Wrap = true
+	}
+
+	pb.mu.Lock()
+	preview := pb.preview
+	pb.mu.Unlock()
+	if preview != pb.shown {
+		pb.shown = preview
+		v.Clear()
+		v.SetOrigin(0, 0)
+		v.Write([]byte(preview))
+	}
+	return nil
+}
+
+// FocusList returns the focus from the notepad to the stage list
+func (pb *pipelineBuilder) FocusList() {
+	pb.note.SetActive(pb.g, false)
+	pb.list.SetActive(pb.g, true)
+	pb.g.SetCurrentView(pb.list.Name)
+}
+
+// stageItems lists the stages with their number and state
+func stageItems(stages []model.Stage) []list.Item {
+	items := make([]list.Item, 0, len(stages))
+	for i, s := range stages {
+		text := strings.Join(strings.Fields(s.Text), " ")
+		if len(text) > 60 {
+			text = text[:57] + "..."
+		}
+		state := "[x]"
+		if s.Disabled {
+			state = "[ ]"
+		}
+		items = append(items, list.Item{Label: fmt.Sprintf("%d. %s %s", i+1, state, text), Value: i})
+	}
+	return items
+}
@@ -0,0 +1,127 @@
+package popup
+
+import (
+	"strings"
+
+	"github.com/awesome-gocui/gocui"
+)
+
+// ShowChecklist shows a list of options that can be ticked; Space toggles
+// the highlighted one, A toggles all, Enter passes the ticks to onDone and
+// ESC calls onCancel. checked gives the initial ticks. The focus returns to the list.
+func ShowChecklist(g *gocui.Gui, title string, options []string, checked []bool, onDone func(checked []bool), onCancel func()) {
+	maxX, maxY := g.Size()
+	width := len(title) + 6
+	for _, option := range options {
+		if len(option)+10 > width {
+			width = len(option) + 10
+		}
+	}
+	if width > maxX-10 {
+		width = maxX - 10
+	}
+	height := len(options) + 1
+	if height > maxY-6 {
+		height = maxY - 6
+	}
+	x0 := (maxX - width) / 2
+	y0 := (maxY - height) / 2
+	x1 := x0 + width
+	y1 := y0 + height
+
+	ticks := make([]bool, len(options))
+	copy(ticks, checked)
+	selected := 0
+
+	render := func(v *gocui.View) {
+		lines := make([]string, len(options))
+		for i, option := range options {
+			box := "[ ]"
+			if ticks[i] {
+				box = "[x]"
+			}
+			lines[i] = " " + box + " " + option
+		}
+		v.Clear()
+		v.Write([]byte(strings.Join(lines, "\n")))
+	}
+
+	g.Update(func(g *gocui.Gui) error {
+		v, err := g.SetView("checklist_popup", x0, y0, x1, y1, 0)
+		if err != nil && err != gocui.ErrUnknownView {
+			return err
+		}
+		v.Title = " " + title + " "
+		v.Subtitle = " ↑↓: Move | Space: Toggle | a: All | Enter: OK | ESC: Cancel "
+		v.Highlight = true
+		v.SelBgColor = gocui.ColorCyan
+		v.SelFgColor = gocui.ColorBlack
+		render(v)
+		v.SetCursor(0, 0)
+		v.SetOrigin(0, 0)
+		g.SetCurrentView("checklist_popup")
+
+		closePopup := func(g *gocui.Gui) {
+			g.DeleteView("checklist_popup")
+			g.DeleteKeybindings("checklist_popup")
+			g.SetCurrentView("listView")
+		}
+
+		move := func(delta int) func(g *gocui.Gui, v *gocui.View) error {
+			return func(g *gocui.Gui, v *gocui.View) error {
+				next := selected + delta
+				if next < 0 || next >= len(options) {
+					return nil
+				}
+				selected = next
+				_, h := v.Size()
+				_, oy := v.Origin()
+				if selected < oy {
+					oy = selected
+				} else if h > 0 && selected >= oy+h {
+					oy = selected - h + 1
+				}
+				v.SetOrigin(0, oy)
+				v.SetCursor(0, selected-oy)
+				return nil
+			}
+		}
+
+		g.SetKeybinding("checklist_popup", gocui.KeyArrowUp, gocui.ModNone, move(-1))
+		g.SetKeybinding("checklist_popup", gocui.KeyArrowDown, gocui.ModNone, move(1))
+		g.SetKeybinding("checklist_popup", gocui.KeySpace, gocui.ModNone, func(g *gocui.Gui, v *gocui.View) error {
+			if selected < len(ticks) {
+				ticks[selected] = !ticks[selected]
+				render(v)
+			}
+			return nil
+		})
+		g.SetKeybinding("checklist_popup", 'a', gocui.ModNone, func(g *gocui.Gui, v *gocui.View) error {
+			// Tick all, or untick all when all are ticked
+			all := true
+			for _, t := range ticks {
+				all = all && t
+			}
+			for i := range ticks {
+				ticks[i] = !all
+			}
+			render(v)
+			return nil
+		})
+		g.SetKeybinding("checklist_popup", gocui.KeyEnter, gocui.ModNone, func(g *gocui.Gui, v *gocui.View) error {
+			closePopup(g)
+			if onDone != nil {
+				onDone(ticks)
+			}
+			return nil
+		})
+		g.SetKeybinding("checklist_popup", gocui.KeyEsc, gocui.ModNone, func(g *gocui.Gui, v *gocui.View) error {
+			closePopup(g)
+			if onCancel != nil {
+				onCancel()
+			}
+			return nil
+		})
+		return nil
+	})
+}
@@ -0,0 +1,93 @@
+package popup
+
+import (
+	"strings"
+
+	"github.com/awesome-gocui/gocui"
+)
+
+// ShowChoice shows a list of options; Enter picks the highlighted one and
+// passes its index to onSelect, ESC calls onCancel. The focus returns to the list.
+func ShowChoice(g *gocui.Gui, title string, options []string, onSelect func(index int), onCancel func()) {
+	maxX, maxY := g.Size()
+	width := len(title) + 6
+	for _, option := range options {
+		if len(option)+6 > width {
+			width = len(option) + 6
+		}
+	}
+	if width > maxX-10 {
+		width = maxX - 10
+	}
+	height := len(options) + 1
+	if height > maxY-6 {
+		height = maxY - 6
+	}
+	x0 := (maxX - width) / 2
+	y0 := (maxY - height) / 2
+	x1 := x0 + width
+	y1 := y0 + height
+
+	selected := 0
+
+	g.Update(func(g *gocui.Gui) error {
+		v, err := g.SetView("choice_popup", x0, y0, x1, y1, 0)
+		if err != nil && err != gocui.ErrUnknownView {
+			return err
+		}
+		v.Title = " " + title + " "
+		v.Subtitle = " ↑↓: Move | Enter: Select | ESC: Cancel "
+		v.Highlight = true
+		v.SelBgColor = gocui.ColorCyan
+		v.SelFgColor = gocui.ColorBlack
+		v.Clear()
+		v.Write([]byte(" " + strings.Join(options, "\n ")))
+		v.SetCursor(0, 0)
+		v.SetOrigin(0, 0)
+		g.SetCurrentView("choice_popup")
+
+		closePopup := func(g *gocui.Gui) {
+			g.DeleteView("choice_popup")
+			g.DeleteKeybindings("choice_popup")
+			g.SetCurrentView("listView")
+		}
+
+		move := func(delta int) func(g *gocui.Gui, v *gocui.View) error {
+			return func(g *gocui.Gui, v *gocui.View) error {
+				next := selected + delta
+				if next < 0 || next >= len(options) {
+					return nil
+				}
+				selected = next
+				_, h := v.Size()
+				_, oy := v.Origin()
+				if selected < oy {
+					oy = selected
+				} else if h > 0 && selected >= oy+h {
+					oy = selected - h + 1
+				}
+				v.SetOrigin(0, oy)
+				v.SetCursor(0, selected-oy)
+				return nil
+			}
+		}
+
+		g.SetKeybinding("choice_popup", gocui.KeyArrowUp, gocui.ModNone, move(-1))
+		g.SetKeybinding("choice_popup", gocui.KeyArrowDown, gocui.ModNone, move(1))
+		g.SetKeybinding("choice_popup", gocui.KeyEnter, gocui.ModNone, func(g *gocui.Gui, v *gocui.View) error {
+			closePopup(g)
+			if onSelect != nil && selected < len(options) {
+				onSelect(selected)
+			}
+			return nil
+		})
+		g.SetKeybinding("choice_popup", gocui.KeyEsc, gocui.ModNone, func(g *gocui.Gui, v *gocui.View) error {
+			closePopup(g)
+			if onCancel != nil {
+				onCancel()
+			}
+			return nil
+		})
+		return nil
+	})
+}
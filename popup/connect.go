@@ -1,7 +1,9 @@
 package popup
 
 import (
+	"context"
 	"fmt"
+	"log"
 	"sync"
 	"time"
 
@@ -23,8 +25,11 @@ func ShowConnect(g *gocui.Gui, conn model.Connection, onSuccess func() error) {
 	}
 
 	maxX, maxY := g.Size()
-	width := 40
-	height := 7
+	width := 60
+	if width > maxX-4 {
+		width = maxX - 4
+	}
+	height := 9
 	x0 := (maxX - width) / 2
 	y0 := (maxY - height) / 2
 	x1 := x0 + width
@@ -36,6 +41,7 @@ func ShowConnect(g *gocui.Gui, conn model.Connection, onSuccess func() error) {
 			return err
 		}
 		v.Title = " Connecting "
+		v.Wrap = true
 		v.Clear()
 		v.Write([]byte("\n  Connecting...\n\n  Press ESC to cancel"))
 		g.SetCurrentView("connect_popup")
@@ -96,17 +102,35 @@ func ShowConnect(g *gocui.Gui, conn model.Connection, onSuccess func() error) {
 		default:
 		}
 
-		connDone := make(chan error, 1)
+		type opened struct {
+			created bool
+			err     error
+		}
+		connDone := make(chan opened, 1)
 		go func() {
-			connDone <- db.Connect(conn)
+			_, created, err := db.Open(conn)
+			connDone <- opened{created, err}
 		}()
 
+		// A session this call opened after the user gave up is closed again;
+		// one opened elsewhere meanwhile is in use and stays open
+		closeLate := func() {
+			go func() {
+				if o := <-connDone; o.err == nil && o.created {
+					db.Close(conn.Name)
+				}
+			}()
+		}
+
 		var err error
 		select {
-		case err = <-connDone:
-		case <-time.After(10 * time.Second):
-			err = fmt.Errorf("connection timeout")
+		case o := <-connDone:
+			err = o.err
+		case <-time.After(15 * time.Second):
+			err = fmt.Errorf("connection timeout: %w", context.DeadlineExceeded)
+			closeLate()
 		case <-cp.cancel:
+			closeLate()
 			return
 		}
 
@@ -122,26 +146,41 @@ func ShowConnect(g *gocui.Gui, conn model.Connection, onSuccess func() error) {
 
 			v.Clear()
 			if err != nil {
+				// Connect redacts the credentials from its errors
+				log.Printf("Connection to %s failed: %v", conn.Name, err)
 				v.Title = " Error "
-				v.Write([]byte("\n  Connection failed\n\n  Press ESC to close"))
+				kind, message := db.ClassifyError(err)
+				v.Write([]byte(fmt.Sprintf("\n  Connection failed: %s\n\n  %s\n\n  Press ESC to close", kind, message)))
 			} else {
 				v.Title = " Success "
 				v.Write([]byte("\n  Connected!\n\n  Press ESC to close"))
-				if onSuccess != nil {
-					onSuccess()
-				}
 			}
 
+			// onSuccess runs once the popup is gone, so that a popup it opens
+			// keeps the focus
+			closed := false
 			handleClose := func(g *gocui.Gui, v *gocui.View) error {
-				closePopup()
+				if closed {
+					return nil
+				}
+				closed = true
+				g.DeleteView("connect_popup")
+				g.DeleteKeybindings("connect_popup")
+				g.SetCurrentView("listView")
+				if err == nil && onSuccess != nil {
+					return onSuccess()
+				}
 				return nil
 			}
 
+			g.DeleteKeybindings("connect_popup")
 			g.SetKeybinding("connect_popup", gocui.KeyEsc, gocui.ModNone, handleClose)
 
 			if err == nil {
 				time.AfterFunc(500*time.Millisecond, func() {
-					handleClose(g, v)
+					g.Update(func(g *gocui.Gui) error {
+						return handleClose(g, nil)
+					})
 				})
 			}
 
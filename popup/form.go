@@ -0,0 +1,179 @@
+package popup
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/awesome-gocui/gocui"
+)
+
+// FormField is a single labelled input line of a Form
+type FormField struct {
+	Label string
+	Value string
+	Mask  bool // if true, the input is hidden (e.g. passwords)
+}
+
+// Form is a modal dialog with several single-line input fields
+type Form struct {
+	Name     string
+	Title    string
+	Fields   []FormField
+	OnSave   func(values []string) // callback with the field values, in order
+	OnCancel func()                // callback when cancelled
+
+	focused int
+}
+
+// fieldName returns the view name of the i-th field
+func (f *Form) fieldName(i int) string {
+	return fmt.Sprintf("%s_field%d", f.Name, i)
+}
+
+// Show displays the form
+func (f *Form) Show(g *gocui.Gui) error {
+	maxX, maxY := g.Size()
+	width := maxX * 2 / 3
+	height := len(f.Fields)*3 + 1
+	x0 := (maxX - width) / 2
+	y0 := (maxY - height) / 2
+	if y0 < 0 {
+		y0 = 0
+	}
+	x1 := x0 + width
+	y1 := y0 + height
+
+	if v, err := g.SetView(f.Name, x0, y0, x1, y1, 0); err != nil {
+		if err != gocui.ErrUnknownView {
+			return err
+		}
+		v.Title = f.Title
+		v.Subtitle = " Tab/↑↓: Move | Enter/Ctrl+S: Save | ESC: Cancel "
+	}
+
+	for i, field := range f.Fields {
+		fy0 := y0 + 1 + i*3
+		if v, err := g.SetView(f.fieldName(i), x0+1, fy0, x1-1, fy0+2, 0); err != nil {
+			if err != gocui.ErrUnknownView {
+				return err
+			}
+			v.Title = field.Label
+			v.Editable = true
+			v.Wrap = false
+			if field.Mask {
+				v.Mask = '*'
+			}
+			v.Clear()
+			v.Write([]byte(field.Value))
+			v.SetCursor(len([]rune(field.Value)), 0)
+		}
+	}
+
+	// Enable cursor for editing
+	g.Cursor = true
+
+	f.focused = 0
+	return f.focus(g)
+}
+
+// focus moves the input focus to the currently focused field
+func (f *Form) focus(g *gocui.Gui) error {
+	for i := range f.Fields {
+		if v, err := g.View(f.fieldName(i)); err == nil {
+			if i == f.focused {
+				v.FrameColor = gocui.ColorCyan
+			} else {
+				v.FrameColor = gocui.ColorDefault
+			}
+		}
+	}
+	_, err := g.SetCurrentView(f.fieldName(f.focused))
+	return err
+}
+
+// Next focuses the next field
+func (f *Form) Next(g *gocui.Gui, v *gocui.View) error {
+	f.focused = (f.focused + 1) % len(f.Fields)
+	return f.focus(g)
+}
+
+// Prev focuses the previous field
+func (f *Form) Prev(g *gocui.Gui, v *gocui.View) error {
+	f.focused = (f.focused - 1 + len(f.Fields)) % len(f.Fields)
+	return f.focus(g)
+}
+
+// Values returns the current content of every field
+func (f *Form) Values(g *gocui.Gui) []string {
+	values := make([]string, len(f.Fields))
+	for i := range f.Fields {
+		if v, err := g.View(f.fieldName(i)); err == nil {
+			values[i] = strings.TrimSpace(strings.ReplaceAll(v.Buffer(), "\n", ""))
+		}
+	}
+	return values
+}
+
+// Hide removes the form and all of its fields
+func (f *Form) Hide(g *gocui.Gui) error {
+	// Disable cursor when closing form
+	g.Cursor = false
+
+	for i := range f.Fields {
+		g.DeleteView(f.fieldName(i))
+		g.DeleteKeybindings(f.fieldName(i))
+	}
+	if err := g.DeleteView(f.Name); err != nil {
+		return err
+	}
+	g.DeleteKeybindings(f.Name)
+	return nil
+}
+
+// Save passes the field values to OnSave and closes the form
+func (f *Form) Save(g *gocui.Gui, v *gocui.View) error {
+	values := f.Values(g)
+	if err := f.Hide(g); err != nil {
+		return err
+	}
+	if f.OnSave != nil {
+		f.OnSave(values)
+	}
+	return nil
+}
+
+// Cancel closes the form without saving
+func (f *Form) Cancel(g *gocui.Gui, v *gocui.View) error {
+	if err := f.Hide(g); err != nil {
+		return err
+	}
+	if f.OnCancel != nil {
+		f.OnCancel()
+	}
+	return nil
+}
+
+// BindKeys registers keybindings for every field of the form
+func (f *Form) BindKeys(g *gocui.Gui) {
+	for i := range f.Fields {
+		name := f.fieldName(i)
+		bindings := []struct {
+			key     gocui.Key
+			handler func(*gocui.Gui, *gocui.View) error
+		}{
+			{gocui.KeyTab, f.Next},
+			{gocui.KeyArrowDown, f.Next},
+			{gocui.KeyBacktab, f.Prev},
+			{gocui.KeyArrowUp, f.Prev},
+			{gocui.KeyEnter, f.Save},
+			{gocui.KeyCtrlS, f.Save},
+			{gocui.KeyEsc, f.Cancel},
+		}
+		for _, b := range bindings {
+			if err := g.SetKeybinding(name, b.key, gocui.ModNone, b.handler); err != nil {
+				log.Panicln(err)
+			}
+		}
+	}
+}
@@ -2,6 +2,7 @@ package popup
 
 import (
 	"log"
+	"strings"
 
 	"github.com/awesome-gocui/gocui"
 )
@@ -15,6 +16,8 @@ type Popup struct {
 	OnCancel     func()                  // callback when cancelled
 	SingleLine   bool                    // if true, Enter saves instead of adding newline
 	DisableEnter bool                    // if true, Enter key is completely disabled
+
+	OnExternalEdit func(content string) // if set, Ctrl+E closes the popup and passes its content on
 }
 
 // Show displays the popup
@@ -83,6 +86,16 @@ func (p *Popup) Save(g *gocui.Gui, v *gocui.View) error {
 	return p.Hide(g)
 }
 
+// ExternalEdit closes the popup and hands its content to OnExternalEdit
+func (p *Popup) ExternalEdit(g *gocui.Gui, v *gocui.View) error {
+	content := strings.TrimSuffix(v.Buffer(), "\n")
+	if err := p.Hide(g); err != nil {
+		return err
+	}
+	p.OnExternalEdit(content)
+	return nil
+}
+
 // Cancel closes the popup without saving
 func (p *Popup) Cancel(g *gocui.Gui, v *gocui.View) error {
 	if p.OnCancel != nil {
@@ -102,6 +115,13 @@ func (p *Popup) BindKeys(g *gocui.Gui) {
 		log.Panicln(err)
 	}
 
+	// Ctrl+E to continue in an external editor
+	if p.OnExternalEdit != nil {
+		if err := g.SetKeybinding(p.Name, gocui.KeyCtrlE, gocui.ModNone, p.ExternalEdit); err != nil {
+			log.Panicln(err)
+		}
+	}
+
 	// If SingleLine is true, Enter also saves (like Ctrl+S)
 	if p.SingleLine {
 		if err := g.SetKeybinding(p.Name, gocui.KeyEnter, gocui.ModNone, p.Save); err != nil {
@@ -146,8 +166,12 @@ func ShowInfoWithFocus(g *gocui.Gui, message string, returnToView string) {
 		closePopup := func(g *gocui.Gui, v *gocui.View) error {
 			g.DeleteView("info_popup")
 			g.DeleteKeybindings("info_popup")
-			g.SetCurrentView(returnToView)
-			g.Cursor = false
+			// Keep the cursor visible when returning to a view being edited
+			if rv, err := g.SetCurrentView(returnToView); err == nil {
+				g.Cursor = rv.Editable
+			} else {
+				g.Cursor = false
+			}
 			return nil
 		}
 
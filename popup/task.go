@@ -0,0 +1,101 @@
+package popup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/awesome-gocui/gocui"
+)
+
+// ShowTask runs a long operation in the background while a popup shows the
+// elapsed time. ESC cancels the context passed to run. onDone is called on
+// the UI goroutine with the result (context.Canceled when cancelled).
+func ShowTask(g *gocui.Gui, title, message string, run func(ctx context.Context) error, onDone func(err error)) {
+	showTask(g, title, message, "Press ESC to cancel", run, onDone)
+}
+
+// ShowWait is ShowTask for an operation the server carries on with after
+// the wait is cancelled, such as an index build: ESC only stops waiting
+func ShowWait(g *gocui.Gui, title, message string, run func(ctx context.Context) error, onDone func(err error)) {
+	showTask(g, title, message, "Press ESC to stop waiting (the server carries on)", run, onDone)
+}
+
+// showTask shows the task popup with the ESC hint
+func showTask(g *gocui.Gui, title, message, hint string, run func(ctx context.Context) error, onDone func(err error)) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	maxX, maxY := g.Size()
+	width := 60
+	if width > maxX-4 {
+		width = maxX - 4
+	}
+	height := 7
+	x0 := (maxX - width) / 2
+	y0 := (maxY - height) / 2
+	x1 := x0 + width
+	y1 := y0 + height
+
+	write := func(v *gocui.View, elapsed int) {
+		v.Clear()
+		v.Write([]byte(fmt.Sprintf("\n  %s %ds\n\n  %s", message, elapsed, hint)))
+	}
+
+	g.Update(func(g *gocui.Gui) error {
+		v, err := g.SetView("task_popup", x0, y0, x1, y1, 0)
+		if err != nil && err != gocui.ErrUnknownView {
+			return err
+		}
+		v.Title = " " + title + " "
+		v.Wrap = true
+		write(v, 0)
+		g.SetCurrentView("task_popup")
+		g.SetKeybinding("task_popup", gocui.KeyEsc, gocui.ModNone, func(g *gocui.Gui, v *gocui.View) error {
+			cancel()
+			return nil
+		})
+		return nil
+	})
+
+	done := make(chan error, 1)
+	go func() {
+		done <- run(ctx)
+	}()
+
+	go func() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		elapsed := 0
+
+		var err error
+		for waiting := true; waiting; {
+			select {
+			case err = <-done:
+				waiting = false
+			case <-ticker.C:
+				elapsed++
+				g.Update(func(g *gocui.Gui) error {
+					if v, _ := g.View("task_popup"); v != nil {
+						write(v, elapsed)
+					}
+					return nil
+				})
+			}
+		}
+		if ctx.Err() != nil && err != nil {
+			err = errors.Join(context.Canceled, err)
+		}
+		cancel()
+
+		g.Update(func(g *gocui.Gui) error {
+			g.DeleteView("task_popup")
+			g.DeleteKeybindings("task_popup")
+			g.SetCurrentView("listView")
+			if onDone != nil {
+				onDone(err)
+			}
+			return nil
+		})
+	}()
+}
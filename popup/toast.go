@@ -0,0 +1,56 @@
+package popup
+
+import (
+	"sync"
+	"time"
+
+	"github.com/awesome-gocui/gocui"
+)
+
+// toastDuration is how long a toast stays on screen
+const toastDuration = 4 * time.Second
+
+var (
+	toastMu  sync.Mutex
+	toastSeq int // identifies the latest toast, so older timers leave it alone
+)
+
+// ShowToast shows a short message in the bottom-right corner without taking
+// the focus. It disappears by itself; a newer toast replaces it.
+func ShowToast(g *gocui.Gui, message string) {
+	toastMu.Lock()
+	toastSeq++
+	seq := toastSeq
+	toastMu.Unlock()
+
+	g.Update(func(g *gocui.Gui) error {
+		maxX, maxY := g.Size()
+		width := len([]rune(message)) + 3
+		if width > maxX-4 {
+			width = maxX - 4
+		}
+		v, err := g.SetView("toast", maxX-width-2, maxY-5, maxX-2, maxY-3, 0)
+		if err != nil && err != gocui.ErrUnknownView {
+			return err
+		}
+		v.Frame = true
+		v.FrameColor = gocui.ColorCyan
+		v.Clear()
+		v.Write([]byte(" " + message))
+		g.SetViewOnTop("toast")
+		return nil
+	})
+
+	time.AfterFunc(toastDuration, func() {
+		toastMu.Lock()
+		latest := seq == toastSeq
+		toastMu.Unlock()
+		if !latest {
+			return
+		}
+		g.Update(func(g *gocui.Gui) error {
+			g.DeleteView("toast")
+			return nil
+		})
+	})
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/ksiezykm/FerretMate/db"
+	"github.com/ksiezykm/FerretMate/list"
+	"github.com/ksiezykm/FerretMate/notepad"
+	"github.com/ksiezykm/FerretMate/popup"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// conflictModes are the accepted answers for existing documents, by name
+var conflictModes = map[string]db.ConflictMode{
+	"skip":      db.ConflictSkip,
+	"overwrite": db.ConflictOverwrite,
+	"fail":      db.ConflictFail,
+}
+
+// treeRestore restores collections from an export directory tree written
+// by the database export: it asks for the source, target and conflict mode,
+// lets the collections be picked, shows a dry run and then restores as a
+// background job
+type treeRestore struct {
+	level
+	note  *notepad.Notepad
+	jobs  *jobsPanel
+	stats *statsPanel
+}
+
+// Open starts a restore into the database under the cursor (databases
+// level) or the selected database, preselecting the collection under the
+// cursor (collections level)
+func (r *treeRestore) Open() {
+	var dbName, collName string
+	switch r.m.SelectedListView {
+	case "dbs":
+		if r.list.Selected >= len(r.m.DBs) {
+			return
+		}
+		dbName = r.m.DBs[r.list.Selected]
+	case "collections":
+		if r.list.Selected >= len(r.m.Collections) {
+			return
+		}
+		dbName, collName = r.m.SelectedDB, r.m.Collections[r.list.Selected]
+	default:
+		return
+	}
+	if r.sessionClient() == nil {
+		return
+	}
+	r.showForm("Restore from an export directory", []string{"./exports/" + dbName, dbName, "skip"}, collName)
+}
+
+// showForm asks for the export directory, the target database and the conflict mode
+func (r *treeRestore) showForm(title string, values []string, collName string) {
+	form := &popup.Form{
+		Name:  "restoreTreeForm",
+		Title: title,
+		Fields: []popup.FormField{
+			{Label: "Export directory (one subdirectory per collection)", Value: values[0]},
+			{Label: "Target database", Value: values[1]},
+			{Label: "Existing documents: skip, overwrite or fail", Value: values[2]},
+		},
+		OnCancel: r.focusList,
+	}
+	form.OnSave = func(values []string) {
+		retry := func(problem string) {
+			r.showForm(retryTitle(title, problem), values, collName)
+		}
+
+		dir, dbName := strings.TrimSpace(values[0]), strings.TrimSpace(values[1])
+		mode, ok := conflictModes[strings.ToLower(strings.TrimSpace(values[2]))]
+		switch {
+		case dbName == "":
+			retry("the target database is required")
+			return
+		case !ok:
+			retry("existing documents must be skip, overwrite or fail")
+			return
+		}
+		tree, err := db.ReadExportTree(dir)
+		if err != nil {
+			retry(err.Error())
+			return
+		}
+		r.pickCollections(tree, dbName, mode, collName)
+	}
+
+	if err := form.Show(r.g); err != nil {
+		log.Panicln(err)
+	}
+	form.BindKeys(r.g)
+}
+
+// pickCollections lets the collections to restore be ticked; all of them,
+// or only collName when it is in the export
+func (r *treeRestore) pickCollections(tree db.ExportTree, dbName string, mode db.ConflictMode, collName string) {
+	checked := make([]bool, len(tree.Collections))
+	found := false
+	for i, name := range tree.Collections {
+		checked[i] = name == collName
+		found = found || checked[i]
+	}
+	if !found {
+		for i := range checked {
+			checked[i] = true
+		}
+	}
+
+	popup.ShowChecklist(r.g, "Collections to restore into "+dbName, tree.Collections, checked, func(checked []bool) {
+		var collections []string
+		for i, ok := range checked {
+			if ok {
+				collections = append(collections, tree.Collections[i])
+			}
+		}
+		if len(collections) == 0 {
+			popup.ShowInfo(r.g, "No collections selected")
+			return
+		}
+		r.dryRun(tree, collections, dbName, mode)
+	}, r.focusList)
+}
+
+// dryRun reads the files and checks the existing documents, shows the
+// summary in the notepad and asks before restoring
+func (r *treeRestore) dryRun(tree db.ExportTree, collections []string, dbName string, mode db.ConflictMode) {
+	client := r.sessionClient()
+	if client == nil {
+		return
+	}
+	var plan db.RestorePlan
+	popup.ShowTask(r.g, "Restore dry run", "Reading the export and checking existing documents...", func(ctx context.Context) error {
+		var err error
+		plan, err = db.PlanRestore(ctx, client, tree, collections, dbName, func(done, total int64) {})
+		return err
+	}, func(err error) {
+		if err != nil {
+			popup.ShowInfo(r.g, "Dry run failed: "+err.Error())
+			log.Printf("Restore dry run failed: %v", err)
+			return
+		}
+
+		if v, err := r.g.View(r.note.Name); err == nil {
+			v.Title = "Restore " + tree.Dir + " into " + dbName
+			v.SetOrigin(0, 0)
+			v.SetCursor(0, 0)
+		}
+		r.note.Editable = false
+		r.note.Update(r.g, plan.Summary(dbName, mode))
+
+		if mode == db.ConflictFail && plan.Conflicts() > 0 {
+			popup.ShowInfo(r.g, fmt.Sprintf("Nothing restored: %d documents already exist", plan.Conflicts()))
+			return
+		}
+		popup.ShowConfirmation(r.g, fmt.Sprintf("Restore %d collections into '%s' as in the dry run?", len(collections), dbName), func() {
+			r.restore(client, tree, collections, dbName, mode)
+		}, nil)
+	})
+}
+
+// restore runs the restore as a background job and refreshes the list when done
+func (r *treeRestore) restore(client *mongo.Client, tree db.ExportTree, collections []string, dbName string, mode db.ConflictMode) {
+	conn := r.m.SelectedConnection
+	var result db.RestoreResult
+	var dbs, colls []string
+	r.jobs.Start("Restore "+tree.Dir+" into "+dbName, func(ctx context.Context, progress func(done, total int64)) error {
+		var err error
+		result, err = db.RestoreTree(ctx, client, tree, collections, dbName, mode, progress)
+		if err != nil {
+			return err
+		}
+		// The lists for the refresh; a failed listing only skips it
+		dbs, _ = db.ListDatabasesContext(ctx, client)
+		colls, _ = db.ListCollectionsContext(ctx, client, dbName)
+		return nil
+	}, func(err error) {
+		r.stats.Forget(conn, dbName)
+		if err != nil {
+			return
+		}
+		popup.ShowToast(r.g, fmt.Sprintf("Restored %d collections into %s: %d inserted, %d replaced, %d kept, %d unreadable files",
+			result.Collections, dbName, result.Inserted, result.Replaced, result.Duplicates, result.Invalid))
+		if r.m.SelectedConnection == conn {
+			r.refresh(dbName, dbs, colls)
+		}
+	})
+}
+
+// refresh shows the listed databases or collections of dbName, if the list
+// shows them
+func (r *treeRestore) refresh(dbName string, dbs, colls []string) {
+	switch {
+	case r.m.SelectedListView == "dbs" && dbs != nil:
+		r.m.DBs = dbs
+		r.list.Items = list.Items(r.m.DBs)
+		r.list.Update(r.g)
+	case r.m.SelectedListView == "collections" && r.m.SelectedDB == dbName && colls != nil:
+		r.m.Collections = colls
+		r.list.Items = list.Items(r.m.Collections)
+		r.list.Update(r.g)
+	}
+}
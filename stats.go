@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/awesome-gocui/gocui"
+	"github.com/ksiezykm/FerretMate/db"
+	"github.com/ksiezykm/FerretMate/list"
+	"github.com/ksiezykm/FerretMate/model"
+	"github.com/ksiezykm/FerretMate/notepad"
+)
+
+const (
+	statsMaxAge    = 30 * time.Second // the highlighted item is refetched after this
+	statsFetchers  = 4                // stats commands running at the same time
+	statsNoteTitle = "Statistics"
+)
+
+// statsEntry is the cached stats of one database or collection
+type statsEntry struct {
+	stats   *db.Stats
+	err     error
+	fetched time.Time
+	loading bool
+}
+
+// statsPanel shows dbStats/collStats of the highlighted database or
+// collection in the notepad and a summary next to every name in the list.
+// Stats are fetched in the background and cached, so moving through the
+// list never waits for the server.
+type statsPanel struct {
+	g    *gocui.Gui
+	m    *model.Model
+	list *list.List
+	note *notepad.Notepad
+
+	mu    sync.Mutex
+	cache map[string]*statsEntry // by connection/db or connection/db/collection
+	sem   chan struct{}
+
+	shownKey     string    // item whose stats the notepad shows
+	shownFetched time.Time // fetch time of the shown stats
+	shownContent string    // to tell whether something else replaced the stats
+}
+
+// newStatsPanel creates the stats panel
+func newStatsPanel(g *gocui.Gui, m *model.Model, l *list.List, n *notepad.Notepad) *statsPanel {
+	return &statsPanel{
+		g:     g,
+		m:     m,
+		list:  l,
+		note:  n,
+		cache: make(map[string]*statsEntry),
+		sem:   make(chan struct{}, statsFetchers),
+	}
+}
+
+// key returns the cache key of the list item name on the current level
+func (sp *statsPanel) key(name string) string {
+	if sp.m.SelectedListView == "dbs" {
+		return sp.m.SelectedConnection + "/" + name
+	}
+	return sp.m.SelectedConnection + "/" + sp.m.SelectedDB + "/" + name
+}
+
+// entry returns a copy of the cached stats, starting a fetch if there are
+// none yet or if stale ones are requested to be refreshed
+func (sp *statsPanel) entry(name string, refresh bool) statsEntry {
+	key := sp.key(name)
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+
+	e, ok := sp.cache[key]
+	if !ok {
+		e = &statsEntry{}
+		sp.cache[key] = e
+	}
+	stale := !e.fetched.IsZero() && refresh && time.Since(e.fetched) > statsMaxAge
+	if !e.loading && (e.fetched.IsZero() || stale) {
+		e.loading = true
+		go sp.fetch(e, key, sp.m.SelectedConnection, sp.m.SelectedDB, name, sp.m.SelectedListView == "dbs")
+	}
+	return *e
+}
+
+// fetch runs dbStats or collStats and stores the result in place of e,
+// unless e was forgotten meanwhile
+func (sp *statsPanel) fetch(e *statsEntry, key, conn, dbName, name string, database bool) {
+	sp.sem <- struct{}{}
+	defer func() { <-sp.sem }()
+
+	var stats *db.Stats
+	var err error
+	if s := db.Lookup(conn); s == nil {
+		err = fmt.Errorf("session '%s' is closed", conn)
+	} else if database {
+		stats, err = db.DatabaseStats(context.Background(), s.Client, name)
+	} else {
+		stats, err = db.CollectionStats(context.Background(), s.Client, dbName, name)
+	}
+	if err != nil {
+		log.Printf("Failed to get stats of %s: %v", key, err)
+	}
+
+	sp.mu.Lock()
+	if sp.cache[key] == e {
+		sp.cache[key] = &statsEntry{stats: stats, err: err, fetched: time.Now()}
+	}
+	sp.mu.Unlock()
+
+	// Redraw, the layout picks up the new stats
+	sp.g.Update(func(g *gocui.Gui) error { return nil })
+}
+
+// Forget drops the cached stats of a database and of its collections after
+// it was written to, so that they are fetched again. Jobs call it even when
+// they fail, as a failed write may still have changed the database.
+func (sp *statsPanel) Forget(conn, dbName string) {
+	prefix := conn + "/" + dbName
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	for key := range sp.cache {
+		if key == prefix || strings.HasPrefix(key, prefix+"/") {
+			delete(sp.cache, key)
+		}
+	}
+}
+
+// Layout labels the list items with their stats and shows the stats of the
+// highlighted item. It only touches the widgets when something changed.
+func (sp *statsPanel) Layout(g *gocui.Gui) error {
+	level := sp.m.SelectedListView
+	if level != "dbs" && level != "collections" {
+		if sp.shownKey != "" && sp.note.Content == sp.shownContent {
+			sp.setNote("Editor", "Pick something from the list...")
+		}
+		sp.shownKey = ""
+		return nil
+	}
+	database := level == "dbs"
+
+	// Inline summaries, aligned after the longest name
+	width := 0
+	for _, item := range sp.list.Items {
+		if name, ok := item.Value.(string); ok && len(name) > width {
+			width = len(name)
+		}
+	}
+	changed := false
+	for i, item := range sp.list.Items {
+		name, ok := item.Value.(string)
+		if !ok {
+			continue
+		}
+		label := name
+		if e := sp.entry(name, false); e.stats != nil {
+			label = name + strings.Repeat(" ", width-len(name)) + "  " + e.stats.Summary(database)
+		}
+		if item.Label != label {
+			sp.list.Items[i].Label = label
+			changed = true
+		}
+	}
+	if changed {
+		sp.list.Update(g)
+	}
+
+	// Stats of the highlighted item
+	if sp.list.Selected >= len(sp.list.Items) {
+		return nil
+	}
+	name, _ := sp.list.Items[sp.list.Selected].Value.(string)
+	e := sp.entry(name, true)
+	key := sp.key(name)
+	// Refresh only changed stats, and only while nothing else (e.g. a command
+	// reply) replaced them in the notepad
+	if key == sp.shownKey && (e.fetched.Equal(sp.shownFetched) || sp.note.Content != sp.shownContent) {
+		return nil
+	}
+	title := "Collection " + name
+	if database {
+		title = "Database " + name
+	}
+	switch {
+	case e.stats != nil:
+		sp.setNote(statsNoteTitle, e.stats.Report(title, database))
+	case e.err != nil:
+		sp.setNote(statsNoteTitle, title+"\n\nStatistics unavailable: "+e.err.Error())
+	default:
+		sp.setNote(statsNoteTitle, title+"\n\nLoading statistics...")
+	}
+	sp.shownKey, sp.shownFetched = key, e.fetched
+	return nil
+}
+
+// setNote shows read-only text in the notepad
+func (sp *statsPanel) setNote(title, content string) {
+	if v, err := sp.g.View(sp.note.Name); err == nil {
+		v.Title = title
+	}
+	sp.note.Editable = false
+	sp.note.Update(sp.g, content)
+	sp.shownContent = sp.note.Content
+}
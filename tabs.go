@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/awesome-gocui/gocui"
+	"github.com/ksiezykm/FerretMate/db"
+	"github.com/ksiezykm/FerretMate/list"
+	"github.com/ksiezykm/FerretMate/model"
+	"github.com/ksiezykm/FerretMate/notepad"
+)
+
+// tab is one workspace with its own navigation model and document cursor.
+// The list and notepad widgets are shared, so their state is kept here while
+// another tab is shown.
+type tab struct {
+	m        *model.Model
+	pager    *db.DocumentPager
+	conflict *conflictState
+
+	listItems    []list.Item
+	listSelected int
+	listTitle    string
+	listSubtitle string
+
+	noteTitle    string
+	noteContent  string
+	noteEditable bool
+	noteCursor   [2]int // x, y of the view cursor
+	noteOrigin   [2]int // x, y of the view origin
+
+	focus string // name of the focused view
+}
+
+// saveWidgets stores the state of the shared list and notepad in the tab
+func (t *tab) saveWidgets(g *gocui.Gui, l *list.List, n *notepad.Notepad) {
+	t.listItems = l.Items
+	t.listSelected = l.Selected
+	t.listTitle = l.Title
+	t.listSubtitle = l.Subtitle
+
+	t.noteContent = n.Content
+	t.noteEditable = n.Editable
+	if v, err := g.View(n.Name); err == nil {
+		t.noteTitle = v.Title
+		t.noteCursor[0], t.noteCursor[1] = v.Cursor()
+		t.noteOrigin[0], t.noteOrigin[1] = v.Origin()
+	}
+
+	t.focus = l.Name
+	if v := g.CurrentView(); v != nil && v.Name() == n.Name {
+		t.focus = n.Name
+	}
+}
+
+// restoreWidgets shows the saved state of the tab in the shared list and notepad
+func (t *tab) restoreWidgets(g *gocui.Gui, l *list.List, n *notepad.Notepad) {
+	l.Items = t.listItems
+	l.Selected = t.listSelected
+	l.Title = t.listTitle
+	l.Subtitle = t.listSubtitle
+	l.Update(g)
+
+	n.Editable = t.noteEditable
+	n.Update(g, t.noteContent)
+	if v, err := g.View(n.Name); err == nil {
+		v.Title = t.noteTitle
+		v.SetOrigin(t.noteOrigin[0], t.noteOrigin[1])
+		v.SetCursor(t.noteCursor[0], t.noteCursor[1])
+	}
+
+	focusNote := t.focus == n.Name
+	l.SetActive(g, !focusNote)
+	n.SetActive(g, focusNote)
+	g.SetCurrentView(t.focus)
+}
+
+// leaveSession returns the tab to the connections level after the session
+// it was browsing has been closed
+func (t *tab) leaveSession(listName string) {
+	if t.pager != nil {
+		t.pager.Close()
+	}
+	*t = tab{
+		m: &model.Model{
+			SelectedListView:        "connections",
+			LoadedConnections:       t.m.LoadedConnections,
+			Connections:             t.m.Connections,
+			SelectedConnectionIndex: t.m.SelectedConnectionIndex,
+			Documents:               []model.Document{},
+		},
+		listItems:    connectionItems(t.m.Connections),
+		listSelected: t.m.SelectedConnectionIndex,
+		listTitle:    "Connections",
+		noteTitle:    "Editor",
+		noteContent:  "Session '" + t.m.SelectedConnection + "' was closed.",
+		focus:        listName,
+	}
+}
+
+// tabLabel names a tab after where it is, e.g. "prod > orders > invoices"
+func tabLabel(m *model.Model) string {
+	parts := []string{m.SelectedConnection, m.SelectedDB, m.SelectedCollection}
+	depth := map[string]int{"connections": 0, "dbs": 1, "collections": 2, "documents": 3, "indexes": 3, "pipeline": 3}[m.SelectedListView]
+	if depth == 0 || m.SelectedConnection == "" {
+		return "Connections"
+	}
+	return strings.Join(parts[:depth], " > ")
+}
+
+// tabBar renders the tabs with the current one highlighted. It returns the
+// text with color escapes and its visible length.
+func tabBar(tabs []*tab, current int) (string, int) {
+	var b strings.Builder
+	length := 0
+	for i, t := range tabs {
+		label := fmt.Sprintf(" %d:%s ", i+1, tabLabel(t.m))
+		if i == current {
+			b.WriteString("\x1b[30;46m" + label + "\x1b[0m")
+		} else {
+			b.WriteString(label)
+		}
+		b.WriteString("|")
+		length += len([]rune(label)) + 1
+	}
+	return b.String(), length
+}